@@ -0,0 +1,60 @@
+// Package cache is the application cache: one Store interface with Redis and in-process LRU
+// implementations, and on top of it tag invalidation, request coalescing, jittered TTLs and
+// stale-while-revalidate (see Fetch).
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/utils"
+)
+
+// ErrMiss is returned by Store.Get when a key is absent or expired.
+var ErrMiss = errors.New("cache miss")
+
+// Store is a cache backend.
+type Store interface {
+	// Get returns the value stored under key, or ErrMiss.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores a value that expires after ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes keys; absent keys are ignored.
+	Delete(ctx context.Context, keys ...string) error
+	// Counters returns the value of each counter, 0 for counters never incremented.
+	Counters(ctx context.Context, keys ...string) ([]int64, error)
+	// Incr increments each counter. Counters never expire.
+	Incr(ctx context.Context, keys ...string) error
+}
+
+const defaultMemoryEntries = 10000
+
+// store is the backend in use. It starts in memory so the cache works before Init and in tools that never call it.
+var store Store = NewMemoryStore(defaultMemoryEntries)
+
+// Init selects the cache backend: Redis when it is reachable at startup, otherwise an in-process LRU
+// holding up to CACHE_MEMORY_ENTRIES entries (default 10000), so the server starts without Redis.
+func Init() {
+	rdb, err := utils.InitRedisClient()
+	if err == nil {
+		store = NewRedisStore(rdb)
+		log.Println("Cache: using Redis")
+		return
+	}
+
+	entries := defaultMemoryEntries
+	if n, err := strconv.Atoi(os.Getenv("CACHE_MEMORY_ENTRIES")); err == nil && n > 0 {
+		entries = n
+	}
+	store = NewMemoryStore(entries)
+	log.Printf("Cache: Redis unavailable, using an in-memory cache of %d entries", entries)
+}
+
+// Default returns the backend selected by Init.
+func Default() Store {
+	return store
+}
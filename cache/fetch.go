@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// storeTimeout bounds each round trip to the store made by Fetch.
+const storeTimeout = 2 * time.Second
+
+// Options control how Fetch caches a value.
+type Options struct {
+	TTL   time.Duration // how long an entry is fresh, jittered by ±10% so entries written together do not expire together
+	Stale time.Duration // how long after that the entry may still be served while one request refreshes it
+	Tags  []string      // tags known before loading; their versions are read before the load so a racing invalidation is not lost
+}
+
+// Loader computes a value on a cache miss. It returns the value and any tags only known after loading,
+// e.g. those of the products in a listing.
+type Loader func() (value []byte, tags []string, err error)
+
+// entry is what Fetch stores under a key.
+type entry struct {
+	Value      json.RawMessage  `json:"value"`
+	Tags       map[string]int64 `json:"tags"`
+	FreshUntil time.Time        `json:"fresh_until"`
+}
+
+var group singleflight.Group
+
+// Fetch returns the value cached under key, loading and caching it on a miss.
+//
+//   - Concurrent misses for the same key are coalesced: one request runs load and the others share its result.
+//   - An entry whose tags were invalidated is a miss and is never served.
+//   - An entry past its TTL but within its stale window is served as is while it is refreshed in the background.
+//   - If the store fails, the value is loaded directly, so a cache outage slows requests down but never fails them.
+//
+// Errors from load are returned as is and are not cached.
+func Fetch(ctx context.Context, key string, opts Options, load Loader) ([]byte, error) {
+	cached, err := lookup(ctx, key)
+	switch {
+	case err == nil && time.Now().Before(cached.FreshUntil):
+		return cached.Value, nil
+	case err == nil:
+		// Stale: refresh in the background unless a refresh or a load is already running
+		group.DoChan(key, func() (interface{}, error) {
+			return fill(key, opts, load)
+		})
+		return cached.Value, nil
+	case !errors.Is(err, ErrMiss):
+		log.Printf("Cache error reading %s: %v", key, err)
+	}
+
+	value, err, _ := group.Do(key, func() (interface{}, error) {
+		return fill(key, opts, load)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]byte), nil
+}
+
+// lookup reads an entry and checks its tags, returning ErrMiss if it is absent or invalidated.
+func lookup(ctx context.Context, key string) (*entry, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+
+	data, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var cached entry
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, ErrMiss
+	}
+
+	tags := make([]string, 0, len(cached.Tags))
+	for tag := range cached.Tags {
+		tags = append(tags, tag)
+	}
+	current, err := TagVersions(ctx, tags...)
+	if err != nil {
+		return nil, err
+	}
+	for tag, version := range cached.Tags {
+		if current[tag] != version {
+			return nil, ErrMiss
+		}
+	}
+	return &cached, nil
+}
+
+// fill loads a value and stores it. It runs at most once per key at a time and outlives the request
+// that started it, so it uses its own contexts.
+func fill(key string, opts Options, load Loader) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	versions, versionsErr := TagVersions(ctx, opts.Tags...)
+	cancel()
+
+	value, tags, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if versionsErr != nil {
+		log.Printf("Cache error reading tag versions for %s: %v", key, versionsErr)
+		return value, nil
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	var missing []string
+	for _, tag := range tags {
+		if _, ok := versions[tag]; !ok {
+			missing = append(missing, tag)
+		}
+	}
+	current, err := TagVersions(ctx, missing...)
+	if err != nil {
+		log.Printf("Cache error reading tag versions for %s: %v", key, err)
+		return value, nil
+	}
+	for tag, version := range current {
+		versions[tag] = version
+	}
+
+	ttl := jitter(opts.TTL)
+	data, err := json.Marshal(entry{Value: value, Tags: versions, FreshUntil: time.Now().Add(ttl)})
+	if err == nil {
+		err = store.Set(ctx, key, data, ttl+opts.Stale)
+	}
+	if err != nil {
+		log.Printf("Cache error writing %s: %v", key, err)
+	}
+	return value, nil
+}
+
+// jitter spreads ttl by up to ±10%.
+func jitter(ttl time.Duration) time.Duration {
+	spread := int64(ttl) / 5
+	if spread <= 0 {
+		return ttl
+	}
+	return ttl - time.Duration(spread/2) + time.Duration(rand.Int63n(spread))
+}
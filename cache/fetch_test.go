@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useMemoryStore gives a test its own empty store and restores the previous one afterwards.
+func useMemoryStore(t *testing.T) {
+	previous := store
+	store = NewMemoryStore(100)
+	t.Cleanup(func() { store = previous })
+}
+
+// countingLoader returns "value N" on its Nth call.
+func countingLoader(calls *atomic.Int32, tags ...string) Loader {
+	return func() ([]byte, []string, error) {
+		n := calls.Add(1)
+		return []byte(`"value ` + strconv.Itoa(int(n)) + `"`), tags, nil
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		opts      Options
+		loadTags  []string
+		between   func()
+		want      string
+		wantCalls int32
+	}{
+		{
+			name:      "fresh entry is served",
+			opts:      Options{TTL: time.Minute},
+			between:   func() {},
+			want:      `"value 1"`,
+			wantCalls: 1,
+		},
+		{
+			name:      "invalidated tag is a miss",
+			opts:      Options{TTL: time.Minute, Tags: []string{"catalog"}},
+			between:   func() { InvalidateTags("catalog") },
+			want:      `"value 2"`,
+			wantCalls: 2,
+		},
+		{
+			name:      "tag returned by the loader is tracked",
+			opts:      Options{TTL: time.Minute},
+			loadTags:  []string{"product:1"},
+			between:   func() { InvalidateTags(ProductTag(1)) },
+			want:      `"value 2"`,
+			wantCalls: 2,
+		},
+		{
+			name:      "other tags are ignored",
+			opts:      Options{TTL: time.Minute, Tags: []string{"catalog"}},
+			between:   func() { InvalidateTags("recommendations") },
+			want:      `"value 1"`,
+			wantCalls: 1,
+		},
+		{
+			name:      "expired entry without a stale window is a miss",
+			opts:      Options{TTL: 10 * time.Millisecond},
+			between:   func() { time.Sleep(30 * time.Millisecond) },
+			want:      `"value 2"`,
+			wantCalls: 2,
+		},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useMemoryStore(t)
+			key := "fetch:" + strconv.Itoa(i)
+			var calls atomic.Int32
+			load := countingLoader(&calls, test.loadTags...)
+
+			if _, err := Fetch(ctx, key, test.opts, load); err != nil {
+				t.Fatalf("first Fetch() error = %v", err)
+			}
+			test.between()
+			got, err := Fetch(ctx, key, test.opts, load)
+			if err != nil {
+				t.Fatalf("second Fetch() error = %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("Fetch() = %s, want %s", got, test.want)
+			}
+			if n := calls.Load(); n != test.wantCalls {
+				t.Errorf("loader ran %d times, want %d", n, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFetchServesStaleWhileRefreshing(t *testing.T) {
+	useMemoryStore(t)
+	ctx := context.Background()
+	opts := Options{TTL: 10 * time.Millisecond, Stale: time.Minute}
+	var calls atomic.Int32
+	load := countingLoader(&calls)
+
+	Fetch(ctx, "stale", opts, load)
+	time.Sleep(30 * time.Millisecond)
+
+	got, err := Fetch(ctx, "stale", opts, load)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if string(got) != `"value 1"` {
+		t.Errorf("stale Fetch() = %s, want the stale value", got)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		got, _ = Fetch(ctx, "stale", Options{TTL: time.Minute}, load)
+		if string(got) == `"value 2"` {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Fetch() = %s, the entry was never refreshed", got)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("loader ran %d times, want 2", n)
+	}
+}
+
+func TestFetchCoalescesMisses(t *testing.T) {
+	useMemoryStore(t)
+	release := make(chan struct{})
+	var calls atomic.Int32
+	load := func() ([]byte, []string, error) {
+		calls.Add(1)
+		<-release
+		return []byte(`"value"`), nil, nil
+	}
+
+	const requests = 10
+	var wg sync.WaitGroup
+	results := make([]string, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, err := Fetch(context.Background(), "coalesced", Options{TTL: time.Minute}, load)
+			if err != nil {
+				t.Errorf("Fetch() error = %v", err)
+			}
+			results[i] = string(value)
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("loader ran %d times, want 1", n)
+	}
+	for i, result := range results {
+		if result != `"value"` {
+			t.Errorf("request %d got %s", i, result)
+		}
+	}
+}
+
+func TestFetchDoesNotCacheErrors(t *testing.T) {
+	useMemoryStore(t)
+	ctx := context.Background()
+	failure := errors.New("database down")
+	fail := func() ([]byte, []string, error) { return nil, nil, failure }
+
+	if _, err := Fetch(ctx, "failing", Options{TTL: time.Minute}, fail); !errors.Is(err, failure) {
+		t.Fatalf("Fetch() error = %v, want %v", err, failure)
+	}
+	var calls atomic.Int32
+	got, err := Fetch(ctx, "failing", Options{TTL: time.Minute}, countingLoader(&calls))
+	if err != nil || string(got) != `"value 1"` {
+		t.Errorf("Fetch() after an error = %s, %v, want a fresh load", got, err)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		ttl      time.Duration
+		min, max time.Duration
+	}{
+		{0, 0, 0},
+		{time.Nanosecond, time.Nanosecond, time.Nanosecond},
+		{10 * time.Second, 9 * time.Second, 11 * time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			if got := jitter(test.ttl); got < test.min || got > test.max {
+				t.Fatalf("jitter(%v) = %v, want between %v and %v", test.ttl, got, test.min, test.max)
+			}
+		}
+	}
+}
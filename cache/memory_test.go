@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreGet(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		maxEntries int
+		prepare    func(s *MemoryStore)
+		key        string
+		want       string
+		wantErr    error
+	}{
+		{
+			name:       "stored value",
+			maxEntries: 2,
+			prepare:    func(s *MemoryStore) { s.Set(ctx, "a", []byte("1"), time.Minute) },
+			key:        "a",
+			want:       "1",
+		},
+		{
+			name:       "absent key",
+			maxEntries: 2,
+			prepare:    func(s *MemoryStore) {},
+			key:        "a",
+			wantErr:    ErrMiss,
+		},
+		{
+			name:       "expired value",
+			maxEntries: 2,
+			prepare:    func(s *MemoryStore) { s.Set(ctx, "a", []byte("1"), -time.Second) },
+			key:        "a",
+			wantErr:    ErrMiss,
+		},
+		{
+			name:       "overwritten value",
+			maxEntries: 2,
+			prepare: func(s *MemoryStore) {
+				s.Set(ctx, "a", []byte("1"), time.Minute)
+				s.Set(ctx, "a", []byte("2"), time.Minute)
+			},
+			key:  "a",
+			want: "2",
+		},
+		{
+			name:       "deleted value",
+			maxEntries: 2,
+			prepare: func(s *MemoryStore) {
+				s.Set(ctx, "a", []byte("1"), time.Minute)
+				s.Delete(ctx, "a", "absent")
+			},
+			key:     "a",
+			wantErr: ErrMiss,
+		},
+		{
+			name:       "least recently used is evicted",
+			maxEntries: 2,
+			prepare: func(s *MemoryStore) {
+				s.Set(ctx, "a", []byte("1"), time.Minute)
+				s.Set(ctx, "b", []byte("2"), time.Minute)
+				s.Set(ctx, "c", []byte("3"), time.Minute)
+			},
+			key:     "a",
+			wantErr: ErrMiss,
+		},
+		{
+			name:       "reading keeps an entry",
+			maxEntries: 2,
+			prepare: func(s *MemoryStore) {
+				s.Set(ctx, "a", []byte("1"), time.Minute)
+				s.Set(ctx, "b", []byte("2"), time.Minute)
+				s.Get(ctx, "a")
+				s.Set(ctx, "c", []byte("3"), time.Minute)
+			},
+			key:  "a",
+			want: "1",
+		},
+		{
+			name:       "overwriting keeps an entry",
+			maxEntries: 2,
+			prepare: func(s *MemoryStore) {
+				s.Set(ctx, "a", []byte("1"), time.Minute)
+				s.Set(ctx, "b", []byte("2"), time.Minute)
+				s.Set(ctx, "a", []byte("4"), time.Minute)
+				s.Set(ctx, "c", []byte("3"), time.Minute)
+			},
+			key:     "b",
+			wantErr: ErrMiss,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewMemoryStore(test.maxEntries)
+			test.prepare(s)
+			got, err := s.Get(ctx, test.key)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Get(%q) error = %v, want %v", test.key, err, test.wantErr)
+			}
+			if string(got) != test.want {
+				t.Errorf("Get(%q) = %q, want %q", test.key, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreCounters(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		incr [][]string
+		keys []string
+		want []int64
+	}{
+		{"never incremented", nil, []string{"a"}, []int64{0}},
+		{"incremented", [][]string{{"a", "b"}, {"a"}}, []string{"a", "b", "c"}, []int64{2, 1, 0}},
+		{"no keys", [][]string{{"a"}}, nil, []int64{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewMemoryStore(1)
+			for _, keys := range test.incr {
+				s.Incr(ctx, keys...)
+			}
+			got, err := s.Counters(ctx, test.keys...)
+			if err != nil {
+				t.Fatalf("Counters() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Counters() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreEvictionKeepsCounters(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(1)
+	s.Incr(ctx, "version")
+	s.Set(ctx, "a", []byte("1"), time.Minute)
+	s.Set(ctx, "b", []byte("2"), time.Minute)
+
+	got, _ := s.Counters(ctx, "version")
+	if got[0] != 1 {
+		t.Errorf("Counters() after eviction = %v, want [1]", got)
+	}
+}
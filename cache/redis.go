@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore is a Store backed by Redis, shared by every instance of the server.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore returns a Store using client.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+func (s *RedisStore) Counters(ctx context.Context, keys ...string) ([]int64, error) {
+	counters := make([]int64, len(keys))
+	if len(keys) == 0 {
+		return counters, nil
+	}
+
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			counters[i], _ = strconv.ParseInt(s, 10, 64)
+		}
+	}
+	return counters, nil
+}
+
+func (s *RedisStore) Incr(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	pipe := s.client.Pipeline()
+	for _, key := range keys {
+		pipe.Incr(ctx, key)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Tags. Every cached catalog entry carries the catalog tag, listings carry the tag of the category
+// they are filtered by (or the all-categories tag), related-product lists carry the recommendations tag and
+// every entry carries the tags of the products it contains.
+const (
+	CatalogTag         = "catalog"
+	AllCategoriesTag   = "category:all"
+	RecommendationsTag = "recommendations"
+)
+
+// ProductTag is the tag of one product.
+func ProductTag(productID int) string {
+	return fmt.Sprintf("product:%d", productID)
+}
+
+// CategoryTag is the tag of the listings filtered by one category.
+func CategoryTag(category interface{}) string {
+	return fmt.Sprintf("category:%v", category)
+}
+
+func tagVersionKey(tag string) string {
+	return "cachetag:" + tag
+}
+
+// TagVersions reads the current version of each tag. Tags that were never invalidated are at version 0.
+func TagVersions(ctx context.Context, tags ...string) (map[string]int64, error) {
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = tagVersionKey(tag)
+	}
+	counters, err := store.Counters(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]int64, len(tags))
+	for i, tag := range tags {
+		versions[tag] = counters[i]
+	}
+	return versions, nil
+}
+
+// InvalidateTags bumps the version of each tag, which invalidates every cached entry carrying it.
+// Entries are not deleted: they are ignored on read and expire through their TTL.
+func InvalidateTags(tags ...string) {
+	if len(tags) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = tagVersionKey(tag)
+	}
+	if err := store.Incr(ctx, keys...); err != nil {
+		log.Printf("Error invalidating cache tags %v: %v", tags, err)
+	}
+}
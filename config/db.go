@@ -11,10 +11,10 @@ import (
 	"gorm.io/gorm"
 )
 
+// init loads .env when there is one. Without it the settings come from the environment, as in tests.
 func init() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error loading .env file")
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error loading .env file: %v", err)
 	}
 }
 
@@ -45,14 +45,49 @@ func ConnectDatabase() {
 		&models.BlogPost{},
 		&models.Affliate{},
 		&models.Category{},
+		&models.CategoryAttribute{},
+		&models.CategoryTranslation{},
 		&models.Product{},
+		&models.ProductTranslation{},
+		&models.SlugRedirect{},
+		&models.BundleComponent{},
+		&models.PriceHistory{},
+		&models.Sale{},
+		&models.Currency{},
+		&models.ExchangeRate{},
+		&models.ProductCurrencyPrice{},
+		&models.ProductAttributeValue{},
 		&models.Payment{},
 		&models.Shipping{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderItemComponent{},
+		&models.StockReservation{},
+		&models.DigitalAsset{},
+		&models.DownloadGrant{},
+		&models.LicenceKey{},
+		&models.Wishlist{},
+		&models.WishlistItem{},
+		&models.StockSubscription{},
+		&models.ComparisonItem{},
+		&models.ProductQuestion{},
+		&models.ProductAnswer{},
+		&models.QAVote{},
+		&models.ProductAffinity{},
 		&models.Tag{},
+		&models.ProductTag{},
+		&models.Warehouse{},
 		&models.Inventory{},
+		&models.TransferOrder{},
+		&models.TransferOrderItem{},
+		&models.StockMovement{},
+		&models.Supplier{},
+		&models.PurchaseOrder{},
+		&models.PurchaseOrderItem{},
+		&models.StockTake{},
+		&models.StockTakeLine{},
 		&models.Review{},
+		&models.ReviewReport{},
 		&models.Profile{},
 		&models.Notification{},
 	)
@@ -61,6 +96,19 @@ func ConnectDatabase() {
 		log.Fatalf("Failed to migrate database schema: %v", err)
 	}
 
+	// Trigram indexes let name searches (ILIKE '%term%') use an index in every language.
+	// They need the pg_trgm extension, so failures are logged and searches fall back to scans.
+	for _, statement := range []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING gin (name gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_product_translations_name_trgm ON product_translations USING gin (name gin_trgm_ops)",
+	} {
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Printf("Skipping search index setup: %v", err)
+			break
+		}
+	}
+
 }
 
 // func ReinitializeDatabase() {
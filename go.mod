@@ -6,7 +6,6 @@ toolchain go1.22.6
 
 require (
 	firebase.google.com/go v3.13.0+incompatible
-	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/golang-jwt/jwt/v4 v4.5.0
 	github.com/gorilla/mux v1.8.1
 	github.com/joho/godotenv v1.5.1
@@ -14,6 +13,7 @@ require (
 	github.com/redis/go-redis/v9 v9.6.1
 	github.com/stripe/stripe-go v70.15.0+incompatible
 	golang.org/x/crypto v0.25.0
+	golang.org/x/sync v0.8.0
 	google.golang.org/api v0.191.0
 	gorm.io/driver/postgres v1.5.9
 	gorm.io/gorm v1.25.11
@@ -61,7 +61,6 @@ require (
 	go.opentelemetry.io/otel/trace v1.24.0 // indirect
 	golang.org/x/net v0.27.0 // indirect
 	golang.org/x/oauth2 v0.22.0 // indirect
-	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 	golang.org/x/time v0.6.0 // indirect
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
+)
+
+// SpecificationEntry is one row of a product specification sheet
+type SpecificationEntry struct {
+	Name  string      `json:"name"`
+	Label string      `json:"label"`
+	Type  string      `json:"type"`
+	Unit  string      `json:"unit,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// GetCategoryAttributes returns the attribute schema of a category
+func GetCategoryAttributes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	var attributes []models.CategoryAttribute
+	if err := config.DB.Where("category_id = ?", id).Order("id").Find(&attributes).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(attributes)
+}
+
+// GetProductSpecifications returns the specification sheet of a product
+func GetProductSpecifications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	var product models.Product
+	if err := config.DB.First(&product, id).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var values []models.ProductAttributeValue
+	if err := config.DB.Preload("Attribute").Where("product_id = ?", product.ID).Order("attribute_id").Find(&values).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	specifications := make([]SpecificationEntry, 0, len(values))
+	for _, value := range values {
+		entry := SpecificationEntry{
+			Name:  value.Attribute.Name,
+			Label: value.Attribute.Label,
+			Type:  value.Attribute.Type,
+			Unit:  value.Attribute.Unit,
+		}
+		switch {
+		case value.ValueNumber != nil:
+			entry.Value = *value.ValueNumber
+		case value.ValueBool != nil:
+			entry.Value = *value.ValueBool
+		default:
+			entry.Value = value.ValueString
+		}
+		specifications = append(specifications, entry)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"product_id":     product.ID,
+		"dimensions":     product.Dimensions,
+		"weight":         product.Weight,
+		"specifications": specifications,
+	})
+}
+
+// SetProductAttributes replaces a product's attribute values. The body maps attribute names to values,
+// e.g. {"ram_gb": 16, "color": "black"}, and is validated against the product's category schema.
+func SetProductAttributes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	var product models.Product
+	if err := config.DB.First(&product, id).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var values map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := services.SetProductAttributes(config.DB, &product, values); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	services.InvalidateProductCache(int(product.ID))
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Product attributes updated"})
+}
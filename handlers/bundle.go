@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
+)
+
+// GetBundleComponents returns the components of a bundle and how many bundles can currently be assembled
+func GetBundleComponents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var product models.Product
+	if err := config.DB.Scopes(services.PublishedProducts).First(&product, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if product.Type != models.ProductTypeBundle {
+		http.Error(w, "Product is not a bundle", http.StatusBadRequest)
+		return
+	}
+
+	bundles, err := services.LoadBundleComponents(config.DB, []int{int(product.ID)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	components := bundles[int(product.ID)]
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bundle_id":  product.ID,
+		"available":  services.BundleAvailability(components),
+		"components": components,
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/theinvincible/ecommerce-backend/config"
 	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
 	"gorm.io/gorm"
 )
 
@@ -20,6 +21,12 @@ func CreateCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Prices always come from the catalog, never from the client
+	if err := services.PriceCart(config.DB, &cart); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if err := config.DB.Create(&cart).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -64,7 +71,7 @@ func UpdateCart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var cart models.Cart
-	if err := config.DB.First(&cart, id).Error; err != nil {
+	if err := config.DB.Preload("Items").First(&cart, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			http.Error(w, "Cart not found", http.StatusNotFound)
 		} else {
@@ -78,6 +85,11 @@ func UpdateCart(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	//recomputes item prices and cart totals from the catalog
+	if err := services.PriceCart(config.DB, &cart); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	//saves the new cart
 	if err := config.DB.Save(&cart).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/theinvincible/ecommerce-backend/config"
 	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
+	"gorm.io/gorm"
 )
 
 // CreateCategory creates a new category
@@ -24,6 +29,7 @@ func CreateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	services.InvalidateCategoryCache(int(category.ID))
 	json.NewEncoder(w).Encode(category)
 }
 
@@ -32,25 +38,75 @@ func GetCategories(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var categories []models.Category
-	if err := config.DB.Preload("Products").Find(&categories).Error; err != nil {
+	if err := config.DB.Preload("Products", services.PublishedProducts).Find(&categories).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := services.LocaliseCategories(config.DB, categories, requestLanguages(w, r)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	setContentLanguage(w, categoryLanguages(categories)...)
 	json.NewEncoder(w).Encode(categories)
 }
 
+// GetCategory returns a category with its published products
 func GetCategory(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	id := mux.Vars(r)["id"]
+	writeCategory(w, r, mux.Vars(r)["id"])
+}
+
+// GetCategoryBySlug returns a category by slug, redirecting old slugs to the current one with 301
+func GetCategoryBySlug(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	categoryID, slug, redirect, err := services.ResolveSlug(config.DB, models.SlugEntityCategory, mux.Vars(r)["slug"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if redirect {
+		redirectToSlug(w, r, "/api/v1/categories/slug/", slug)
+		return
+	}
+
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"canonical\"", services.CanonicalURL(models.SlugEntityCategory, slug)))
+	writeCategory(w, r, categoryID)
+}
+
+// writeCategory writes a category with its published products in the request's languages
+func writeCategory(w http.ResponseWriter, r *http.Request, id interface{}) {
 	var category models.Category
-	if err := config.DB.Preload("Products").First(&category, id).Error; err != nil {
+	if err := config.DB.Preload("Products", services.PublishedProducts).First(&category, id).Error; err != nil {
 		http.Error(w, "Category not found", http.StatusNotFound)
 		return
 	}
+	categories := []models.Category{category}
+	if err := services.LocaliseCategories(config.DB, categories, requestLanguages(w, r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	json.NewEncoder(w).Encode(category)
+	setContentLanguage(w, categoryLanguages(categories)...)
+	json.NewEncoder(w).Encode(categories[0])
+}
+
+// categoryLanguages lists the languages of localised categories and their products.
+func categoryLanguages(categories []models.Category) []string {
+	var languages []string
+	for _, category := range categories {
+		languages = append(languages, category.Language)
+		for _, product := range category.Products {
+			languages = append(languages, product.Language)
+		}
+	}
+	return languages
 }
 
 // UpdateCategory updates a category by ID
@@ -63,17 +119,29 @@ func UpdateCategory(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Category not found", http.StatusNotFound)
 		return
 	}
+	previousSlug := category.Slug
 
 	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := config.DB.Save(&category).Error; err != nil {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := services.ReconcileSlug(tx, models.SlugEntityCategory, int(category.ID), previousSlug, &category.Slug); err != nil {
+			return err
+		}
+		return tx.Save(&category).Error
+	})
+	if errors.Is(err, services.ErrSlugTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	services.InvalidateCategoryCache(int(category.ID))
 	json.NewEncoder(w).Encode(category)
 }
 
@@ -86,6 +154,9 @@ func DeleteCategory(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if categoryID, err := strconv.Atoi(id); err == nil {
+		services.InvalidateCategoryCache(categoryID)
+	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Category deleted"})
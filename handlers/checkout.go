@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/theinvincible/ecommerce-backend/config"
 	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
 	"github.com/theinvincible/ecommerce-backend/utils"
 	"google.golang.org/api/option"
 	"gorm.io/gorm"
@@ -25,24 +27,58 @@ func CheckoutHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		//Fetch cart items for the user
+		//Fetch cart items for the user. Cart items belong to the user through their cart.
+		userCarts := config.DB.Model(&models.Cart{}).Select("id").Where("user_id = ?", req.UserID)
 		var cartItems []models.CartItem
-		config.DB.Where("user_id = ?", req.UserID).Find(&cartItems)
+		config.DB.Where("cart_id IN (?)", userCarts).Find(&cartItems)
 
 		if len(cartItems) == 0 {
 			http.Error(w, "Cart is empty", http.StatusBadRequest)
 			return
 		}
 
+		//Charge the current effective price in the order currency rather than the price stored when the item was added
+		currency := services.ResolveCurrency(config.DB, req.Currency, int(req.UserID))
+		converter, err := services.NewConverter(config.DB, currency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := services.PriceCartItems(config.DB, cartItems, currency); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		//Orders made up only of digital products are delivered by download, so they need no shipping address
+		productIDs := make([]int, len(cartItems))
+		for i, item := range cartItems {
+			productIDs[i] = item.ProductID
+		}
+		digital, err := services.DigitalProductIDs(config.DB, productIDs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		digitalOnly := true
+		for _, item := range cartItems {
+			digitalOnly = digitalOnly && digital[item.ProductID]
+		}
+		if !digitalOnly && req.ShippingAddress == "" {
+			http.Error(w, "Shipping address is required", http.StatusBadRequest)
+			return
+		}
+
 		//Create order
 
 		order := models.Order{
 			UserID:             int(req.UserID),
 			TotalAmount:        0,
+			Currency:           currency,
 			OrderPaymentStatus: "Pending",
 			OrderTime:          time.Now(),
 			Quantity:           0,
 			PaymentMethod:      req.PaymentMethod,
+			DigitalOnly:        digitalOnly,
 		}
 
 		//Build order items and calculate total
@@ -55,21 +91,37 @@ func CheckoutHandler(db *gorm.DB) http.HandlerFunc {
 				Total:     item.Total,
 			}
 			orderItems = append(orderItems, orderItem)
-			order.TotalAmount += orderItem.Price * float64(orderItem.Quantity)
+			order.TotalAmount += orderItem.Total
 		}
+		order.TotalAmount = converter.Round(order.TotalAmount) //rounded like the cart total, to the currency's decimals or rounding increment
 
 		order.OrderItems = orderItems //populates the OrderItems field of the order struct (which is a placeholder for models.Order) with the orderItems slice.
 
-		if err := config.DB.Create(&order).Error; err != nil { //Saves the order and its associated items to the database.
+		//Save the order and reserve its items together so an order is never placed for stock that is gone.
+		//The reservation is committed when the order is paid, or released if payment fails or never arrives.
+		reservedUntil := time.Now().Add(services.ReservationTTL())
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&order).Error; err != nil { //Saves the order and its associated items to the database.
+				return err
+			}
+			destination := services.Destination{Country: req.ShippingCountry, Latitude: req.ShippingLatitude, Longitude: req.ShippingLongitude}
+			return services.ReserveOrderStock(tx, &order, destination, reservedUntil)
+		})
+		if errors.Is(err, services.ErrInsufficientStock) || errors.Is(err, services.ErrNoWarehouse) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		services.InvalidateProductCache(productIDs...)
 
 		//Clear cart
-		config.DB.Where("user_id = ?", req.UserID).Delete(&models.CartItem{}) //Deletes all cart items for the user from the database, effectively clearing the user's cart.
+		config.DB.Where("cart_id IN (?)", userCarts).Delete(&models.CartItem{}) //Deletes all cart items for the user from the database, effectively clearing the user's cart.
 
 		// Prepare order details for email
-		orderDetails := fmt.Sprintf("Order ID: %d\nTotal: $%.2f", order.ID, order.TotalAmount)
+		orderDetails := fmt.Sprintf("Order ID: %d\nTotal: %.2f %s", order.ID, order.TotalAmount, order.Currency)
 
 		// Send confirmation email
 		user, err := getUserByID(req.UserID)
@@ -84,7 +136,8 @@ func CheckoutHandler(db *gorm.DB) http.HandlerFunc {
 
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"order_id": order.ID,
+			"order_id":       order.ID,
+			"reserved_until": reservedUntil,
 		})
 	}
 }
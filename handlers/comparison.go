@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
+)
+
+// ComparisonItemRequest is the body for adding a product to the comparison list
+type ComparisonItemRequest struct {
+	ProductID int `json:"product_id"`
+}
+
+// writeComparison writes the comparison matrix of the given products in the request's currency
+func writeComparison(w http.ResponseWriter, r *http.Request, productIDs []int) {
+	comparison, err := services.CompareProducts(config.DB, productIDs, requestCurrency(r), requestLanguages(w, r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	languages := make([]string, len(comparison.Products))
+	for i, product := range comparison.Products {
+		languages[i] = product.Language
+	}
+	setContentLanguage(w, languages...)
+
+	json.NewEncoder(w).Encode(comparison)
+}
+
+// CompareProducts returns the comparison matrix of up to four products given by ?ids=1,2,3
+func CompareProducts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var productIDs []int
+	for _, raw := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		productID, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "Invalid product ID "+raw, http.StatusBadRequest)
+			return
+		}
+		productIDs = append(productIDs, productID)
+	}
+
+	writeComparison(w, r, productIDs)
+}
+
+// GetComparison returns the comparison matrix of the shopper's saved comparison list
+func GetComparison(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	viewer, _ := viewerFromRequest(r)
+	if viewer == "" {
+		http.Error(w, "user_id or X-Session-ID is required", http.StatusBadRequest)
+		return
+	}
+
+	productIDs, err := services.ComparisonProductIDs(config.DB, viewer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(productIDs) == 0 {
+		json.NewEncoder(w).Encode(services.Comparison{
+			Currency: requestCurrency(r),
+			Products: []services.ComparedProduct{},
+			Rows:     []services.ComparisonRow{},
+		})
+		return
+	}
+
+	writeComparison(w, r, productIDs)
+}
+
+// AddComparisonItem adds a product to the shopper's comparison list
+func AddComparisonItem(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	viewer, _ := viewerFromRequest(r)
+	if viewer == "" {
+		http.Error(w, "user_id or X-Session-ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req ComparisonItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := services.AddToComparison(config.DB, viewer, req.ProductID); err != nil {
+		if errors.Is(err, services.ErrComparisonFull) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	productIDs, err := services.ComparisonProductIDs(config.DB, viewer)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"product_ids": productIDs})
+}
+
+// RemoveComparisonItem removes a product from the shopper's comparison list
+func RemoveComparisonItem(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	viewer, _ := viewerFromRequest(r)
+	if viewer == "" {
+		http.Error(w, "user_id or X-Session-ID is required", http.StatusBadRequest)
+		return
+	}
+
+	result := config.DB.Where("owner = ? AND product_id = ?", viewer, mux.Vars(r)["productID"]).Delete(&models.ComparisonItem{})
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Product is not on the comparison list", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Product removed from comparison"})
+}
+
+// ClearComparison empties the shopper's comparison list
+func ClearComparison(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	viewer, _ := viewerFromRequest(r)
+	if viewer == "" {
+		http.Error(w, "user_id or X-Session-ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := config.DB.Where("owner = ?", viewer).Delete(&models.ComparisonItem{}).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Comparison list cleared"})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
+)
+
+// requestCurrency resolves the presentment currency from the currency query parameter,
+// the preference of the user given by user_id, or the store default.
+func requestCurrency(r *http.Request) string {
+	userID, _ := strconv.Atoi(r.URL.Query().Get("user_id"))
+	return services.ResolveCurrency(config.DB, r.URL.Query().Get("currency"), userID)
+}
+
+// presentCatalogJSON re-renders cached base-currency product JSON, either one product or a list, in another currency.
+// Caches always hold base-currency data so a rate change never leaves converted prices behind.
+func presentCatalogJSON(currency string, data []byte) ([]byte, error) {
+	if currency == services.BaseCurrency() {
+		return data, nil
+	}
+
+	if len(data) > 0 && data[0] == '[' {
+		var products []models.Product
+		if err := json.Unmarshal(data, &products); err != nil {
+			return nil, err
+		}
+		if err := services.PresentProducts(config.DB, products, currency); err != nil {
+			return nil, err
+		}
+		return json.Marshal(products)
+	}
+
+	var product models.Product
+	if err := json.Unmarshal(data, &product); err != nil {
+		return nil, err
+	}
+	products := []models.Product{product}
+	if err := services.PresentProducts(config.DB, products, currency); err != nil {
+		return nil, err
+	}
+	return json.Marshal(products[0])
+}
+
+// writeCatalogJSON writes product JSON in the requested currency
+func writeCatalogJSON(w http.ResponseWriter, currency string, data []byte) {
+	presented, err := presentCatalogJSON(currency, data)
+	if err != nil {
+		http.Error(w, "Error preparing products data", http.StatusInternalServerError)
+		return
+	}
+	setContentLanguage(w, productLanguages(data)...)
+	w.Write(presented)
+}
+
+// GetCurrencies lists the base currency and every currency with a known exchange rate
+func GetCurrencies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var rates []models.ExchangeRate
+	if err := config.DB.Order("currency").Find(&rates).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var currencies []models.Currency
+	if err := config.DB.Order("code").Find(&currencies).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"base_currency": services.BaseCurrency(),
+		"currencies":    currencies,
+		"rates":         rates,
+	})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
+)
+
+// DownloadFile serves the file behind a signed download link and counts the download
+func DownloadFile(w http.ResponseWriter, r *http.Request) {
+	grantID, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid download link", http.StatusBadRequest)
+		return
+	}
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid download link", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.VerifyDownload(uint(grantID), expires, r.URL.Query().Get("signature")); err != nil {
+		if errors.Is(err, services.ErrDownloadLinkExpired) {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	asset, err := services.ConsumeDownload(config.DB, uint(grantID))
+	switch {
+	case errors.Is(err, services.ErrDownloadLimitReached):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, services.ErrDownloadLinkInvalid):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		log.Printf("Error preparing download %d: %v", grantID, err)
+		http.Error(w, "File not available", http.StatusNotFound)
+		return
+	}
+
+	fileName := asset.FileName
+	if fileName == "" {
+		fileName = filepath.Base(asset.FilePath)
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+strconv.Quote(fileName))
+	http.ServeFile(w, r, services.DigitalFilePath(asset))
+}
+
+// GetOrderDownloads returns fresh download links and licence keys for the digital items of a paid order
+// to the user who placed it, identified by their bearer token
+func GetOrderDownloads(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, err := requestUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var order models.Order
+	if err := config.DB.First(&order, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if !ownsOrder(w, user, &order) {
+		return
+	}
+	if order.OrderPaymentStatus != "Paid" {
+		http.Error(w, "Order has not been paid", http.StatusPaymentRequired)
+		return
+	}
+
+	deliveries, err := services.OrderDeliveries(config.DB, int(order.ID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// ownsOrder checks that an order was placed by user, answering 403 Forbidden if it was not.
+func ownsOrder(w http.ResponseWriter, user *models.User, order *models.Order) bool {
+	if order.UserID != user.ID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/models"
+)
+
+func TestGetOrderDownloadsNeedsAToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		authorization string
+	}{
+		{"no token", "/api/v1/orders/1/downloads", ""},
+		{"user_id is not enough", "/api/v1/orders/1/downloads?user_id=1", ""},
+		{"invalid token", "/api/v1/orders/1/downloads", "Bearer not-a-token"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", test.url, nil)
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			request = mux.SetURLVars(request, map[string]string{"id": "1"})
+			recorder := httptest.NewRecorder()
+			GetOrderDownloads(recorder, request)
+			if recorder.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestOwnsOrder(t *testing.T) {
+	order := &models.Order{UserID: 1}
+
+	tests := []struct {
+		name       string
+		user       *models.User
+		want       bool
+		wantStatus int
+	}{
+		{"the buyer", &models.User{ID: 1, Role: "customer"}, true, http.StatusOK},
+		{"another user", &models.User{ID: 2, Role: "customer"}, false, http.StatusForbidden},
+		{"an admin", &models.User{ID: 2, Role: "admin"}, false, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			if got := ownsOrder(recorder, test.user, order); got != test.want {
+				t.Errorf("ownsOrder() = %v, want %v", got, test.want)
+			}
+			if recorder.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, test.wantStatus)
+			}
+		})
+	}
+}
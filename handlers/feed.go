@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/services"
+)
+
+// GetFeed serves a generated product feed. The ETag changes only when the content of the feed does,
+// so channels polling with If-None-Match get 304 Not Modified until then.
+func GetFeed(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	path, err := services.FeedPath(name)
+	if err != nil {
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "Feed has not been generated yet", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The ETag is the hash of the content, so an unchanged feed keeps it across regenerations
+	etag, err := services.FeedETag(name)
+	if err != nil {
+		etag = fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), info.Size())
+	}
+
+	w.Header().Set("Content-Type", services.FeedContentTypes[name])
+	w.Header().Set("ETag", `"`+etag+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
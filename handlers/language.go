@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/services"
+)
+
+// requestLanguages resolves the language fallback chain of a request from ?lang=, the user's
+// preferred language and the Accept-Language header, narrowed to the languages with translations
+// so it can key caches. Handlers announce the language they served with setContentLanguage.
+func requestLanguages(w http.ResponseWriter, r *http.Request) []string {
+	userID, _ := strconv.Atoi(r.URL.Query().Get("user_id"))
+	languages := services.ResolveLanguages(config.DB, r.URL.Query().Get("lang"), r.Header.Get("Accept-Language"), userID)
+	w.Header().Add("Vary", "Accept-Language")
+	return services.TranslatedChain(config.DB, languages)
+}
+
+// languagesKey is the part of a cache key that keeps entries of different language chains apart
+func languagesKey(languages []string) string {
+	return strings.Join(languages, ",")
+}
+
+// setContentLanguage announces the languages the text of a response is in, e.g. "fr, en" for a listing
+// where some products have no French translation.
+func setContentLanguage(w http.ResponseWriter, languages ...string) {
+	var served []string
+	seen := make(map[string]bool)
+	for _, language := range languages {
+		if language != "" && !seen[language] {
+			seen[language] = true
+			served = append(served, language)
+		}
+	}
+	if len(served) == 0 {
+		served = []string{services.DefaultLanguage()}
+	}
+	w.Header().Set("Content-Language", strings.Join(served, ", "))
+}
+
+// productLanguages reads the languages of product JSON, either one product or a list.
+func productLanguages(data []byte) []string {
+	var products []struct {
+		Language string `json:"language"`
+	}
+	if len(data) > 0 && data[0] != '[' {
+		data = append(append([]byte{'['}, data...), ']')
+	}
+	if err := json.Unmarshal(data, &products); err != nil {
+		return nil
+	}
+	languages := make([]string, len(products))
+	for i, product := range products {
+		languages[i] = product.Language
+	}
+	return languages
+}
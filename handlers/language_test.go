@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProductLanguages(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"one product", `{"id":1,"language":"fr"}`, []string{"fr"}},
+		{"a list", `[{"language":"fr"},{"language":"en"}]`, []string{"fr", "en"}},
+		{"no language", `[{"id":1}]`, []string{""}},
+		{"not JSON", `oops`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := productLanguages([]byte(test.data)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("productLanguages(%s) = %v, want %v", test.data, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRelatedLanguages(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"related products", `[{"product":{"language":"de"},"score":2},{"product":{"language":"en"},"score":1}]`, []string{"de", "en"}},
+		{"none", `[]`, []string{}},
+		{"not JSON", `oops`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := relatedLanguages([]byte(test.data)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("relatedLanguages(%s) = %v, want %v", test.data, got, test.want)
+			}
+		})
+	}
+}
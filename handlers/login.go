@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/theinvincible/ecommerce-backend/config"
 	"github.com/theinvincible/ecommerce-backend/models"
@@ -73,10 +77,10 @@ func Login(w http.ResponseWriter, r *http.Request) {
 func RoleMiddleware(allowedRoles ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Get user from context or session (assuming JWT token-based auth)
-			user, ok := r.Context().Value("user").(*models.User)
-			if !ok {
-				http.Error(w, "Forbidden", http.StatusForbidden)
+			// Get user from context or from the JWT bearer token
+			user, err := requestUser(r)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
@@ -95,7 +99,43 @@ func RoleMiddleware(allowedRoles ...string) func(http.Handler) http.Handler {
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			// Let handlers know who is acting: vendors are users with the vendor role
+			ctx := context.WithValue(r.Context(), "user", user)
+			if user.Role == "vendor" {
+				ctx = context.WithValue(ctx, "vendorID", uint(user.ID))
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// requestUser returns the user making a request: the one already in the request context, or else the one
+// its bearer token was issued to.
+func requestUser(r *http.Request) (*models.User, error) {
+	if user, ok := r.Context().Value("user").(*models.User); ok {
+		return user, nil
+	}
+	return authenticatedUser(r)
+}
+
+// authenticatedUser loads the user a request's bearer token was issued to. The role comes from the
+// user record, so a role change applies to tokens already issued.
+func authenticatedUser(r *http.Request) (*models.User, error) {
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, errors.New("missing bearer token")
+	}
+	claims, err := utils.ValidateJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, errors.New("token has no user")
+	}
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/utils"
+)
+
+func TestRoleMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		roles         []string
+		user          *models.User
+		authorization string
+		want          int
+		wantActor     int
+		wantVendorID  uint
+	}{
+		{name: "no token", roles: []string{"admin"}, want: http.StatusUnauthorized},
+		{name: "invalid token", roles: []string{"admin"}, authorization: "Bearer not-a-token", want: http.StatusUnauthorized},
+		{name: "not a bearer token", roles: []string{"admin"}, authorization: "not-a-token", want: http.StatusUnauthorized},
+		{name: "wrong role", roles: []string{"admin"}, user: &models.User{ID: 3, Role: "customer"}, want: http.StatusForbidden},
+		{name: "admin", roles: []string{"admin"}, user: &models.User{ID: 3, Role: "admin"}, want: http.StatusOK, wantActor: 3},
+		{name: "vendor", roles: []string{"vendor"}, user: &models.User{ID: 9, Role: "vendor"}, want: http.StatusOK, wantActor: 9, wantVendorID: 9},
+		{name: "one of several roles", roles: []string{"vendor", "admin"}, user: &models.User{ID: 3, Role: "admin"}, want: http.StatusOK, wantActor: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var actor int
+			var vendorID uint
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				actor = utils.ActorID(r)
+				vendorID, _ = r.Context().Value("vendorID").(uint)
+			})
+
+			request := httptest.NewRequest("GET", "/", nil)
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			if test.user != nil {
+				request = request.WithContext(context.WithValue(request.Context(), "user", test.user))
+			}
+			recorder := httptest.NewRecorder()
+			RoleMiddleware(test.roles...)(next).ServeHTTP(recorder, request)
+
+			if recorder.Code != test.want {
+				t.Errorf("status = %d, want %d", recorder.Code, test.want)
+			}
+			if actor != test.wantActor || vendorID != test.wantVendorID {
+				t.Errorf("actor %d and vendor %d, want %d and %d", actor, vendorID, test.wantActor, test.wantVendorID)
+			}
+		})
+	}
+}
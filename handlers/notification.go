@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+)
+
+// GetNotifications returns the notifications of the user given by ?user_id=, newest first
+func GetNotifications(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID := queryUserID(r)
+	if userID == 0 {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	query := config.DB.Where("user_id = ?", userID)
+	if r.URL.Query().Get("unread") == "true" {
+		query = query.Where("is_read = ?", false)
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("created_at desc").Find(&notifications).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(notifications)
+}
+
+// MarkNotificationRead marks one of the user's notifications as read
+func MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var notification models.Notification
+	if err := config.DB.First(&notification, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	if notification.UserID != queryUserID(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if err := config.DB.Model(&notification).Update("is_read", true).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(notification)
+}
@@ -2,12 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/theinvincible/ecommerce-backend/config"
 	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
 	"gorm.io/gorm"
 )
 
@@ -100,7 +102,7 @@ func GetOrder(w http.ResponseWriter, r *http.Request) {
 
 	id := mux.Vars(r)["id"]
 	var order models.Order
-	if err := config.DB.First(&order, id).Error; err != nil {
+	if err := config.DB.Preload("OrderItems.Components").First(&order, id).Error; err != nil {
 		http.Error(w, "Order not found", http.StatusNotFound)
 		return
 	}
@@ -140,4 +142,10 @@ func DeleteOrder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// Give back the stock held for the order, which will not be paid now
+	if orderID, err := strconv.Atoi(id); err == nil {
+		if err := services.ReleaseOrderReservations(config.DB, orderID); err != nil {
+			log.Printf("Error releasing stock reservations for order %d: %v", orderID, err)
+		}
+	}
 }
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// maxPageLimit is the most items a page can hold; larger limits are lowered to it.
+const maxPageLimit = 100
+
+// parsePagination reads the page and limit query parameters, defaulting to page 1 with 10 items and
+// allowing at most maxPageLimit items.
+func parsePagination(r *http.Request) (int, int, error) {
+	page := 1
+	limit := 10
+
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		parsedPage, err := strconv.Atoi(pageStr)
+		if err != nil || parsedPage < 1 {
+			return 0, 0, errors.New("Invalid page number")
+		}
+		page = parsedPage
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit < 1 {
+			return 0, 0, errors.New("Invalid limit number")
+		}
+		limit = min(parsedLimit, maxPageLimit)
+	}
+
+	return page, limit, nil
+}
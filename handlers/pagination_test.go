@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantPage  int
+		wantLimit int
+		wantErr   bool
+	}{
+		{"", 1, 10, false},
+		{"page=3&limit=25", 3, 25, false},
+		{"limit=100", 1, 100, false},
+		{"limit=1000000", 1, maxPageLimit, false},
+		{"page=0", 0, 0, true},
+		{"page=x", 0, 0, true},
+		{"limit=0", 0, 0, true},
+		{"limit=-5", 0, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			page, limit, err := parsePagination(httptest.NewRequest("GET", "/?"+test.query, nil))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parsePagination(%q) error = %v, want error %v", test.query, err, test.wantErr)
+			}
+			if page != test.wantPage || limit != test.wantLimit {
+				t.Errorf("parsePagination(%q) = %d, %d, want %d, %d", test.query, page, limit, test.wantPage, test.wantLimit)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,7 +18,10 @@ import (
 	"github.com/stripe/stripe-go/charge"
 	"github.com/stripe/stripe-go/customer"
 	"github.com/stripe/stripe-go/sub"
+	"github.com/stripe/stripe-go/webhook"
+	"github.com/theinvincible/ecommerce-backend/config"
 	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
 )
 
 // This handles one-time payments using Stripe
@@ -32,12 +36,26 @@ func PaymentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The order decides what is charged, never the request
+	var order models.Order
+	if err := config.DB.First(&order, paymentRequest.OrderID).Error; err != nil {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if order.OrderPaymentStatus == "Paid" {
+		http.Error(w, "Order is already paid", http.StatusConflict)
+		return
+	}
+	amountInCents, currency, err := services.OrderCharge(config.DB, &order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	paymentRequest.Amount, paymentRequest.Currency = order.TotalAmount, currency
+
 	// Initialize Stripe with secret key
 	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
 
-	// Convert amount to cents
-	amountInCents := int64(paymentRequest.Amount * 100)
-
 	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
@@ -55,7 +73,7 @@ func PaymentHandler(w http.ResponseWriter, r *http.Request) {
 		// Create charge parameters
 		chargeParams := &stripe.ChargeParams{
 			Amount:      stripe.Int64(amountInCents),
-			Currency:    stripe.String("usd"),
+			Currency:    stripe.String(strings.ToLower(paymentRequest.Currency)),
 			Description: stripe.String("Charge for order " + strconv.Itoa(paymentRequest.OrderID)),
 		}
 
@@ -121,6 +139,18 @@ func PaymentHandler(w http.ResponseWriter, r *http.Request) {
 		paymentRequest.Status = ch.Status
 		paymentRequest.TransactionID = ch.ID
 
+		// Mark the order paid, commit its stock and deliver its digital items. A declined charge keeps the
+		// stock held so the customer can retry straight away; the reservation is released when Stripe reports
+		// the payment failed or canceled (see WebhookHandler), or when it expires.
+		if ch.Status == "succeeded" && ch.Paid {
+			if ch.Amount != amountInCents || !strings.EqualFold(string(ch.Currency), currency) {
+				log.Printf("Charge %s of %d %s does not match order %d (%d %s); not completing it",
+					ch.ID, ch.Amount, ch.Currency, order.ID, amountInCents, currency)
+			} else if err := services.CompleteOrderPayment(config.DB, int(order.ID)); err != nil {
+				log.Printf("Error completing payment for order %d: %v", order.ID, err)
+			}
+		}
+
 		// Respond with the charge details
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(ch)
@@ -200,10 +230,10 @@ func WebhookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	event := stripe.Event{}
-
-	if err := json.Unmarshal(payload, &event); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to parse webhook body json: %v\n", err.Error())
+	// Only act on events signed by Stripe with the endpoint's secret, so nobody can fake a payment
+	event, err := webhook.ConstructEvent(payload, r.Header.Get("Stripe-Signature"), os.Getenv("STRIPE_WEBHOOK_SECRET"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Rejected webhook event: %v\n", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -218,8 +248,40 @@ func WebhookHandler(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		// Then define and call a func to handle the successful payment intent.
-		// handlePaymentIntentSucceeded(paymentIntent)
+		if orderID, err := strconv.Atoi(paymentIntent.Metadata["order_id"]); err == nil {
+			var order models.Order
+			if err := config.DB.First(&order, orderID).Error; err != nil {
+				log.Printf("Payment intent %s is for unknown order %d", paymentIntent.ID, orderID)
+				break
+			}
+			amount, currency, err := services.OrderCharge(config.DB, &order)
+			if err != nil || paymentIntent.Amount != amount || !strings.EqualFold(string(paymentIntent.Currency), currency) {
+				log.Printf("Payment intent %s of %d %s does not match order %d; not completing it",
+					paymentIntent.ID, paymentIntent.Amount, paymentIntent.Currency, orderID)
+				break
+			}
+			if err := services.CompleteOrderPayment(config.DB, orderID); err != nil {
+				log.Printf("Error completing payment for order %d: %v", orderID, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+	case "payment_intent.payment_failed", "payment_intent.canceled":
+		var paymentIntent stripe.PaymentIntent
+		err := json.Unmarshal(event.Data.Raw, &paymentIntent)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing webhook JSON: %v\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// Give the held stock back; if the customer pays later, the order takes its stock again
+		if orderID, err := strconv.Atoi(paymentIntent.Metadata["order_id"]); err == nil {
+			if err := services.ReleaseOrderReservations(config.DB, orderID); err != nil {
+				log.Printf("Error releasing stock reservations for order %d: %v", orderID, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
 	case "payment_method.attached":
 		var paymentMethod stripe.PaymentMethod
 		err := json.Unmarshal(event.Data.Raw, &paymentMethod)
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/theinvincible/ecommerce-backend/services"
+)
+
+// viewerFromRequest identifies the shopper from the user_id query parameter or,
+// for anonymous shoppers, the X-Session-ID header.
+func viewerFromRequest(r *http.Request) (string, int) {
+	userID, _ := strconv.Atoi(r.URL.Query().Get("user_id"))
+	return services.ViewerKey(userID, r.Header.Get("X-Session-ID")), userID
+}
+
+// trackProductView records the view in the background when the shopper can be identified
+func trackProductView(r *http.Request, id string) {
+	viewer, _ := viewerFromRequest(r)
+	productID, err := strconv.Atoi(id)
+	if viewer == "" || err != nil {
+		return
+	}
+	services.TrackProductView(viewer, productID)
+}
+
+// GetRecentlyViewed returns the products the shopper viewed most recently, newest first
+func GetRecentlyViewed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	viewer, _ := viewerFromRequest(r)
+	if viewer == "" {
+		http.Error(w, "user_id or X-Session-ID is required", http.StatusBadRequest)
+		return
+	}
+
+	_, limit, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	products, err := services.RecentlyViewedProducts(viewer, limit)
+	if err != nil {
+		http.Error(w, "Error fetching recently viewed products", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(products)
+}
+
+// GetPersonalizedFeed returns products ranked by the shopper's viewed and purchased categories and brands
+func GetPersonalizedFeed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	viewer, userID := viewerFromRequest(r)
+
+	_, limit, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	feed, err := services.PersonalizedFeed(viewer, userID, limit)
+	if err != nil {
+		http.Error(w, "Error building feed", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(feed)
+}
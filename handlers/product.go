@@ -1,19 +1,21 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/go-redis/redis"
 	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/cache"
 	"github.com/theinvincible/ecommerce-backend/config"
 	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
 	"github.com/theinvincible/ecommerce-backend/utils"
 	"gorm.io/gorm"
 )
@@ -28,10 +30,30 @@ func CreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := config.DB.Create(&product).Error; err != nil {
+	if err := services.ValidateProductLifecycle(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := services.ValidatePricing(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+		if err := services.RecordPriceChange(tx, nil, &product, utils.ActorID(r), "create"); err != nil {
+			return err
+		}
+		return services.RecordStockChange(tx, nil, &product, utils.ActorID(r))
+	})
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	services.InvalidateProductCache(int(product.ID))
+	services.ApplyProductPricing(&product)
 
 	// Create the response map
 	response := map[string]interface{}{
@@ -66,6 +88,7 @@ func CreateProductHandler(ps ProductService) http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		services.InvalidateProductCache(int(product.ID))
 
 		response := map[string]interface{}{
 			"message": "Product created successfully",
@@ -83,9 +106,17 @@ type ProductServiceImpl struct {
 	DB *gorm.DB
 }
 
-// CreateProduct creates a new product in the database.
+// CreateProduct creates a new product in the database and records its initial price.
 func (ps *ProductServiceImpl) CreateProduct(product *models.Product) error {
-	return ps.DB.Create(product).Error
+	return ps.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+		if err := services.RecordPriceChange(tx, nil, product, 0, "create"); err != nil {
+			return err
+		}
+		return services.RecordStockChange(tx, nil, product, 0)
+	})
 }
 
 func GetProducts(w http.ResponseWriter, r *http.Request) {
@@ -100,6 +131,11 @@ func GetProducts(w http.ResponseWriter, r *http.Request) {
 	minPriceStr := r.URL.Query().Get("min_price")
 	maxPriceStr := r.URL.Query().Get("max_price")
 	search := r.URL.Query().Get("search")
+	tags, err := services.ParseTagNames(tagFilter(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Set default pagination values
 	page := 1
@@ -131,7 +167,6 @@ func GetProducts(w http.ResponseWriter, r *http.Request) {
 
 	// Parse price filters
 	var minPrice, maxPrice float64
-	var err error
 	if minPriceStr != "" {
 		minPrice, err = strconv.ParseFloat(minPriceStr, 64)
 		if err != nil {
@@ -147,26 +182,46 @@ func GetProducts(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Initialize Redis client
-	redisClient := utils.GetRedisClient()
-	cacheKey := fmt.Sprintf("products:%d:%d:%s:%s:%s:%s:%s:%s", page, limit, sortBy, order, category, minPriceStr, maxPriceStr, search)
+	// Resolve the presentment currency before touching the cache
+	currency := requestCurrency(r)
+	if _, err := services.NewConverter(config.DB, currency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Create context for Redis operations
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// Parse custom attribute filters such as attr.ram_gb>=16, defined by the category when one is given
+	categoryID := 0
+	if category != "" {
+		if categoryID, err = strconv.Atoi(category); err != nil {
+			http.Error(w, "Invalid category", http.StatusBadRequest)
+			return
+		}
+	}
+	attrFilters, err := services.ParseAttributeFilters(config.DB, r.URL.RawQuery, categoryID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// Step 1: Check Redis cache
-	cachedProducts, err := redisClient.Get(ctx, cacheKey).Result()
-	if err == redis.Nil {
-		// Step 2: Cache miss, fetch from database
+	// Names are searched and returned in the shopper's languages, so they are part of the cache key
+	languages := requestLanguages(w, r)
+	cacheKey := fmt.Sprintf("products:%d:%d:%s:%s:%s:%s:%s:%s:%s:%s:%s", page, limit, sortBy, order, category, minPriceStr, maxPriceStr, search, strings.Join(tags, ","), services.AttributeFiltersKey(attrFilters), languagesKey(languages))
+
+	// Listings are tagged with the category they are filtered by, or with every category
+	opts := cache.Options{TTL: 10 * time.Minute, Stale: time.Minute, Tags: []string{cache.CatalogTag, cache.AllCategoriesTag}}
+	if category != "" {
+		opts.Tags = []string{cache.CatalogTag, cache.CategoryTag(category)}
+	}
+
+	productsJSON, err := cache.Fetch(r.Context(), cacheKey, opts, func() ([]byte, []string, error) {
 		log.Println("Cache miss for products, fetching from database")
 
 		var products []models.Product
-		query := config.DB.Model(&models.Product{})
+		query := config.DB.Model(&models.Product{}).Scopes(services.PublishedProducts)
 
 		// Apply filters
 		if category != "" {
-			query = query.Where("category = ?", category)
+			query = query.Where("category_id = ?", categoryID)
 		}
 		if minPriceStr != "" {
 			query = query.Where("price >= ?", minPrice)
@@ -175,8 +230,10 @@ func GetProducts(w http.ResponseWriter, r *http.Request) {
 			query = query.Where("price <= ?", maxPrice)
 		}
 		if search != "" {
-			query = query.Where("name ILIKE ?", "%"+search+"%")
+			query = services.SearchProductNames(query, search, languages)
 		}
+		query = services.FilterByTags(query, tags)
+		query = services.ApplyAttributeFilters(query, attrFilters)
 
 		// Apply pagination and sorting
 		query = query.Offset((page - 1) * limit).Limit(limit)
@@ -188,149 +245,142 @@ func GetProducts(w http.ResponseWriter, r *http.Request) {
 
 		// Execute query and fetch products
 		if err := query.Find(&products).Error; err != nil {
-			log.Printf("Database error: %v", err)
-			http.Error(w, "Error fetching products", http.StatusInternalServerError)
-			return
+			return nil, nil, fmt.Errorf("fetching products: %w", err)
 		}
-
-		// Step 3: Cache the result in Redis
-		productsJSON, err := json.Marshal(products)
-		if err == nil {
-			redisClient.Set(ctx, cacheKey, productsJSON, 10*time.Minute)
-		} else {
-			log.Printf("Error marshalling products: %v", err)
+		if err := services.ApplyPricing(products); err != nil {
+			return nil, nil, fmt.Errorf("pricing products: %w", err)
+		}
+		if err := services.ApplyBundleAvailability(config.DB, products); err != nil {
+			return nil, nil, fmt.Errorf("computing bundle stock: %w", err)
+		}
+		if err := services.ApplyProductTags(config.DB, products); err != nil {
+			return nil, nil, fmt.Errorf("loading product tags: %w", err)
+		}
+		if err := services.LocaliseProducts(config.DB, products, languages); err != nil {
+			return nil, nil, fmt.Errorf("localising products: %w", err)
 		}
 
-		// Step 4: Return the result from the database
-		w.Write(productsJSON)
-
-	} else if err != nil {
-		// Redis error, fallback to database
-		log.Printf("Redis error: %v, falling back to database", err)
-		// Continue to database fetch if Redis fails
-	} else {
-		// Step 5: Cache hit, return cached products
-		log.Println("Cache hit, returning cached products")
-		w.Write([]byte(cachedProducts))
+		// Tag the listing with every product it contains
+		productTags := make([]string, len(products))
+		for i, product := range products {
+			productTags[i] = cache.ProductTag(int(product.ID))
+		}
+		productsJSON, err := json.Marshal(products)
+		return productsJSON, productTags, err
+	})
+	if err != nil {
+		log.Printf("Error loading products: %v", err)
+		http.Error(w, "Error fetching products", http.StatusInternalServerError)
 		return
 	}
 
-	// Fallback to database if Redis fails
-	var products []models.Product
-	query := config.DB.Model(&models.Product{})
-
-	// Apply filters again
-	if category != "" {
-		query = query.Where("category = ?", category)
-	}
-	if minPriceStr != "" {
-		query = query.Where("price >= ?", minPrice)
-	}
-	if maxPriceStr != "" {
-		query = query.Where("price <= ?", maxPrice)
-	}
-	if search != "" {
-		query = query.Where("name ILIKE ?", "%"+search+"%")
-	}
+	writeCatalogJSON(w, currency, productsJSON)
+}
 
-	// Apply pagination and sorting
-	query = query.Offset((page - 1) * limit).Limit(limit)
-	if strings.ToLower(order) == "desc" {
-		query = query.Order(sortBy + " desc")
-	} else {
-		query = query.Order(sortBy + " asc")
+// tagFilter reads the tags products are filtered by, given as ?tag=a&tag=b or ?tag=a,b
+func tagFilter(r *http.Request) []string {
+	var tags []string
+	for _, value := range r.URL.Query()["tag"] {
+		for _, tag := range strings.Split(value, ",") {
+			if strings.TrimSpace(tag) != "" {
+				tags = append(tags, tag)
+			}
+		}
 	}
+	return tags
+}
 
-	// Execute the database query
-	if err := query.Find(&products).Error; err != nil {
-		log.Printf("Database error: %v", err)
-		http.Error(w, "Error fetching products", http.StatusInternalServerError)
-		return
-	}
+// GetProductByID returns a published product by ID
+func GetProductByID(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	// Return products from database
-	productsJSON, err := json.Marshal(products)
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		log.Printf("Error marshalling products: %v", err)
-		http.Error(w, "Error preparing products data", http.StatusInternalServerError)
+		http.Error(w, "Product not found", http.StatusNotFound)
 		return
 	}
 
-	w.Write(productsJSON)
+	writeProduct(w, r, productID)
 }
 
-// GetProductByID returns a product by ID
-func GetProductByID(w http.ResponseWriter, r *http.Request) {
+// GetProductBySlug returns a published product by slug. Old slugs are redirected to the current one
+// with 301 so links keep working after a rename.
+func GetProductBySlug(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	id := mux.Vars(r)["id"]
-	cacheKey := "product:" + id
+	productID, slug, redirect, err := services.ResolveSlug(config.DB, models.SlugEntityProduct, mux.Vars(r)["slug"])
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if redirect {
+		redirectToSlug(w, r, "/api/v1/products/slug/", slug)
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"canonical\"", services.CanonicalURL(models.SlugEntityProduct, slug)))
+	writeProduct(w, r, productID)
+}
 
-	// Use the initialized Redis client
-	redisClient := utils.GetRedisClient()
+// redirectToSlug permanently redirects to the current slug, keeping the query string
+func redirectToSlug(w http.ResponseWriter, r *http.Request, prefix, slug string) {
+	target := prefix + url.PathEscape(slug)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
 
-	// Try to get the product from Redis cache
-	cachedProduct, err := redisClient.Get(ctx, cacheKey).Result()
-	if err == redis.Nil {
-		// Cache miss, query the database
-		log.Printf("Cache miss for product ID: %s", id)
+// writeProduct writes a published product in the request's currency and languages, from the cache when possible
+func writeProduct(w http.ResponseWriter, r *http.Request, productID int) {
+	currency := requestCurrency(r)
+	if _, err := services.NewConverter(config.DB, currency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	languages := requestLanguages(w, r)
+	opts := cache.Options{TTL: 10 * time.Minute, Stale: time.Minute, Tags: []string{cache.CatalogTag, cache.ProductTag(productID)}}
+	productJSON, err := cache.Fetch(r.Context(), fmt.Sprintf("product:%d:%s", productID, languagesKey(languages)), opts, func() ([]byte, []string, error) {
+		log.Printf("Cache miss for product ID: %d", productID)
 
 		var product models.Product
-		// Fetch the product from the database
-		if err := config.DB.Where("id = ?", id).First(&product).Error; err != nil {
-			log.Printf("Database error while fetching product with ID %s: %v", id, err)
-			http.Error(w, "Product not found", http.StatusNotFound)
-			return
+		if err := config.DB.Scopes(services.PublishedProducts).Where("id = ?", productID).First(&product).Error; err != nil {
+			return nil, nil, err
 		}
-
-		// Marshal the product into JSON format
-		productJSON, err := json.Marshal(product)
-		if err != nil {
-			log.Printf("Error marshalling product ID %s: %v", id, err)
-			http.Error(w, "Error marshalling product data", http.StatusInternalServerError)
-			return
+		if err := services.ApplyProductPricing(&product); err != nil {
+			return nil, nil, fmt.Errorf("pricing product: %w", err)
 		}
-
-		// Cache the result in Redis for future requests (non-critical)
-		if err := redisClient.Set(ctx, cacheKey, productJSON, 10*time.Minute).Err(); err != nil {
-			// Log the error but do not return an error to the client
-			log.Printf("Error caching product ID %s: %v", id, err)
+		if err := services.ApplyProductBundleAvailability(config.DB, &product); err != nil {
+			return nil, nil, fmt.Errorf("computing bundle stock: %w", err)
+		}
+		products := []models.Product{product}
+		if err := services.ApplyProductTags(config.DB, products); err != nil {
+			return nil, nil, fmt.Errorf("loading product tags: %w", err)
+		}
+		if err := services.LocaliseProducts(config.DB, products, languages); err != nil {
+			return nil, nil, fmt.Errorf("localising product: %w", err)
 		}
 
-		// Return the product data from the database
-		w.Write(productJSON)
-		return
-	} else if err != nil {
-		// Redis is down or some error happened, just log and proceed to the database
-		log.Printf("Redis is unavailable or other issue, querying database for product ID: %s", id)
-	} else {
-		// Cache hit, return cached product
-		log.Printf("Returning cached product data for ID: %s", id)
-		w.Write([]byte(cachedProduct))
-		return
-	}
-
-	// If Redis fails, query the database and proceed
-	var product models.Product
-	if err := config.DB.Where("id = ?", id).First(&product).Error; err != nil {
-		log.Printf("Database error while fetching product with ID %s: %v", id, err)
+		productJSON, err := json.Marshal(products[0])
+		return productJSON, nil, err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		http.Error(w, "Product not found", http.StatusNotFound)
 		return
 	}
-
-	// Marshal the product into JSON
-	productJSON, err := json.Marshal(product)
 	if err != nil {
-		log.Printf("Error marshalling product ID %s: %v", id, err)
-		http.Error(w, "Error marshalling product data", http.StatusInternalServerError)
+		log.Printf("Error loading product ID %d: %v", productID, err)
+		http.Error(w, "Error fetching product", http.StatusInternalServerError)
 		return
 	}
 
-	// Return the product data from the database
-	w.Write(productJSON)
+	trackProductView(r, strconv.Itoa(productID))
+	writeCatalogJSON(w, currency, productJSON)
 }
 
 // UpdateProduct updates a product by ID
@@ -343,16 +393,48 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Product not found", http.StatusNotFound)
 		return
 	}
+	previous := product
 
 	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := config.DB.Save(&product).Error; err != nil {
+	if err := services.ValidateProductLifecycle(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := services.ValidatePricing(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := services.ReconcileSlug(tx, models.SlugEntityProduct, int(product.ID), previous.Slug, &product.Slug); err != nil {
+			return err
+		}
+		if err := tx.Save(&product).Error; err != nil {
+			return err
+		}
+		if err := services.RecordPriceChange(tx, &previous, &product, utils.ActorID(r), "update"); err != nil {
+			return err
+		}
+		return services.RecordStockChange(tx, &previous, &product, utils.ActorID(r))
+	})
+	if errors.Is(err, services.ErrSlugTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	services.InvalidateProductCache(int(product.ID))
+	if previous.CategoryID != product.CategoryID {
+		services.InvalidateCategoryCache(previous.CategoryID)
+	}
+	services.NotifyIfRestocked(&previous, &product)
+	services.ApplyProductPricing(&product)
 
 	json.NewEncoder(w).Encode(product)
 }
@@ -366,6 +448,9 @@ func DeleteProduct(w http.ResponseWriter, r *http.Request, db *gorm.DB) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if productID, err := strconv.Atoi(id); err == nil {
+		services.InvalidateProductCache(productID)
+	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Product deleted"})
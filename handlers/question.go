@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
+	"gorm.io/gorm"
+)
+
+// QARequest is the body for asking, answering and upvoting
+type QARequest struct {
+	UserID int    `json:"user_id"`
+	Body   string `json:"body"`
+}
+
+var questionSortOptions = map[string]string{
+	"votes":  "upvote_count desc, created_at desc",
+	"newest": "created_at desc",
+	"oldest": "created_at asc",
+}
+
+// AskQuestion lets a customer ask a question about a product
+func AskQuestion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req QARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	question, err := services.AskQuestion(config.DB, productID, req.UserID, req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(question)
+}
+
+// GetProductQuestions returns the published questions of a product with their published answers, paginated
+func GetProductQuestions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	page, limit, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orderClause, valid := questionSortOptions[r.URL.Query().Get("sort_by")]
+	if !valid {
+		orderClause = questionSortOptions["votes"]
+	}
+
+	var total int64
+	query := config.DB.Model(&models.ProductQuestion{}).Where("product_id = ? AND status = ?", productID, models.QAStatusApproved)
+	if r.URL.Query().Get("answered") == "true" {
+		query = query.Where("EXISTS (SELECT 1 FROM product_answers WHERE product_answers.question_id = product_questions.id AND product_answers.status = ? AND product_answers.deleted_at IS NULL)", models.QAStatusApproved)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var questions []models.ProductQuestion
+	err = query.Preload("Answers", func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ?", models.QAStatusApproved).Order("upvote_count desc, created_at asc")
+	}).Order(orderClause).Offset((page - 1) * limit).Limit(limit).Find(&questions).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"questions": questions,
+		"page":      page,
+		"limit":     limit,
+		"total":     total,
+	})
+}
+
+// AnswerQuestion lets the product's vendor or an admin answer a question
+func AnswerQuestion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var question models.ProductQuestion
+	if err := config.DB.First(&question, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Question not found", http.StatusNotFound)
+		return
+	}
+	if question.Status == models.QAStatusRejected {
+		http.Error(w, "Question was rejected", http.StatusBadRequest)
+		return
+	}
+
+	var req QARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	answer, err := services.AnswerQuestion(config.DB, &question, user, req.Body)
+	if errors.Is(err, services.ErrNotProductVendor) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(answer)
+}
+
+// UpvoteQuestion adds the user's upvote to a question
+func UpvoteQuestion(w http.ResponseWriter, r *http.Request) {
+	upvoteQA(w, r, models.QAVoteQuestion)
+}
+
+// UpvoteAnswer adds the user's upvote to an answer
+func UpvoteAnswer(w http.ResponseWriter, r *http.Request) {
+	upvoteQA(w, r, models.QAVoteAnswer)
+}
+
+func upvoteQA(w http.ResponseWriter, r *http.Request, targetType string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	targetID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var req QARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.UserID == 0 {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	count, err := services.UpvoteQA(config.DB, targetType, targetID, req.UserID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	case errors.Is(err, services.ErrAlreadyUpvoted):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, services.ErrOwnContent):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int{"upvote_count": count})
+}
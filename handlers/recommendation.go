@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/cache"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
+	"gorm.io/gorm"
+)
+
+// GetRelatedProducts returns "frequently bought together" suggestions for a product
+func GetRelatedProducts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	limit := 8
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit < 1 || parsedLimit > 50 {
+			http.Error(w, "Invalid limit number", http.StatusBadRequest)
+			return
+		}
+		limit = parsedLimit
+	}
+
+	productID, err := strconv.Atoi(id)
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	currency := requestCurrency(r)
+	languages := requestLanguages(w, r)
+
+	// Tagged with every related product so their stock and price changes invalidate it, and with the
+	// recommendations tag so re-mined affinities do
+	opts := cache.Options{
+		TTL:   30 * time.Minute,
+		Stale: 5 * time.Minute,
+		Tags:  []string{cache.CatalogTag, cache.RecommendationsTag, cache.ProductTag(productID)},
+	}
+	relatedJSON, err := cache.Fetch(r.Context(), fmt.Sprintf("related:%d:%d:%s", productID, limit, languagesKey(languages)), opts, func() ([]byte, []string, error) {
+		var product models.Product
+		if err := config.DB.Scopes(services.PublishedProducts).First(&product, productID).Error; err != nil {
+			return nil, nil, err
+		}
+
+		related, err := services.RelatedProducts(product, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		products := make([]models.Product, len(related))
+		for i, entry := range related {
+			products[i] = entry.Product
+		}
+		if err := services.LocaliseProducts(config.DB, products, languages); err != nil {
+			return nil, nil, err
+		}
+		for i := range related {
+			related[i].Product = products[i]
+		}
+		relatedJSON, err := json.Marshal(related)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		relatedTags := make([]string, len(related))
+		for i, entry := range related {
+			relatedTags[i] = cache.ProductTag(int(entry.Product.ID))
+		}
+		return relatedJSON, relatedTags, nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error computing related products for product ID %s: %v", id, err)
+		http.Error(w, "Error fetching related products", http.StatusInternalServerError)
+		return
+	}
+
+	presented, err := presentRelatedJSON(currency, relatedJSON)
+	if err != nil {
+		http.Error(w, "Error preparing products data", http.StatusInternalServerError)
+		return
+	}
+	setContentLanguage(w, relatedLanguages(relatedJSON)...)
+	w.Write(presented)
+}
+
+// relatedLanguages reads the languages of the products in related product JSON.
+func relatedLanguages(data []byte) []string {
+	var related []struct {
+		Product struct {
+			Language string `json:"language"`
+		} `json:"product"`
+	}
+	if err := json.Unmarshal(data, &related); err != nil {
+		return nil
+	}
+	languages := make([]string, len(related))
+	for i, entry := range related {
+		languages[i] = entry.Product.Language
+	}
+	return languages
+}
+
+// presentRelatedJSON re-renders cached base-currency related products in another currency, as
+// presentCatalogJSON does for product lists.
+func presentRelatedJSON(currency string, data []byte) ([]byte, error) {
+	if currency == services.BaseCurrency() {
+		return data, nil
+	}
+
+	var related []services.RelatedProduct
+	if err := json.Unmarshal(data, &related); err != nil {
+		return nil, err
+	}
+	products := make([]models.Product, len(related))
+	for i, entry := range related {
+		products[i] = entry.Product
+	}
+	if err := services.PresentProducts(config.DB, products, currency); err != nil {
+		return nil, err
+	}
+	for i := range related {
+		related[i].Product = products[i]
+	}
+	return json.Marshal(related)
+}
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
+	"gorm.io/gorm"
+)
+
+// Allowed review sort options mapped to their ORDER BY clauses
+var reviewSortOptions = map[string]string{
+	"newest":      "created_at desc",
+	"oldest":      "created_at asc",
+	"rating_high": "rating desc, created_at desc",
+	"rating_low":  "rating asc, created_at desc",
+}
+
+// validateReviewRequest checks the fields shared by review creation and editing.
+func validateReviewRequest(req *models.ReviewRequest) error {
+	if req.UserID == 0 {
+		return errors.New("user_id is required")
+	}
+	if req.Rating < 1 || req.Rating > 5 {
+		return errors.New("rating must be between 1 and 5")
+	}
+	if strings.TrimSpace(req.Comment) == "" {
+		return errors.New("comment is required")
+	}
+	return nil
+}
+
+// CreateReview adds a review for a product. Each user may review a product only once.
+func CreateReview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateReviewRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var product models.Product
+	if err := config.DB.First(&product, productID).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var existing models.Review
+	if err := config.DB.Where("product_id = ? AND user_id = ?", productID, req.UserID).First(&existing).Error; err == nil {
+		http.Error(w, "You have already reviewed this product", http.StatusConflict)
+		return
+	}
+
+	verified, err := services.IsVerifiedPurchase(config.DB, req.UserID, productID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status, reason := services.ModerateReviewContent(req.Comment)
+	review := models.Review{
+		ProductID:        productID,
+		UserID:           req.UserID,
+		Rating:           req.Rating,
+		Comment:          req.Comment,
+		VerifiedPurchase: verified,
+		Status:           status,
+		ModerationReason: reason,
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		return services.RecalculateProductRating(tx, productID)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	services.InvalidateProductCache(productID)
+
+	message := "Review created successfully"
+	if review.Status == models.ReviewStatusPending {
+		message = "Review submitted and awaiting moderation"
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": message,
+		"review":  review,
+	})
+}
+
+// GetProductReviews lists a product's approved reviews with sorting and pagination.
+// Passing verified=true restricts the list to verified purchases.
+func GetProductReviews(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	page, limit, err := parsePagination(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sortBy := r.URL.Query().Get("sort_by")
+	orderClause, valid := reviewSortOptions[sortBy]
+	if !valid {
+		orderClause = reviewSortOptions["newest"] // Default to newest first if invalid
+	}
+
+	var total int64
+	query := config.DB.Model(&models.Review{}).Where("product_id = ? AND status = ?", productID, models.ReviewStatusApproved)
+	if r.URL.Query().Get("verified") == "true" {
+		query = query.Where("verified_purchase = ?", true)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var reviews []models.Review
+	if err := query.Order(orderClause).Offset((page - 1) * limit).Limit(limit).Find(&reviews).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reviews": reviews,
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+	})
+}
+
+// GetProductRatingSummary returns the rating aggregates and the star distribution histogram of a product
+func GetProductRatingSummary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var product models.Product
+	if err := config.DB.First(&product, productID).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	distribution, err := services.RatingDistribution(config.DB, productID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"product_id":        productID,
+		"average_rating":    product.AverageRating,
+		"number_of_ratings": product.NumberOfRatings,
+		"distribution":      distribution,
+	})
+}
+
+// UpdateReview edits the rating and comment of a review. Only the author may edit it.
+// The edited comment goes through moderation again, and a review that was not approved
+// goes back to the moderation queue. Its reports are kept.
+func UpdateReview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	var review models.Review
+	if err := config.DB.First(&review, id).Error; err != nil {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+
+	var req models.ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateReviewRequest(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.UserID != review.UserID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	review.Rating = req.Rating
+	review.Comment = req.Comment
+	status, reason := services.ModerateReviewContent(req.Comment)
+	if status == models.ReviewStatusApproved && review.Status != models.ReviewStatusApproved {
+		// A rejected or reported review waits for a moderator however clean the edit is
+		status, reason = models.ReviewStatusPending, review.ModerationReason
+	}
+	review.Status, review.ModerationReason = status, reason
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&review).Error; err != nil {
+			return err
+		}
+		return services.RecalculateProductRating(tx, review.ProductID)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	services.InvalidateProductCache(review.ProductID)
+
+	json.NewEncoder(w).Encode(review)
+}
+
+// DeleteReview removes a review. The author is identified by the user_id query parameter.
+func DeleteReview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	var review models.Review
+	if err := config.DB.First(&review, id).Error; err != nil {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil || userID != review.UserID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("review_id = ?", review.ID).Delete(&models.ReviewReport{}).Error; err != nil {
+			return err
+		}
+		// Hard delete so the author can review the product again and the unique index stays satisfied
+		if err := tx.Unscoped().Delete(&review).Error; err != nil {
+			return err
+		}
+		return services.RecalculateProductRating(tx, review.ProductID)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	services.InvalidateProductCache(review.ProductID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Review deleted"})
+}
+
+// ReportReview lets a customer flag a review as abusive. Once a review collects enough reports
+// it is taken down and returned to the moderation queue.
+func ReportReview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := mux.Vars(r)["id"]
+	var review models.Review
+	if err := config.DB.First(&review, id).Error; err != nil {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+
+	var report models.ReviewReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if report.UserID == 0 {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(report.Reason) == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+	if report.UserID == review.UserID {
+		http.Error(w, "You cannot report your own review", http.StatusBadRequest)
+		return
+	}
+
+	var existing models.ReviewReport
+	if err := config.DB.Where("review_id = ? AND user_id = ?", review.ID, report.UserID).First(&existing).Error; err == nil {
+		http.Error(w, "You have already reported this review", http.StatusConflict)
+		return
+	}
+
+	report.ReviewID = int(review.ID)
+	heldForModeration := false
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&report).Error; err != nil {
+			return err
+		}
+
+		review.ReportCount++
+		updates := map[string]interface{}{"report_count": review.ReportCount}
+		if review.Status == models.ReviewStatusApproved && review.ReportCount >= services.ReviewReportThreshold() {
+			heldForModeration = true
+			updates["status"] = models.ReviewStatusPending
+			updates["moderation_reason"] = "reported by customers"
+		}
+
+		if err := tx.Model(&review).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+		if heldForModeration {
+			return services.RecalculateProductRating(tx, review.ProductID)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if heldForModeration {
+		services.InvalidateProductCache(review.ProductID)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Review reported"})
+}
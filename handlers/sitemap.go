@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/cache"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/services"
+)
+
+// sitemapCacheOptions caches sitemaps until the catalog changes, refreshing at least hourly.
+var sitemapCacheOptions = cache.Options{TTL: time.Hour, Stale: 10 * time.Minute, Tags: []string{cache.CatalogTag, cache.AllCategoriesTag}}
+
+// GetSitemap serves /sitemap.xml, a sitemap index once the catalog outgrows one sitemap page
+func GetSitemap(w http.ResponseWriter, r *http.Request) {
+	sitemap, err := cache.Fetch(r.Context(), "sitemap", sitemapCacheOptions, func() ([]byte, []string, error) {
+		sitemap, err := services.BuildSitemap(config.DB)
+		return sitemap, nil, err
+	})
+	if err != nil {
+		log.Printf("Error building sitemap: %v", err)
+		http.Error(w, "Error building sitemap", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write(sitemap)
+}
+
+// GetSitemapPage serves one page of the products or categories sitemap listed in the sitemap index
+func GetSitemapPage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	kind := vars["kind"]
+	page, err := strconv.Atoi(vars["page"])
+	if err != nil {
+		http.Error(w, "Sitemap not found", http.StatusNotFound)
+		return
+	}
+
+	sitemap, err := cache.Fetch(r.Context(), fmt.Sprintf("sitemap:%s:%d", kind, page), sitemapCacheOptions, func() ([]byte, []string, error) {
+		sitemap, err := services.BuildSitemapPage(config.DB, kind, page)
+		return sitemap, nil, err
+	})
+	if errors.Is(err, services.ErrSitemapPageNotFound) {
+		http.Error(w, "Sitemap not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error building %s sitemap page %d: %v", kind, page, err)
+		http.Error(w, "Error building sitemap", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write(sitemap)
+}
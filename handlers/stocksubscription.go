@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
+)
+
+// StockSubscriptionRequest is the body of a "notify me" request. Guests give only an email.
+type StockSubscriptionRequest struct {
+	UserID *int   `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+// SubscribeBackInStock asks to be notified when an out-of-stock product is available again
+func SubscribeBackInStock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req StockSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.UserID == nil && req.Email == "" {
+		http.Error(w, "user_id or email is required", http.StatusBadRequest)
+		return
+	}
+
+	subscription, err := services.SubscribeBackInStock(config.DB, productID, req.UserID, req.Email)
+	if errors.Is(err, services.ErrProductInStock) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// unsubscribePage asks to confirm an unsubscribe, so link scanners and prefetchers following the
+// email link with GET do not cancel the subscription.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body>
+<p>Stop emailing {{.Email}} when {{.Product}} is back in stock?</p>
+<form method="post" action="{{.Action}}"><button type="submit">Unsubscribe</button></form>
+</body>
+</html>
+`))
+
+// ConfirmUnsubscribeBackInStock shows the page the unsubscribe link in the email opens
+func ConfirmUnsubscribeBackInStock(w http.ResponseWriter, r *http.Request) {
+	var subscription models.StockSubscription
+	if err := config.DB.Where("token = ?", mux.Vars(r)["token"]).First(&subscription).Error; err != nil {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+	var product models.Product
+	config.DB.Unscoped().Select("id", "name").First(&product, subscription.ProductID)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	unsubscribePage.Execute(w, map[string]string{
+		"Email":   subscription.Email,
+		"Product": product.Name,
+		"Action":  r.URL.Path,
+	})
+}
+
+// UnsubscribeBackInStock cancels a subscription through the token sent in its email
+func UnsubscribeBackInStock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	result := config.DB.Unscoped().Where("token = ?", mux.Vars(r)["token"]).Delete(&models.StockSubscription{})
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Subscription not found", http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Unsubscribed"})
+}
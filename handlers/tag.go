@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/cache"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/services"
+	"gorm.io/gorm"
+)
+
+// queryLimit reads ?limit= between 1 and max, defaulting to fallback
+func queryLimit(r *http.Request, fallback, max int) (int, error) {
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr == "" {
+		return fallback, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 || limit > max {
+		return 0, errors.New("Invalid limit number")
+	}
+	return limit, nil
+}
+
+// GetTagCloud returns the tags of published products with their product and blog post counts,
+// optionally for one ?category_id=
+func GetTagCloud(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit, err := queryLimit(r, 50, 200)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	categoryID := 0
+	if categoryStr := r.URL.Query().Get("category_id"); categoryStr != "" {
+		if categoryID, err = strconv.Atoi(categoryStr); err != nil {
+			http.Error(w, "Invalid category ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	opts := cache.Options{TTL: 10 * time.Minute, Stale: time.Minute, Tags: []string{cache.CatalogTag, cache.AllCategoriesTag}}
+	cloudJSON, err := cache.Fetch(r.Context(), fmt.Sprintf("tags:%d:%d", categoryID, limit), opts, func() ([]byte, []string, error) {
+		cloud, err := services.TagCloud(config.DB, categoryID, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		cloudJSON, err := json.Marshal(cloud)
+		return cloudJSON, nil, err
+	})
+	if err != nil {
+		log.Printf("Error loading tag cloud: %v", err)
+		http.Error(w, "Error fetching tags", http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(cloudJSON)
+}
+
+// GetBlogPostProducts returns published products sharing tags with a blog post
+func GetBlogPostProducts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Blog post not found", http.StatusNotFound)
+		return
+	}
+	limit, err := queryLimit(r, 8, 50)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	currency := requestCurrency(r)
+	if _, err := services.NewConverter(config.DB, currency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	languages := requestLanguages(w, r)
+
+	opts := cache.Options{TTL: 10 * time.Minute, Stale: time.Minute, Tags: []string{cache.CatalogTag, cache.AllCategoriesTag}}
+	productsJSON, err := cache.Fetch(r.Context(), fmt.Sprintf("blogpost-products:%d:%d:%s", postID, limit, languagesKey(languages)), opts, func() ([]byte, []string, error) {
+		products, err := services.BlogPostProducts(config.DB, postID, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := services.ApplyPricing(products); err != nil {
+			return nil, nil, fmt.Errorf("pricing products: %w", err)
+		}
+		if err := services.ApplyBundleAvailability(config.DB, products); err != nil {
+			return nil, nil, fmt.Errorf("computing bundle stock: %w", err)
+		}
+		if err := services.ApplyProductTags(config.DB, products); err != nil {
+			return nil, nil, fmt.Errorf("loading product tags: %w", err)
+		}
+		if err := services.LocaliseProducts(config.DB, products, languages); err != nil {
+			return nil, nil, fmt.Errorf("localising products: %w", err)
+		}
+		productsJSON, err := json.Marshal(products)
+		return productsJSON, nil, err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Blog post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading products of blog post %d: %v", postID, err)
+		http.Error(w, "Error fetching products", http.StatusInternalServerError)
+		return
+	}
+
+	writeCatalogJSON(w, currency, productsJSON)
+}
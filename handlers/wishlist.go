@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
+	"gorm.io/gorm"
+)
+
+// WishlistRequest is the body for creating and updating wishlists
+type WishlistRequest struct {
+	UserID   int    `json:"user_id"`
+	Name     string `json:"name"`
+	IsPublic bool   `json:"is_public"`
+}
+
+// WishlistItemRequest is the body for adding a product to a wishlist or moving it to the cart
+type WishlistItemRequest struct {
+	UserID    int `json:"user_id"`
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// ownedWishlist loads the wishlist in the URL and checks that it belongs to userID.
+// It writes the error response itself and returns false when the request should stop.
+func ownedWishlist(w http.ResponseWriter, r *http.Request, userID int) (*models.Wishlist, bool) {
+	var wishlist models.Wishlist
+	if err := config.DB.First(&wishlist, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Wishlist not found", http.StatusNotFound)
+		return nil, false
+	}
+	if wishlist.UserID != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return &wishlist, true
+}
+
+// queryUserID reads the user_id query parameter, returning 0 when it is missing or invalid
+func queryUserID(r *http.Request) int {
+	userID, _ := strconv.Atoi(r.URL.Query().Get("user_id"))
+	return userID
+}
+
+// loadWishlistItems fills in the items of a wishlist with their currently priced products
+func loadWishlistItems(wishlist *models.Wishlist) error {
+	if err := config.DB.Preload("Product").Where("wishlist_id = ?", wishlist.ID).Order("id").Find(&wishlist.Items).Error; err != nil {
+		return err
+	}
+
+	products := make([]models.Product, len(wishlist.Items))
+	for i, item := range wishlist.Items {
+		products[i] = item.Product
+	}
+	if err := services.ApplyPricing(products); err != nil {
+		return err
+	}
+	for i := range wishlist.Items {
+		wishlist.Items[i].Product = products[i]
+	}
+	return nil
+}
+
+// CreateWishlist creates a named wishlist for a user
+func CreateWishlist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req WishlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.UserID == 0 || req.Name == "" {
+		http.Error(w, "user_id and name are required", http.StatusBadRequest)
+		return
+	}
+
+	wishlist := models.Wishlist{UserID: req.UserID, Name: req.Name}
+	if err := services.SetWishlistVisibility(&wishlist, req.IsPublic); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := config.DB.Create(&wishlist).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(wishlist)
+}
+
+// GetWishlists returns the wishlists of the user given by ?user_id=
+func GetWishlists(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID := queryUserID(r)
+	if userID == 0 {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+
+	var wishlists []models.Wishlist
+	if err := config.DB.Preload("Items").Where("user_id = ?", userID).Order("id").Find(&wishlists).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(wishlists)
+}
+
+// GetWishlist returns one of the user's wishlists with its products
+func GetWishlist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	wishlist, ok := ownedWishlist(w, r, queryUserID(r))
+	if !ok {
+		return
+	}
+	if err := loadWishlistItems(wishlist); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(wishlist)
+}
+
+// GetSharedWishlist returns a public wishlist by its share token
+func GetSharedWishlist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var wishlist models.Wishlist
+	if err := config.DB.Where("share_token = ? AND is_public = ?", mux.Vars(r)["token"], true).First(&wishlist).Error; err != nil {
+		http.Error(w, "Wishlist not found", http.StatusNotFound)
+		return
+	}
+	if err := loadWishlistItems(&wishlist); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":  wishlist.Name,
+		"items": wishlist.Items,
+	})
+}
+
+// UpdateWishlist renames a wishlist and turns its public share link on or off
+func UpdateWishlist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req WishlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wishlist, ok := ownedWishlist(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	if name := strings.TrimSpace(req.Name); name != "" {
+		wishlist.Name = name
+	}
+	if err := services.SetWishlistVisibility(wishlist, req.IsPublic); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := config.DB.Save(wishlist).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(wishlist)
+}
+
+// DeleteWishlist deletes a wishlist and its items
+func DeleteWishlist(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	wishlist, ok := ownedWishlist(w, r, queryUserID(r))
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("wishlist_id = ?", wishlist.ID).Delete(&models.WishlistItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(wishlist).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Wishlist deleted"})
+}
+
+// AddWishlistItem adds a product to a wishlist
+func AddWishlistItem(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req WishlistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wishlist, ok := ownedWishlist(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	item, err := services.AddToWishlist(config.DB, wishlist, req.ProductID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(item)
+}
+
+// RemoveWishlistItem removes a product from a wishlist
+func RemoveWishlistItem(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	wishlist, ok := ownedWishlist(w, r, queryUserID(r))
+	if !ok {
+		return
+	}
+	productID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.RemoveFromWishlist(config.DB, wishlist, productID); err != nil {
+		if errors.Is(err, services.ErrNotOnWishlist) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Product removed from wishlist"})
+}
+
+// MoveWishlistItemToCart moves a product from a wishlist into the user's cart
+func MoveWishlistItemToCart(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req WishlistItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wishlist, ok := ownedWishlist(w, r, req.UserID)
+	if !ok {
+		return
+	}
+	productID, err := strconv.Atoi(mux.Vars(r)["productID"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	cart, err := services.MoveToCart(config.DB, wishlist, productID, req.Quantity)
+	if err != nil {
+		if errors.Is(err, services.ErrNotOnWishlist) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(cart)
+}
@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/cache"
 	"github.com/theinvincible/ecommerce-backend/config"
 	"github.com/theinvincible/ecommerce-backend/handlers"
 	"github.com/theinvincible/ecommerce-backend/partition"
+	"github.com/theinvincible/ecommerce-backend/services"
 	"github.com/theinvincible/ecommerce-backend/utils"
 )
 
@@ -24,9 +27,79 @@ func main() {
 		log.Fatal("Database connection failed")
 	}
 
+	// Give products and categories created before slugs existed a slug
+	if err := services.BackfillSlugs(); err != nil {
+		log.Printf("Error backfilling slugs: %v", err)
+	}
+
+	// Make sure the base currency has presentment rules to price and charge in
+	if err := services.EnsureBaseCurrency(); err != nil {
+		log.Printf("Error creating the base currency: %v", err)
+	}
+
+	// Put the stock of products without a warehouse into the default one
+	if err := services.BackfillInventory(); err != nil {
+		log.Printf("Error backfilling inventory: %v", err)
+	}
+
+	// Keep the stock ledger append-only in the database itself
+	if err := services.ProtectStockLedger(); err != nil {
+		log.Printf("Error protecting the stock ledger: %v", err)
+	}
+
 	// Set up router
+	router := newRouter()
+
+	// Use Redis for caching when it is reachable, otherwise an in-memory cache
+	cache.Init()
+
+	// Publish and unpublish scheduled products
+	utils.RunEvery("product lifecycle", time.Minute, services.ApplyProductSchedules)
+
+	// Record price history when scheduled sales start and end
+	utils.RunEvery("sale windows", time.Minute, services.ApplySaleWindows)
+
+	// Refresh exchange rates from the configured rate source
+	utils.RunEvery("exchange rates", time.Hour, services.RefreshExchangeRates)
+
+	// Rebuild "frequently bought together" affinities from order history
+	utils.RunEvery("product affinity mining", 6*time.Hour, services.MineProductAffinities)
+
+	// Alert users when wishlisted products drop in price
+	utils.RunEvery("wishlist price drops", 15*time.Minute, services.NotifyWishlistPriceDrops)
+
+	// Give back the stock held for orders whose payment never completed
+	utils.RunEvery("expired stock reservations", time.Minute, services.ReleaseExpiredReservations)
+
+	// Notify back-in-stock subscribers of restocks the update handlers did not report
+	utils.RunEvery("back-in-stock notifications", 5*time.Minute, services.ProcessAllBackInStock)
+
+	// Tell vendors and admins about locations that fell to their reorder level
+	utils.RunEvery("low stock alerts", 15*time.Minute, services.NotifyLowStock)
+
+	// Regenerate the product feeds for shopping channels
+	utils.RunEvery("product feeds", services.FeedInterval(), services.GenerateFeeds)
+
+	err := http.ListenAndServe(":3001", router)
+	if err != nil {
+		log.Fatal("Error starting server:", err)
+	}
+	fmt.Println("Server is running on port 3001")
+
+}
+
+// newRouter registers the API routes. Admin and vendor routes check the role of the bearer token's user
+// with RoleMiddleware.
+func newRouter() *mux.Router {
 	router := mux.NewRouter()
 
+	// Sitemap routes
+	router.HandleFunc("/sitemap.xml", handlers.GetSitemap).Methods("GET")
+	router.HandleFunc("/sitemaps/{kind:products|categories}-{page:[0-9]+}.xml", handlers.GetSitemapPage).Methods("GET")
+
+	// Product feed routes
+	router.HandleFunc("/feeds/{name}", handlers.GetFeed).Methods("GET")
+
 	//Login routes
 	router.HandleFunc("/api/v1/signup", handlers.SignUp).Methods("POST")
 	router.HandleFunc("/api/v1/login", handlers.Login).Methods("POST")
@@ -41,23 +114,55 @@ func main() {
 	// Product routes
 	router.HandleFunc("/api/v1/products", handlers.CreateProduct).Methods("POST")
 	router.HandleFunc("/api/v1/products", handlers.GetProducts).Methods("GET")
+	router.HandleFunc("/api/v1/products/slug/{slug}", handlers.GetProductBySlug).Methods("GET")
 	router.HandleFunc("/api/v1/products/{id}", handlers.GetProductByID).Methods("GET")
 	router.HandleFunc("/api/v1/products/{id}", handlers.UpdateProduct).Methods("PUT")
+	router.HandleFunc("/api/v1/products/{id}/attributes", handlers.GetProductSpecifications).Methods("GET")
+	router.HandleFunc("/api/v1/products/{id}/attributes", handlers.SetProductAttributes).Methods("PUT")
+	router.HandleFunc("/api/v1/products/{id}/related", handlers.GetRelatedProducts).Methods("GET")
+	router.HandleFunc("/api/v1/products/{id}/notify-me", handlers.SubscribeBackInStock).Methods("POST")
+	router.HandleFunc("/api/v1/stock-subscriptions/{token}", handlers.ConfirmUnsubscribeBackInStock).Methods("GET")
+	router.HandleFunc("/api/v1/stock-subscriptions/{token}", handlers.UnsubscribeBackInStock).Methods("POST", "DELETE")
+	router.HandleFunc("/api/v1/recently-viewed", handlers.GetRecentlyViewed).Methods("GET")
+	router.HandleFunc("/api/v1/feed", handlers.GetPersonalizedFeed).Methods("GET")
 	// router.HandleFunc("/api/v1/products/{id}", handlers.DeleteProduct(db)).Methods("DELETE")
 
+	// Review routes
+	router.HandleFunc("/api/v1/products/{id}/reviews", handlers.CreateReview).Methods("POST")
+	router.HandleFunc("/api/v1/products/{id}/reviews", handlers.GetProductReviews).Methods("GET")
+	router.HandleFunc("/api/v1/products/{id}/ratings", handlers.GetProductRatingSummary).Methods("GET")
+	router.HandleFunc("/api/v1/reviews/{id}", handlers.UpdateReview).Methods("PUT")
+	router.HandleFunc("/api/v1/reviews/{id}", handlers.DeleteReview).Methods("DELETE")
+	router.HandleFunc("/api/v1/reviews/{id}/report", handlers.ReportReview).Methods("POST")
+
+	// Product Q&A routes
+	router.HandleFunc("/api/v1/products/{id}/questions", handlers.AskQuestion).Methods("POST")
+	router.HandleFunc("/api/v1/products/{id}/questions", handlers.GetProductQuestions).Methods("GET")
+	router.Handle("/api/v1/questions/{id}/answers", handlers.RoleMiddleware("vendor", "admin")(http.HandlerFunc(handlers.AnswerQuestion))).Methods("POST")
+	router.HandleFunc("/api/v1/questions/{id}/upvote", handlers.UpvoteQuestion).Methods("POST")
+	router.HandleFunc("/api/v1/answers/{id}/upvote", handlers.UpvoteAnswer).Methods("POST")
+
 	// Order routes
 	router.HandleFunc("/api/v1/addorders", handlers.CreateOrderHandler(config.DB)).Methods("POST")
 	router.HandleFunc("/api/v1/orders", handlers.GetOrders).Methods("GET")
 	router.HandleFunc("/api/v1/orders/{id}", handlers.GetOrder).Methods("GET")
+	router.HandleFunc("/api/v1/orders/{id}/downloads", handlers.GetOrderDownloads).Methods("GET")
+	router.HandleFunc("/api/v1/downloads/{id}", handlers.DownloadFile).Methods("GET")
 	router.HandleFunc("/api/v1/orders/{id}", handlers.UpdateOrder).Methods("PUT")
 	router.HandleFunc("/api/v1/orders/{id}", handlers.DeleteOrder).Methods("DELETE")
 
+	// Tag routes
+	router.HandleFunc("/api/v1/tags", handlers.GetTagCloud).Methods("GET")
+	router.HandleFunc("/api/v1/blog-posts/{id}/products", handlers.GetBlogPostProducts).Methods("GET")
+
 	// Category routes
 	router.HandleFunc("/api/v1/categories", handlers.CreateCategory).Methods("POST")
 	router.HandleFunc("/api/v1/categories", handlers.GetCategories).Methods("GET")
+	router.HandleFunc("/api/v1/categories/slug/{slug}", handlers.GetCategoryBySlug).Methods("GET")
 	router.HandleFunc("/api/v1/categories/{id}", handlers.GetCategory).Methods("GET")
 	router.HandleFunc("/api/v1/categories/{id}", handlers.UpdateCategory).Methods("PUT")
 	router.HandleFunc("/api/v1/categories/{id}", handlers.DeleteCategory).Methods("DELETE")
+	router.HandleFunc("/api/v1/categories/{id}/attributes", handlers.GetCategoryAttributes).Methods("GET")
 
 	// Cart routes
 	router.HandleFunc("/api/v1/cart", handlers.CreateCart).Methods("POST")
@@ -65,6 +170,31 @@ func main() {
 	router.HandleFunc("/api/v1/cart/{id}", handlers.UpdateCart).Methods("PUT")
 	router.HandleFunc("/api/v1/cart/{id}", handlers.DeleteCart).Methods("DELETE")
 
+	// Wishlist routes
+	router.HandleFunc("/api/v1/wishlists", handlers.CreateWishlist).Methods("POST")
+	router.HandleFunc("/api/v1/wishlists", handlers.GetWishlists).Methods("GET")
+	router.HandleFunc("/api/v1/wishlists/shared/{token}", handlers.GetSharedWishlist).Methods("GET")
+	router.HandleFunc("/api/v1/wishlists/{id}", handlers.GetWishlist).Methods("GET")
+	router.HandleFunc("/api/v1/wishlists/{id}", handlers.UpdateWishlist).Methods("PUT")
+	router.HandleFunc("/api/v1/wishlists/{id}", handlers.DeleteWishlist).Methods("DELETE")
+	router.HandleFunc("/api/v1/wishlists/{id}/items", handlers.AddWishlistItem).Methods("POST")
+	router.HandleFunc("/api/v1/wishlists/{id}/items/{productID}", handlers.RemoveWishlistItem).Methods("DELETE")
+	router.HandleFunc("/api/v1/wishlists/{id}/items/{productID}/move-to-cart", handlers.MoveWishlistItemToCart).Methods("POST")
+
+	// Comparison routes
+	router.HandleFunc("/api/v1/compare", handlers.CompareProducts).Methods("GET")
+	router.HandleFunc("/api/v1/comparison", handlers.GetComparison).Methods("GET")
+	router.HandleFunc("/api/v1/comparison", handlers.ClearComparison).Methods("DELETE")
+	router.HandleFunc("/api/v1/comparison/items", handlers.AddComparisonItem).Methods("POST")
+	router.HandleFunc("/api/v1/comparison/items/{productID}", handlers.RemoveComparisonItem).Methods("DELETE")
+
+	// Notification routes
+	router.HandleFunc("/api/v1/notifications", handlers.GetNotifications).Methods("GET")
+	router.HandleFunc("/api/v1/notifications/{id}/read", handlers.MarkNotificationRead).Methods("PUT")
+
+	// Currency routes
+	router.HandleFunc("/api/v1/currencies", handlers.GetCurrencies).Methods("GET")
+
 	// Payment routes
 	router.HandleFunc("/api/v1/payment", handlers.PaymentHandler).Methods("POST")
 	router.HandleFunc("/api/v1/webhook", handlers.WebhookHandler).Methods("POST")
@@ -77,41 +207,100 @@ func main() {
 
 	//<=====================================================MIddleware routes=====================================================>
 
-	router.HandleFunc("/api/v1/admin", partition.AdminHandler).Methods("GET").Subrouter().Use(handlers.RoleMiddleware("admin"))
-	router.HandleFunc("/api/v1/admin/dashboard", partition.AdminDashboardHandler).Methods("GET").Subrouter().Use(handlers.RoleMiddleware("admin"))
-	router.HandleFunc("/api/v1/admin/users", partition.GetUsersHandler).Methods("GET").Subrouter().Use(handlers.RoleMiddleware("admin"))
-	router.HandleFunc("/api/v1/admin/users/{id}", partition.UpdateUserHandler).Methods("POST").Subrouter().Use(handlers.RoleMiddleware("admin"))
-	router.HandleFunc("/api/v1/admin/users/{id}", partition.DeleteUserHandler).Methods("DELETE").Subrouter().Use(handlers.RoleMiddleware("admin"))
-	router.HandleFunc("/api/v1/admin/products", partition.AddProductHandler).Methods("POST").Subrouter().Use(handlers.RoleMiddleware("admin"))
-	router.HandleFunc("/api/v1/admin/products/{id}", partition.UpdateProductHandler).Methods("POST").Subrouter().Use(handlers.RoleMiddleware("admin"))
-	router.HandleFunc("/api/v1/admin/products/{id}", partition.DeleteProductHandler).Methods("DELETE").Subrouter().Use(handlers.RoleMiddleware("admin"))
-	router.HandleFunc("/api/v1/admin/orders", partition.GetOrdersHandler).Methods("GET").Subrouter().Use(handlers.RoleMiddleware("admin"))
-	router.HandleFunc("/api/v1/admin/orders/{id}", partition.UpdateOrderStatusHandler).Methods("POST").Subrouter().Use(handlers.RoleMiddleware("admin"))
-	router.HandleFunc("/api/v1/admin/categories", partition.AssignRoleHandler).Methods("POST").Subrouter().Use(handlers.RoleMiddleware("admin"))
-
-	router.HandleFunc("/api/v1/vendor", partition.VendorHandler).Methods("GET").Subrouter().Use(handlers.RoleMiddleware("vendor"))
-	router.HandleFunc("/api/v1/login/{id}", partition.LoginVendor).Methods("POST").Subrouter().Use(handlers.RoleMiddleware("vendor"))
-	router.HandleFunc("/api/v1/vendor/products", partition.AddProduct).Methods("POST").Subrouter().Use(handlers.RoleMiddleware("vendor"))
-	router.HandleFunc("/api/v1/vendor/products/{id}", partition.UpdateProduct).Methods("PUT").Subrouter().Use(handlers.RoleMiddleware("vendor"))
-	router.HandleFunc("/api/v1vendor/products/{id}", partition.DeleteProduct).Methods("DELETE").Subrouter().Use(handlers.RoleMiddleware("vendor"))
-	router.HandleFunc("/api/v1/vendor/orders", partition.GetOrders).Methods("GET").Subrouter().Use(handlers.RoleMiddleware("vendor"))
-	router.HandleFunc("/api/v1/vendor/orders/{id}", partition.DeleteOrder).Methods("DELETE").Subrouter().Use(handlers.RoleMiddleware("vendor"))
-	router.HandleFunc("/api/v1/vendor/{id}", partition.GetSalesData).Methods("GET").Subrouter().Use(handlers.RoleMiddleware("vendor"))
-
-	// router.HandleFunc("/customer", CustomerHandler).Methods("GET").Subrouter().Use(handlers.RoleMiddleware("customer"))
-	// router.HandleFunc("/dashboard", DashboardHandler).Methods("GET").Subrouter().Use(handlers.RoleMiddleware("admin", "vendor"))
-
-	rdb := utils.InitRedisClient()
-	if rdb == nil {
-		log.Fatal("Failed to initialize Redis client")
-	} else {
-		log.Println("Redis client initialized successfully")
-	}
+	router.Handle("/api/v1/admin", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.AdminHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/dashboard", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.AdminDashboardHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/users", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetUsersHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/users/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.UpdateUserHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/users/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.DeleteUserHandler))).Methods("DELETE")
+	router.Handle("/api/v1/admin/products", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetAllProductsHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/products", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.AddProductHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/products/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.PreviewProductHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/products/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.UpdateProductHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/products/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.DeleteProductHandler))).Methods("DELETE")
+	router.Handle("/api/v1/admin/products/{id}/status", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.SetProductStatusHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/products/{id}/components", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.SetBundleComponentsHandler))).Methods("PUT")
+	router.Handle("/api/v1/admin/products/{id}/stock-subscriptions", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetStockSubscriptionsHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/products/{id}/digital-asset", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.SetDigitalAssetHandler))).Methods("PUT")
+	router.Handle("/api/v1/admin/products/{id}/licence-keys", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.AddLicenceKeysHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/products/{id}/licence-keys", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetLicenceKeyStockHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/products/{id}/sales", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.CreateSaleHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/products/{id}/sales", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetSalesHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/products/{id}/price-history", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetPriceHistoryHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/sales/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.DeleteSaleHandler))).Methods("DELETE")
+	router.Handle("/api/v1/admin/products/{id}/prices/{currency}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.SetProductCurrencyPriceHandler))).Methods("PUT")
+	router.Handle("/api/v1/admin/products/{id}/prices/{currency}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.DeleteProductCurrencyPriceHandler))).Methods("DELETE")
+	router.Handle("/api/v1/admin/currencies/{code}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.UpsertCurrencyHandler))).Methods("PUT")
+	router.Handle("/api/v1/admin/exchange-rates/refresh", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.RefreshExchangeRatesHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/cache/invalidate", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.InvalidateCatalogCacheHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/products/{id}/inventory", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetProductInventoryHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/products/{id}/inventory/{warehouseID}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.SetProductInventoryHandler))).Methods("PUT")
+	router.Handle("/api/v1/admin/products/{id}/stock-movements", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetStockMovementsHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/products/{id}/stock-movements", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.RecordStockMovementHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/reports/stock-valuation", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetStockValuationHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/products/{id}/tags", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.SetProductTagsHandler))).Methods("PUT")
+	router.Handle("/api/v1/admin/products/{id}/tags/{tag}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.DeleteProductTagHandler))).Methods("DELETE")
+	router.Handle("/api/v1/admin/products/{id}/translations", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetProductTranslationsHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/products/{id}/translations/{lang}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.SetProductTranslationHandler))).Methods("PUT")
+	router.Handle("/api/v1/admin/products/{id}/translations/{lang}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.DeleteProductTranslationHandler))).Methods("DELETE")
+	router.Handle("/api/v1/admin/categories/{id}/translations", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetCategoryTranslationsHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/categories/{id}/translations/{lang}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.SetCategoryTranslationHandler))).Methods("PUT")
+	router.Handle("/api/v1/admin/categories/{id}/translations/{lang}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.DeleteCategoryTranslationHandler))).Methods("DELETE")
+	router.Handle("/api/v1/admin/categories/{id}/attributes", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.AddCategoryAttributeHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/categories/{id}/attributes/{attributeID}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.UpdateCategoryAttributeHandler))).Methods("PUT")
+	router.Handle("/api/v1/admin/categories/{id}/attributes/{attributeID}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.DeleteCategoryAttributeHandler))).Methods("DELETE")
+	router.Handle("/api/v1/admin/warehouses", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetWarehousesHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/warehouses", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.CreateWarehouseHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/warehouses/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.UpdateWarehouseHandler))).Methods("PUT")
+	router.Handle("/api/v1/admin/transfers", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetTransferOrdersHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/transfers", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.CreateTransferOrderHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/transfers/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetTransferOrderHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/transfers/{id}/ship", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.ShipTransferOrderHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/transfers/{id}/receive", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.ReceiveTransferOrderHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/transfers/{id}/cancel", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.CancelTransferOrderHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/suppliers", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetSuppliersHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/suppliers", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.CreateSupplierHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/suppliers/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.UpdateSupplierHandler))).Methods("PUT")
+	router.Handle("/api/v1/admin/purchase-orders", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetPurchaseOrdersHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/purchase-orders", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.CreatePurchaseOrderHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/purchase-orders/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetPurchaseOrderHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/purchase-orders/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.UpdatePurchaseOrderHandler))).Methods("PUT")
+	router.Handle("/api/v1/admin/purchase-orders/{id}/send", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.SendPurchaseOrderHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/purchase-orders/{id}/receive", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.ReceivePurchaseOrderHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/purchase-orders/{id}/cancel", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.CancelPurchaseOrderHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/inventory/low-stock", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetLowStockHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/stock-takes", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetStockTakesHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/stock-takes", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.CreateStockTakeHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/stock-takes/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetStockTakeHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/stock-takes/{id}/counts", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.RecordStockCountsHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/stock-takes/{id}/variance", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetStockTakeVarianceHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/stock-takes/{id}/approve", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.ApproveStockTakeHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/stock-takes/{id}/cancel", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.CancelStockTakeHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/feeds/generate", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GenerateFeedsHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/orders", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetOrdersHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/orders/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.UpdateOrderStatusHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/orders/{id}/allocations", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetOrderAllocationsHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/reviews", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetReviewQueueHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/reviews/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.ModerateReviewHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/reviews/{id}/reports", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetReviewReportsHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/questions", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetQuestionQueueHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/questions/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.ModerateQuestionHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/answers", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.GetAnswerQueueHandler))).Methods("GET")
+	router.Handle("/api/v1/admin/answers/{id}", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.ModerateAnswerHandler))).Methods("POST")
+	router.Handle("/api/v1/admin/categories", handlers.RoleMiddleware("admin")(http.HandlerFunc(partition.AssignRoleHandler))).Methods("POST")
 
-	err := http.ListenAndServe(":3001", router)
-	if err != nil {
-		log.Fatal("Error starting server:", err)
-	}
-	fmt.Println("Server is running on port 3001")
+	router.Handle("/api/v1/vendor", handlers.RoleMiddleware("vendor")(http.HandlerFunc(partition.VendorHandler))).Methods("GET")
+	router.Handle("/api/v1/login/{id}", handlers.RoleMiddleware("vendor")(http.HandlerFunc(partition.LoginVendor))).Methods("POST")
+	router.Handle("/api/v1/vendor/products", handlers.RoleMiddleware("vendor")(http.HandlerFunc(partition.AddProduct))).Methods("POST")
+	router.Handle("/api/v1/vendor/products/{id}", handlers.RoleMiddleware("vendor")(http.HandlerFunc(partition.UpdateProduct))).Methods("PUT")
+	router.Handle("/api/v1/vendor/products/{id}/tags", handlers.RoleMiddleware("vendor")(http.HandlerFunc(partition.SetProductTags))).Methods("PUT")
+	router.Handle("/api/v1vendor/products/{id}", handlers.RoleMiddleware("vendor")(http.HandlerFunc(partition.DeleteProduct))).Methods("DELETE")
+	router.Handle("/api/v1/vendor/low-stock", handlers.RoleMiddleware("vendor")(http.HandlerFunc(partition.GetLowStock))).Methods("GET")
+	router.Handle("/api/v1/vendor/orders", handlers.RoleMiddleware("vendor")(http.HandlerFunc(partition.GetOrders))).Methods("GET")
+	router.Handle("/api/v1/vendor/orders/{id}", handlers.RoleMiddleware("vendor")(http.HandlerFunc(partition.DeleteOrder))).Methods("DELETE")
+	router.Handle("/api/v1/vendor/{id}", handlers.RoleMiddleware("vendor")(http.HandlerFunc(partition.GetSalesData))).Methods("GET")
+
+	// router.Handle("/customer", handlers.RoleMiddleware("customer")(http.HandlerFunc(CustomerHandler))).Methods("GET")
+	// router.Handle("/dashboard", handlers.RoleMiddleware("admin", "vendor")(http.HandlerFunc(DashboardHandler))).Methods("GET")
 
+	return router
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/models"
+)
+
+var routeVariable = regexp.MustCompile(`\{[^}]*\}`)
+
+// protectedPath reports whether a route is only for admins or vendors.
+func protectedPath(template string) bool {
+	for _, prefix := range []string{"/api/v1/admin", "/api/v1/vendor", "/api/v1vendor", "/api/v1/login/"} {
+		if strings.HasPrefix(template, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProtectedRoutesNeedAToken(t *testing.T) {
+	router := newRouter()
+
+	checked := 0
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || !protectedPath(template) {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		path := routeVariable.ReplaceAllString(template, "1")
+		for _, method := range methods {
+			for _, authorization := range []string{"", "Bearer not-a-token", "Basic YWRtaW46YWRtaW4="} {
+				request := httptest.NewRequest(method, path, nil)
+				if authorization != "" {
+					request.Header.Set("Authorization", authorization)
+				}
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, request)
+				if recorder.Code != http.StatusUnauthorized {
+					t.Errorf("%s %s with %q = %d, want %d", method, path, authorization, recorder.Code, http.StatusUnauthorized)
+				}
+			}
+			checked++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked == 0 {
+		t.Fatal("no protected routes found")
+	}
+}
+
+func TestProtectedRoutesCheckTheRole(t *testing.T) {
+	router := newRouter()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		role   string
+		want   int
+	}{
+		{"customer on an admin route", "GET", "/api/v1/admin/dashboard", "", "customer", http.StatusForbidden},
+		{"vendor on an admin route", "POST", "/api/v1/admin/warehouses", "{", "vendor", http.StatusForbidden},
+		{"admin on an admin route", "POST", "/api/v1/admin/warehouses", "{", "admin", http.StatusBadRequest},
+		{"customer on a vendor route", "POST", "/api/v1/vendor/products", "{", "customer", http.StatusForbidden},
+		{"admin on a vendor route", "POST", "/api/v1/vendor/products", "{", "admin", http.StatusForbidden},
+		{"vendor on a vendor route", "POST", "/api/v1/vendor/products", "{", "vendor", http.StatusBadRequest},
+		{"customer answering a question", "POST", "/api/v1/questions/1/answers", "{", "customer", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			request = request.WithContext(context.WithValue(request.Context(), "user", &models.User{ID: 7, Role: test.role}))
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != test.want {
+				t.Errorf("%s %s as %s = %d, want %d", test.method, test.path, test.role, recorder.Code, test.want)
+			}
+		})
+	}
+}
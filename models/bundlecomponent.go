@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// BundleComponent is one product contained in a bundle, e.g. the lens of a camera kit.
+type BundleComponent struct {
+	gorm.Model
+	BundleID    int     `json:"bundle_id" gorm:"not null;uniqueIndex:idx_bundle_component"`
+	ComponentID int     `json:"component_id" gorm:"not null;uniqueIndex:idx_bundle_component"`
+	Quantity    int     `json:"quantity" gorm:"not null"` // units of the component in one bundle
+	Component   Product `json:"component" gorm:"foreignKey:ComponentID"`
+}
@@ -8,5 +8,6 @@ type Cart struct {
 	Items     []CartItem `json:"items" gorm:"foreignKey:CartID"`
 	Total     float64    `json:"total" gorm:"not null"`
 	TotalItem int        `json:"total_item" gorm:"not null"`
+	Currency  string     `json:"currency" gorm:"size:3"`
 	User      User       `json:"user" gorm:"foreignKey:UserID"`
 }
@@ -5,5 +5,17 @@ import "gorm.io/gorm"
 type Category struct {
 	gorm.Model
 	Name     string    `json:"name" gorm:"not null,index,unique"`
+	Slug     string    `json:"slug" gorm:"not null;default:'';index:idx_categories_slug,unique,where:slug <> ''"`
 	Products []Product `json:"products" gorm:"foreignKey:CategoryID"`
+
+	// GoogleProductCategory maps the category to the Google product taxonomy in product feeds,
+	// either a taxonomy ID such as "2271" or a path such as "Apparel & Accessories > Clothing"
+	GoogleProductCategory string `json:"google_product_category,omitempty"`
+
+	Language string `json:"language,omitempty" gorm:"-"` // language of Name, filled in by services.LocaliseCategories
+}
+
+// BeforeCreate gives new categories a slug from their name unless one was given.
+func (c *Category) BeforeCreate(tx *gorm.DB) error {
+	return assignSlug(tx, &c.Slug, "categories", SlugEntityCategory, c.Name, "category")
 }
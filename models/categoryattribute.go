@@ -0,0 +1,25 @@
+package models
+
+import "gorm.io/gorm"
+
+// Supported attribute value types
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeNumber  = "number"
+	AttributeTypeBoolean = "boolean"
+	AttributeTypeEnum    = "enum"
+)
+
+// CategoryAttribute describes one entry of a category's attribute schema, e.g. ram_gb (number, GB) for laptops.
+type CategoryAttribute struct {
+	gorm.Model
+	CategoryID    int      `json:"category_id" gorm:"not null;uniqueIndex:idx_category_attribute_name"`
+	Name          string   `json:"name" gorm:"not null;uniqueIndex:idx_category_attribute_name"` // machine name used in filters, e.g. ram_gb
+	Label         string   `json:"label"`
+	Type          string   `json:"type" gorm:"not null"` // string, number, boolean or enum
+	Unit          string   `json:"unit,omitempty"`
+	AllowedValues []string `json:"allowed_values,omitempty" gorm:"serializer:json"`
+	Filterable    bool     `json:"filterable" gorm:"default:false"`
+	Required      bool     `json:"required" gorm:"default:false"`
+	Category      Category `json:"-" gorm:"foreignKey:CategoryID"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// CategoryTranslation holds a category's name in one language.
+type CategoryTranslation struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CategoryID int       `json:"category_id" gorm:"not null;uniqueIndex:idx_category_translation"`
+	Language   string    `json:"language" gorm:"not null;uniqueIndex:idx_category_translation"`
+	Name       string    `json:"name" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -5,4 +5,10 @@ type CheckoutRequest struct {
 	ShippingAddress string `json:"shipping_address" gorm:"not null"`
 	PaymentMethod   string `json:"payment_method" gorm:"not null"`
 	DeliveryNotes   string `json:"delivery_notes"`
+	Currency        string `json:"currency"`
+
+	// Optional location of the shipping address, used to ship from the closest warehouse
+	ShippingCountry   string   `json:"shipping_country"`
+	ShippingLatitude  *float64 `json:"shipping_latitude"`
+	ShippingLongitude *float64 `json:"shipping_longitude"`
 }
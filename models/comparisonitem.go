@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// ComparisonItem is a product on a shopper's comparison list. Owner is the viewer key of the
+// shopper ("user:<id>" or "session:<id>"), so anonymous sessions keep a list too.
+type ComparisonItem struct {
+	ID        uint      `json:"-" gorm:"primarykey"`
+	Owner     string    `json:"-" gorm:"not null;uniqueIndex:idx_comparison_item"`
+	ProductID int       `json:"product_id" gorm:"not null;uniqueIndex:idx_comparison_item"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Currency holds the presentment rules of a currency. Amounts are rounded to RoundingIncrement when it is set
+// (e.g. 0.05 for CHF cash rounding), otherwise to Decimals places (e.g. 0 for JPY).
+type Currency struct {
+	Code              string  `json:"code" gorm:"primaryKey;size:3"` // ISO 4217 code, e.g. EUR
+	Symbol            string  `json:"symbol"`
+	Decimals          int     `json:"decimals"`
+	RoundingIncrement float64 `json:"rounding_increment"`
+	Enabled           bool    `json:"enabled"`
+}
+
+// ExchangeRate is how many units of Currency one unit of the base currency buys.
+type ExchangeRate struct {
+	Currency  string    `json:"currency" gorm:"primaryKey;size:3"`
+	Rate      float64   `json:"rate" gorm:"not null"`
+	Source    string    `json:"source"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
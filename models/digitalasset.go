@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// DigitalAsset is the downloadable file behind a digital product, such as an e-book or an installer.
+type DigitalAsset struct {
+	gorm.Model
+	ProductID    int    `json:"product_id" gorm:"not null;uniqueIndex"`
+	FilePath     string `json:"file_path" gorm:"not null"` // relative to DIGITAL_FILES_DIR
+	FileName     string `json:"file_name"`                 // name offered to the browser, defaults to the file's base name
+	MaxDownloads int    `json:"max_downloads" gorm:"not null;default:5"`
+}
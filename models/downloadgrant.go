@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// DownloadGrant entitles the buyer of a digital order item to a limited number of downloads.
+type DownloadGrant struct {
+	gorm.Model
+	OrderID       int `json:"order_id" gorm:"not null;index"`
+	OrderItemID   int `json:"order_item_id" gorm:"not null;uniqueIndex"`
+	ProductID     int `json:"product_id" gorm:"not null;index"`
+	UserID        int `json:"user_id" gorm:"not null;index"`
+	MaxDownloads  int `json:"max_downloads" gorm:"not null"`
+	DownloadCount int `json:"download_count" gorm:"not null;default:0"`
+}
@@ -2,11 +2,21 @@ package models
 
 import "time"
 
+// Inventory is the stock of a product at one warehouse. Quantity is what can still be sold from the
+// location; units reserved by unpaid orders or in transit to another location are not included.
+// Quantity is kept by the stock ledger as the balance of the location's last movement, and the
+// product's own Quantity is the total over its locations.
 type Inventory struct {
-	ProductID    int       `json:"product_id" gorm:"not null"`
+	ID           uint      `json:"id" gorm:"primarykey"`
+	ProductID    int       `json:"product_id" gorm:"not null;uniqueIndex:idx_inventory_location"`
+	WarehouseID  int       `json:"warehouse_id" gorm:"not null;uniqueIndex:idx_inventory_location;index"`
 	Quantity     int       `json:"quantity" gorm:"not null"`
 	Product      Product   `json:"product" gorm:"foreignKey:ProductID"`
-	StockLevel   int       `json:"stock_level" gorm:"not null"`
+	Warehouse    Warehouse `json:"warehouse" gorm:"foreignKey:WarehouseID"`
+	StockLevel   int       `json:"stock_level" gorm:"not null"` // level the location is restocked up to
 	ReorderLevel int       `json:"reorder_level"`
 	LastRestock  time.Time `json:"last_restock"`
+
+	// When the owner was told the location is at or below its reorder level; cleared once it is above again
+	LowStockNotifiedAt *time.Time `json:"low_stock_notified_at,omitempty"`
 }
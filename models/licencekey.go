@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LicenceKey is one key in a digital product's pool. A key is handed out once, to a single purchased unit.
+type LicenceKey struct {
+	gorm.Model
+	ProductID   int        `json:"product_id" gorm:"not null;index"`
+	Key         string     `json:"key" gorm:"not null;uniqueIndex"`
+	OrderItemID *int       `json:"order_item_id,omitempty" gorm:"index"` // nil while the key is unassigned
+	AssignedAt  *time.Time `json:"assigned_at,omitempty"`
+}
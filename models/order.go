@@ -13,6 +13,7 @@ type Order struct {
 	ProductID          int         `json:"product_id" gorm:"not null"`
 	Quantity           int         `json:"quantity" gorm:"not null"`
 	TotalAmount        float64     `json:"total_amount" gorm:"not null"`
+	Currency           string      `json:"currency" gorm:"size:3"`
 	OrderStatus        string      `json:"order_status" gorm:"not null"`
 	OrderItems         []OrderItem `json:"order_items" gorm:"foreignKey:OrderID"` //represents the collection of ordered items belonging to a customer.
 	PaymentMethod      string      `json:"payment_method"`
@@ -21,4 +22,5 @@ type Order struct {
 	OrderTotal         string      `json:"order_total"`
 	OrderDiscount      string      `json:"order_discount"`
 	OrderPaymentStatus string      `json:"order_payment_status"`
+	DigitalOnly        bool        `json:"digital_only" gorm:"not null;default:false"` // every item is digital, so nothing is shipped
 }
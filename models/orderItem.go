@@ -10,4 +10,7 @@ type OrderItem struct {
 	Price     float64 `json:"price" gorm:"not null"`
 	Total     float64 `json:"total" gorm:"not null"`
 	Product   Product `json:"product" gorm:"foreignKey:ProductID"`
+
+	// Breakdown of a bundle line into its components, used to split refunds and returns
+	Components []OrderItemComponent `json:"components,omitempty" gorm:"foreignKey:OrderItemID"`
 }
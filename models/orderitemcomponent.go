@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// OrderItemComponent records how a bundle order line breaks down into component products.
+// AllocatedTotal is the component's share of the line total, weighted by the standalone component prices.
+type OrderItemComponent struct {
+	gorm.Model
+	OrderItemID    int     `json:"order_item_id" gorm:"not null;index"`
+	ProductID      int     `json:"product_id" gorm:"not null"`
+	Quantity       int     `json:"quantity" gorm:"not null"` // total units across the whole line
+	AllocatedTotal float64 `json:"allocated_total" gorm:"not null"`
+}
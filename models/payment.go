@@ -7,6 +7,7 @@ type Payment struct {
 	OrderID       int     `json:"order_id" gorm:"not null"`
 	TransactionID string  `json:"transaction_id" gorm:"not null"`
 	Amount        float64 `json:"amount" gorm:"not null"`
+	Currency      string  `json:"currency" gorm:"size:3"`
 	Status        string  `json:"status" gorm:"not null"`
 	Order         Order   `json:"order" gorm:"foreignKey:OrderID"`
 	PaymentMethod string  `json:"payment_method" gorm:"not null"`
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// PriceHistory is an immutable record of a product's pricing after each change.
+// EffectivePrice is what customers paid during the period, which is needed for the 30-day lowest price.
+type PriceHistory struct {
+	ID             uint      `json:"id" gorm:"primarykey"`
+	ProductID      int       `json:"product_id" gorm:"not null;index:idx_price_history_product_time"`
+	Price          float64   `json:"price" gorm:"not null"`
+	Discount       float64   `json:"discount"`
+	SalePrice      *float64  `json:"sale_price,omitempty"`
+	EffectivePrice float64   `json:"effective_price" gorm:"not null"`
+	Source         string    `json:"source" gorm:"not null"` // create, update, admin, vendor, sale_start or sale_end
+	ChangedBy      int       `json:"changed_by"`             // user ID of the actor, 0 for the system
+	CreatedAt      time.Time `json:"created_at" gorm:"index:idx_price_history_product_time"`
+}
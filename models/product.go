@@ -1,20 +1,71 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Product types. A bundle is sold at its own price but its stock comes from its components.
+// Digital products are downloaded rather than shipped and have no stock.
+const (
+	ProductTypeSimple  = "simple"
+	ProductTypeBundle  = "bundle"
+	ProductTypeDigital = "digital"
+)
+
+// Product lifecycle states. Only published products are visible in the public catalog.
+const (
+	ProductStatusDraft     = "draft"
+	ProductStatusPublished = "published"
+	ProductStatusArchived  = "archived"
+)
 
 type Product struct {
 	gorm.Model
-	Name            string  `json:"name" gorm:"not null,index"`
-	Description     string  `json:"description" gorm:"not null"`
-	Price           float64 `json:"price" gorm:"not null,index"`
-	Quantity        int     `json:"quantity" gorm:"not null"`
-	Image           string  `json:"image" gorm:"not null"`
-	CategoryID      int     `json:"category_id" gorm:"not null"`
-	Discount        float64 `json:"discount,omitempty" gorm:"type:decimal(10,2)"`
-	SKU             string  `json:"sku,omitempty" gorm:"unique;not null"`
-	Brand           string  `json:"brand,omitempty" gorm:"index"`
-	Weight          float64 `json:"weight,omitempty" gorm:"type:decimal(10,2)"`
-	Dimensions      string  `json:"dimensions,omitempty"`
-	AverageRating   float64 `json:"average_rating,omitempty" gorm:"type:decimal(3,2)"`
-	NumberOfRatings int     `json:"number_of_ratings,omitempty"`
+	Name            string     `json:"name" gorm:"not null,index"`
+	Slug            string     `json:"slug" gorm:"not null;default:'';index:idx_products_slug,unique,where:slug <> ''"`
+	Description     string     `json:"description" gorm:"not null"`
+	Price           float64    `json:"price" gorm:"not null,index"`
+	Quantity        int        `json:"quantity" gorm:"not null"`
+	Image           string     `json:"image" gorm:"not null"`
+	CategoryID      int        `json:"category_id" gorm:"not null"`
+	Discount        float64    `json:"discount,omitempty" gorm:"type:decimal(10,2)"` // percentage off Price
+	SKU             string     `json:"sku,omitempty" gorm:"unique;not null"`
+	GTIN            string     `json:"gtin,omitempty" gorm:"index"` // EAN/UPC/ISBN barcode number, listed in product feeds
+	Brand           string     `json:"brand,omitempty" gorm:"index"`
+	VendorID        uint       `json:"vendor_id,omitempty" gorm:"index"` // vendor selling the product, 0 for the store itself
+	Weight          float64    `json:"weight,omitempty" gorm:"type:decimal(10,2)"`
+	Dimensions      string     `json:"dimensions,omitempty"`
+	AverageRating   float64    `json:"average_rating,omitempty" gorm:"type:decimal(3,2)"`
+	NumberOfRatings int        `json:"number_of_ratings,omitempty"`
+	Type            string     `json:"type" gorm:"not null;default:simple;index"`      // simple, bundle or digital
+	Status          string     `json:"status" gorm:"not null;default:published;index"` // draft, published or archived
+	PublishAt       *time.Time `json:"publish_at,omitempty" gorm:"index"`
+	UnpublishAt     *time.Time `json:"unpublish_at,omitempty" gorm:"index"`
+
+	// Names of the product's tags, filled in by services.ApplyProductTags
+	Tags []string `json:"tags,omitempty" gorm:"-"`
+
+	// Language of Name and Description, filled in by services.LocaliseProducts
+	Language string `json:"language,omitempty" gorm:"-"`
+
+	// Computed pricing, filled in by services.ApplyPricing before a product is returned
+	Currency          string     `json:"currency" gorm:"-"` // currency of every amount in the response
+	EffectivePrice    float64    `json:"effective_price" gorm:"-"`
+	SalePrice         *float64   `json:"sale_price,omitempty" gorm:"-"`
+	SaleEndsAt        *time.Time `json:"sale_ends_at,omitempty" gorm:"-"`
+	LowestPrice30Days *float64   `json:"lowest_price_30_days,omitempty" gorm:"-"`
+}
+
+// BeforeCreate starts new products as drafts unless a status was given explicitly,
+// so nothing reaches the public catalog before it is published, and gives them a slug from their name.
+func (p *Product) BeforeCreate(tx *gorm.DB) error {
+	if p.Status == "" {
+		p.Status = ProductStatusDraft
+	}
+	if p.Type == "" {
+		p.Type = ProductTypeSimple
+	}
+	return assignSlug(tx, &p.Slug, "products", SlugEntityProduct, p.Name, "product")
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// ProductAffinity is a mined "bought together" pair. Support is the share of all orders containing both
+// products, Confidence the share of orders with ProductID that also contain RelatedProductID, and Lift
+// how much more often the pair occurs than if the products were bought independently.
+type ProductAffinity struct {
+	ID               uint      `json:"-" gorm:"primarykey"`
+	ProductID        int       `json:"product_id" gorm:"not null;uniqueIndex:idx_product_affinity_pair"`
+	RelatedProductID int       `json:"related_product_id" gorm:"not null;uniqueIndex:idx_product_affinity_pair"`
+	PairCount        int       `json:"pair_count" gorm:"not null"`
+	Support          float64   `json:"support" gorm:"not null"`
+	Confidence       float64   `json:"confidence" gorm:"not null"`
+	Lift             float64   `json:"lift" gorm:"not null"`
+	ComputedAt       time.Time `json:"computed_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "gorm.io/gorm"
+
+// ProductAnswer is a public answer to a product question, given by the product's vendor or an admin.
+type ProductAnswer struct {
+	gorm.Model
+	QuestionID       int    `json:"question_id" gorm:"not null;index"`
+	UserID           int    `json:"user_id" gorm:"not null"`
+	AnswererRole     string `json:"answerer_role" gorm:"not null"` // vendor or admin
+	Body             string `json:"body" gorm:"not null"`
+	Status           string `json:"status" gorm:"not null;default:approved;index"`
+	ModerationReason string `json:"moderation_reason,omitempty"`
+	UpvoteCount      int    `json:"upvote_count" gorm:"not null;default:0"`
+}
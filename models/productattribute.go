@@ -0,0 +1,16 @@
+package models
+
+import "gorm.io/gorm"
+
+// ProductAttributeValue stores a product's value for a category attribute.
+// Only the column matching the attribute type is set, which keeps numeric values comparable in SQL.
+type ProductAttributeValue struct {
+	gorm.Model
+	ProductID   int               `json:"product_id" gorm:"not null;uniqueIndex:idx_product_attribute"`
+	AttributeID int               `json:"attribute_id" gorm:"not null;uniqueIndex:idx_product_attribute"`
+	ValueString string            `json:"value_string,omitempty"`
+	ValueNumber *float64          `json:"value_number,omitempty" gorm:"index"`
+	ValueBool   *bool             `json:"value_bool,omitempty"`
+	Attribute   CategoryAttribute `json:"attribute" gorm:"foreignKey:AttributeID"`
+	Product     Product           `json:"-" gorm:"foreignKey:ProductID"`
+}
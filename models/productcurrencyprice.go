@@ -0,0 +1,11 @@
+package models
+
+import "gorm.io/gorm"
+
+// ProductCurrencyPrice fixes a product's regular price in a currency instead of converting it from the base price.
+type ProductCurrencyPrice struct {
+	gorm.Model
+	ProductID int     `json:"product_id" gorm:"not null;uniqueIndex:idx_product_currency_price"`
+	Currency  string  `json:"currency" gorm:"not null;size:3;uniqueIndex:idx_product_currency_price"`
+	Price     float64 `json:"price" gorm:"not null"`
+}
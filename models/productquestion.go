@@ -0,0 +1,22 @@
+package models
+
+import "gorm.io/gorm"
+
+// Q&A moderation states. Only approved questions and answers are shown on the product page.
+const (
+	QAStatusPending  = "pending"
+	QAStatusApproved = "approved"
+	QAStatusRejected = "rejected"
+)
+
+// ProductQuestion is a pre-sale question a customer asks about a product.
+type ProductQuestion struct {
+	gorm.Model
+	ProductID        int             `json:"product_id" gorm:"not null;index"`
+	UserID           int             `json:"user_id" gorm:"not null;index"`
+	Body             string          `json:"body" gorm:"not null"`
+	Status           string          `json:"status" gorm:"not null;default:approved;index"`
+	ModerationReason string          `json:"moderation_reason,omitempty"`
+	UpvoteCount      int             `json:"upvote_count" gorm:"not null;default:0"`
+	Answers          []ProductAnswer `json:"answers" gorm:"foreignKey:QuestionID"`
+}
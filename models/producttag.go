@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// ProductTag links a product to a Tag. Tags are shared with blog posts, so a post and the products
+// it writes about can be matched by their tags.
+type ProductTag struct {
+	ProductID int       `json:"product_id" gorm:"primaryKey"`
+	TagID     int       `json:"tag_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
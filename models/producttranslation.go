@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// ProductTranslation holds a product's name and description in one language, e.g. "fr" or "pt-br".
+// An empty field falls back to the next language in the shopper's chain.
+type ProductTranslation struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	ProductID   int       `json:"product_id" gorm:"not null;uniqueIndex:idx_product_translation"`
+	Language    string    `json:"language" gorm:"not null;uniqueIndex:idx_product_translation;index"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Purchase order states. A draft can still be edited; once sent to the supplier it is received in one
+// or more deliveries, each of which restocks the receiving warehouse.
+const (
+	PurchaseOrderDraft             = "draft"
+	PurchaseOrderSent              = "sent"
+	PurchaseOrderPartiallyReceived = "partially_received"
+	PurchaseOrderReceived          = "received"
+	PurchaseOrderCancelled         = "cancelled"
+)
+
+// PurchaseOrder buys stock from a supplier for one warehouse.
+type PurchaseOrder struct {
+	gorm.Model
+	SupplierID  int                 `json:"supplier_id" gorm:"not null;index"`
+	WarehouseID int                 `json:"warehouse_id" gorm:"not null;index"`
+	Status      string              `json:"status" gorm:"not null;default:draft;index"`
+	Notes       string              `json:"notes"`
+	CreatedBy   int                 `json:"created_by"`
+	ExpectedAt  *time.Time          `json:"expected_at,omitempty"`
+	SentAt      *time.Time          `json:"sent_at,omitempty"`
+	ReceivedAt  *time.Time          `json:"received_at,omitempty"`
+	Items       []PurchaseOrderItem `json:"items" gorm:"foreignKey:PurchaseOrderID"`
+}
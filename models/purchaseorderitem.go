@@ -0,0 +1,11 @@
+package models
+
+// PurchaseOrderItem is a product ordered from a supplier and how much of it has been delivered.
+type PurchaseOrderItem struct {
+	ID               uint    `json:"id" gorm:"primarykey"`
+	PurchaseOrderID  int     `json:"purchase_order_id" gorm:"not null;index"`
+	ProductID        int     `json:"product_id" gorm:"not null"`
+	Quantity         int     `json:"quantity" gorm:"not null"`
+	ReceivedQuantity int     `json:"received_quantity" gorm:"not null;default:0"`
+	UnitCost         float64 `json:"unit_cost" gorm:"type:decimal(10,2)"`
+}
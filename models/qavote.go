@@ -0,0 +1,17 @@
+package models
+
+import "gorm.io/gorm"
+
+// Targets of a Q&A upvote
+const (
+	QAVoteQuestion = "question"
+	QAVoteAnswer   = "answer"
+)
+
+// QAVote is one user's upvote on a question or an answer. A user can upvote each target once.
+type QAVote struct {
+	gorm.Model
+	TargetType string `json:"target_type" gorm:"not null;uniqueIndex:idx_qa_vote"`
+	TargetID   int    `json:"target_id" gorm:"not null;uniqueIndex:idx_qa_vote"`
+	UserID     int    `json:"user_id" gorm:"not null;uniqueIndex:idx_qa_vote"`
+}
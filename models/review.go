@@ -2,12 +2,24 @@ package models
 
 import "gorm.io/gorm"
 
+// Review moderation states. Only approved reviews are shown publicly and counted toward AverageRating.
+const (
+	ReviewStatusPending  = "pending"
+	ReviewStatusApproved = "approved"
+	ReviewStatusRejected = "rejected"
+)
+
+// A user can leave at most one review per product, enforced by idx_review_product_user.
 type Review struct {
 	gorm.Model
-	ProductID int     `json:"product_id" gorm:"not null"`
-	UserID    int     `json:"user_id" gorm:"not null"`
-	Rating    int     `json:"rating" gorm:"not null"`
-	Comment   string  `json:"comment" gorm:"not null"`
-	Product   Product `json:"product" gorm:"foreignKey:ProductID"`
-	User      User    `json:"user" gorm:"foreignKey:UserID;references:ID"`
+	ProductID        int     `json:"product_id" gorm:"not null;uniqueIndex:idx_review_product_user"`
+	UserID           int     `json:"user_id" gorm:"not null;uniqueIndex:idx_review_product_user"`
+	Rating           int     `json:"rating" gorm:"not null"`
+	Comment          string  `json:"comment" gorm:"not null"`
+	VerifiedPurchase bool    `json:"verified_purchase" gorm:"default:false"`
+	Status           string  `json:"status" gorm:"not null;default:approved;index"`
+	ModerationReason string  `json:"moderation_reason,omitempty"`
+	ReportCount      int     `json:"report_count" gorm:"default:0"`
+	Product          Product `json:"product" gorm:"foreignKey:ProductID"`
+	User             User    `json:"user" gorm:"foreignKey:UserID;references:ID"`
 }
@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// ReviewReport records a customer flagging a review as abusive. A user can report a review only once.
+type ReviewReport struct {
+	gorm.Model
+	ReviewID int    `json:"review_id" gorm:"not null;uniqueIndex:idx_review_report_user"`
+	UserID   int    `json:"user_id" gorm:"not null;uniqueIndex:idx_review_report_user"`
+	Reason   string `json:"reason" gorm:"not null"`
+	Review   Review `json:"-" gorm:"foreignKey:ReviewID"`
+}
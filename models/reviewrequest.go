@@ -0,0 +1,7 @@
+package models
+
+type ReviewRequest struct {
+	UserID  int    `json:"user_id"`
+	Rating  int    `json:"rating"`
+	Comment string `json:"comment"`
+}
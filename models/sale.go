@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sale is a scheduled sale price for a product, active from StartsAt until EndsAt.
+// The recorded flags let the scheduler write price history exactly once when the window opens and closes.
+type Sale struct {
+	gorm.Model
+	ProductID     int       `json:"product_id" gorm:"not null;index"`
+	SalePrice     float64   `json:"sale_price" gorm:"not null"`
+	StartsAt      time.Time `json:"starts_at" gorm:"not null;index"`
+	EndsAt        time.Time `json:"ends_at" gorm:"not null;index"`
+	CreatedBy     int       `json:"created_by"`
+	StartRecorded bool      `json:"-" gorm:"default:false"`
+	EndRecorded   bool      `json:"-" gorm:"default:false"`
+}
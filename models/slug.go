@@ -0,0 +1,73 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const maxSlugLength = 100
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slugify turns a name into a URL slug, e.g. "USB-C Cable (2 m)" becomes "usb-c-cable-2-m".
+func Slugify(name string) string {
+	slug := strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+	}
+	return slug
+}
+
+// ValidateSlug checks that a slug is already in the form Slugify produces.
+func ValidateSlug(slug string) error {
+	if slug == "" || slug != Slugify(slug) {
+		return fmt.Errorf("invalid slug %q: use lowercase letters, digits and single hyphens", slug)
+	}
+	return nil
+}
+
+// assignSlug validates a slug given on create, or derives a unique one from the name when none was given.
+func assignSlug(tx *gorm.DB, slug *string, table, entityType, name, fallback string) error {
+	if *slug != "" {
+		return ValidateSlug(*slug)
+	}
+	generated, err := UniqueSlug(tx, table, entityType, name, fallback)
+	if err != nil {
+		return err
+	}
+	*slug = generated
+	return nil
+}
+
+// UniqueSlug derives a slug from name that no row of table uses, currently or as an old slug,
+// by appending -2, -3 and so on. fallback is used when the name has no usable characters.
+func UniqueSlug(tx *gorm.DB, table, entityType, name, fallback string) (string, error) {
+	base := Slugify(name)
+	if base == "" {
+		base = fallback
+	}
+
+	db := tx.Session(&gorm.Session{NewDB: true})
+	for n := 1; ; n++ {
+		candidate := base
+		if n > 1 {
+			candidate = fmt.Sprintf("%s-%d", base, n)
+		}
+
+		var taken int64
+		if err := db.Table(table).Where("slug = ?", candidate).Count(&taken).Error; err != nil {
+			return "", err
+		}
+		if taken == 0 {
+			if err := db.Model(&SlugRedirect{}).Where("entity_type = ? AND slug = ?", entityType, candidate).Count(&taken).Error; err != nil {
+				return "", err
+			}
+		}
+		if taken == 0 {
+			return candidate, nil
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Slug owners recorded in SlugRedirect
+const (
+	SlugEntityProduct  = "product"
+	SlugEntityCategory = "category"
+)
+
+// SlugRedirect remembers a slug a product or category used to have, so old links redirect to its current slug.
+type SlugRedirect struct {
+	ID         uint      `json:"-" gorm:"primarykey"`
+	EntityType string    `json:"entity_type" gorm:"not null;uniqueIndex:idx_slug_redirect"`
+	Slug       string    `json:"slug" gorm:"not null;uniqueIndex:idx_slug_redirect"`
+	EntityID   int       `json:"entity_id" gorm:"not null;index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Stock movement reasons.
+const (
+	MovementSale               = "sale"                // units taken by an order at checkout
+	MovementReturn             = "return"              // units a customer sent back
+	MovementReservationRelease = "reservation_release" // units held for an order that was never paid, put back in stock
+	MovementAdjustment         = "adjustment"          // correction of the recorded stock
+	MovementTransfer           = "transfer"            // units shipped to, or received from, another warehouse
+	MovementDamage             = "damage"              // units written off as damaged or lost
+	MovementRestock            = "restock"             // units received from a supplier
+)
+
+// Documents a stock movement can refer to.
+const (
+	MovementRefOrder         = "order"
+	MovementRefTransfer      = "transfer_order"
+	MovementRefPurchaseOrder = "purchase_order"
+	MovementRefStockTake     = "stock_take"
+)
+
+// ErrImmutableMovement is returned when a stock movement is updated or deleted.
+var ErrImmutableMovement = errors.New("stock movements cannot be changed")
+
+// StockMovement is an immutable entry of the stock ledger: a change to the stock of a product at one
+// warehouse. Balance is the stock of the location after the movement, so the latest movement of a
+// location is its current stock.
+type StockMovement struct {
+	ID            uint      `json:"id" gorm:"primarykey"`
+	ProductID     int       `json:"product_id" gorm:"not null;index:idx_stock_movements_product_time"`
+	WarehouseID   int       `json:"warehouse_id" gorm:"not null;index"`
+	Reason        string    `json:"reason" gorm:"not null;index"`
+	Delta         int       `json:"delta" gorm:"not null"`
+	Balance       int       `json:"balance" gorm:"not null"`
+	ReferenceType string    `json:"reference_type,omitempty" gorm:"index:idx_stock_movements_reference"`
+	ReferenceID   int       `json:"reference_id,omitempty" gorm:"index:idx_stock_movements_reference"`
+	Note          string    `json:"note,omitempty"`
+	ActorID       int       `json:"actor_id"` // user ID of the actor, 0 for the system
+	CreatedAt     time.Time `json:"created_at" gorm:"index:idx_stock_movements_product_time;index"`
+}
+
+// BeforeUpdate keeps the ledger append-only.
+func (m *StockMovement) BeforeUpdate(tx *gorm.DB) error {
+	return ErrImmutableMovement
+}
+
+// BeforeDelete keeps the ledger append-only.
+func (m *StockMovement) BeforeDelete(tx *gorm.DB) error {
+	return ErrImmutableMovement
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Stock reservation states. A held reservation has taken its units out of the product's sellable
+// quantity; it ends committed when the order is paid, or released or expired when the units go back.
+const (
+	ReservationHeld      = "held"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired"
+)
+
+// StockReservation holds units of a product for an order while its payment is in flight. WarehouseID is
+// the location the units were allocated from. Bundles are reserved as their components, so ProductID is
+// never a bundle.
+type StockReservation struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	OrderID     int       `json:"order_id" gorm:"not null;index"`
+	ProductID   int       `json:"product_id" gorm:"not null;index"`
+	WarehouseID int       `json:"warehouse_id" gorm:"not null;default:0"`
+	Quantity    int       `json:"quantity" gorm:"not null"`
+	Status      string    `json:"status" gorm:"not null;default:held;index:idx_reservation_status_expiry"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"not null;index:idx_reservation_status_expiry"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
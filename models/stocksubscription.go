@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StockSubscription asks to be told when an out-of-stock product is available again.
+// Guests subscribe with an email address only; users are also sent an in-app notification.
+type StockSubscription struct {
+	gorm.Model
+	ProductID  int        `json:"product_id" gorm:"not null;uniqueIndex:idx_stock_subscription"`
+	Email      string     `json:"email" gorm:"not null;uniqueIndex:idx_stock_subscription"`
+	UserID     *int       `json:"user_id,omitempty" gorm:"index"`
+	Token      string     `json:"-" gorm:"not null;uniqueIndex"` // unsubscribe token sent in the email
+	NotifiedAt *time.Time `json:"notified_at,omitempty" gorm:"index"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Stock take states. An open stock take accepts counts; approving it posts the variances to the ledger.
+const (
+	StockTakeOpen      = "open"
+	StockTakeApproved  = "approved"
+	StockTakeCancelled = "cancelled"
+)
+
+// StockTake is a physical count of a set of product locations. Its lines hold the stock expected on the
+// shelf at each location when the stock take was opened and the quantity counted there.
+type StockTake struct {
+	gorm.Model
+	Status     string          `json:"status" gorm:"not null;default:open;index"`
+	Notes      string          `json:"notes"`
+	CreatedBy  int             `json:"created_by"`
+	ApprovedBy int             `json:"approved_by,omitempty"`
+	ApprovedAt *time.Time      `json:"approved_at,omitempty"`
+	Lines      []StockTakeLine `json:"lines,omitempty" gorm:"foreignKey:StockTakeID"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// StockTakeLine is one location of a stock take. CountedQuantity is nil until the location is counted.
+type StockTakeLine struct {
+	ID               uint       `json:"id" gorm:"primarykey"`
+	StockTakeID      int        `json:"stock_take_id" gorm:"not null;uniqueIndex:idx_stock_take_location"`
+	ProductID        int        `json:"product_id" gorm:"not null;uniqueIndex:idx_stock_take_location"`
+	WarehouseID      int        `json:"warehouse_id" gorm:"not null;uniqueIndex:idx_stock_take_location"`
+	ExpectedQuantity int        `json:"expected_quantity" gorm:"not null"`
+	CountedQuantity  *int       `json:"counted_quantity"`
+	CountedBy        int        `json:"counted_by,omitempty"`
+	CountedAt        *time.Time `json:"counted_at,omitempty"`
+}
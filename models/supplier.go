@@ -0,0 +1,17 @@
+package models
+
+import "gorm.io/gorm"
+
+// Supplier is a business stock is bought from with purchase orders. LeadTimeDays is how long its
+// deliveries usually take.
+type Supplier struct {
+	gorm.Model
+	Name         string `json:"name" gorm:"not null"`
+	ContactName  string `json:"contact_name"`
+	Email        string `json:"email"`
+	Phone        string `json:"phone"`
+	Address      string `json:"address"`
+	Currency     string `json:"currency" gorm:"size:3"` // currency of its prices, empty for the store currency
+	LeadTimeDays int    `json:"lead_time_days"`
+	Active       bool   `json:"active" gorm:"not null"`
+}
@@ -6,6 +6,6 @@ import "gorm.io/gorm"
 
 type Tag struct {
 	gorm.Model
-	Name      string     `json:"name" gorm:"not null,index,unique"`
+	Name      string     `json:"name" gorm:"not null;uniqueIndex"`
 	BlogPosts []BlogPost `json:"blog_posts" gorm:"many2many:blog_post_tags"`
 }
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Transfer order states. Stock leaves the source location when a transfer ships and reaches the
+// destination when it is received; in between it cannot be sold from either.
+const (
+	TransferDraft     = "draft"
+	TransferInTransit = "in_transit"
+	TransferReceived  = "received"
+	TransferCancelled = "cancelled"
+)
+
+// TransferOrder moves stock from one warehouse to another.
+type TransferOrder struct {
+	gorm.Model
+	FromWarehouseID int                 `json:"from_warehouse_id" gorm:"not null;index"`
+	ToWarehouseID   int                 `json:"to_warehouse_id" gorm:"not null;index"`
+	Status          string              `json:"status" gorm:"not null;default:draft;index"`
+	Notes           string              `json:"notes"`
+	CreatedBy       int                 `json:"created_by"`
+	ShippedAt       *time.Time          `json:"shipped_at,omitempty"`
+	ReceivedAt      *time.Time          `json:"received_at,omitempty"`
+	Items           []TransferOrderItem `json:"items" gorm:"foreignKey:TransferOrderID"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// TransferOrderItem is a product and quantity moved by a transfer order.
+type TransferOrderItem struct {
+	ID              uint `json:"id" gorm:"primarykey"`
+	TransferOrderID int  `json:"transfer_order_id" gorm:"not null;index"`
+	ProductID       int  `json:"product_id" gorm:"not null"`
+	Quantity        int  `json:"quantity" gorm:"not null"`
+}
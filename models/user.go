@@ -13,6 +13,7 @@ type User struct {
 	Role         string         `json:"role" gorm:"default:customer"` // can be customer or admin or vendor
 	Notification []Notification `json:"notification" gorm:"foreignKey:ID"`
 	DeviceToken  string         `json:"device_token"`
+	Currency     string         `json:"currency" gorm:"size:3"` // preferred presentment currency, empty for the store default
 
 	// Vendor-specific fields. The check constraint only applies when the role is "vendor". Otherwise, these fields can be null ('')
 	CompanyName     string `json:"company_name,omitempty"`
@@ -0,0 +1,18 @@
+package models
+
+import "gorm.io/gorm"
+
+// Warehouse is a stock location orders are shipped from. Latitude and Longitude place it for
+// closest-location allocation; Priority orders locations for priority allocation, lowest first.
+type Warehouse struct {
+	gorm.Model
+	Code      string  `json:"code" gorm:"not null;uniqueIndex"`
+	Name      string  `json:"name" gorm:"not null"`
+	Address   string  `json:"address"`
+	City      string  `json:"city"`
+	Country   string  `json:"country" gorm:"size:2"` // ISO 3166-1 alpha-2
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Priority  int     `json:"priority" gorm:"not null;default:0"`
+	Active    bool    `json:"active" gorm:"not null"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// Wishlist is a named list of products a user wants to buy later. Public wishlists can be viewed by
+// anyone holding their share token.
+type Wishlist struct {
+	gorm.Model
+	UserID     int            `json:"user_id" gorm:"not null;index"`
+	Name       string         `json:"name" gorm:"not null"`
+	IsPublic   bool           `json:"is_public" gorm:"not null;default:false"`
+	ShareToken *string        `json:"share_token,omitempty" gorm:"uniqueIndex"` // set while the wishlist is public
+	Items      []WishlistItem `json:"items" gorm:"foreignKey:WishlistID"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// WishlistItem is a product on a wishlist. Prices are in the base currency.
+type WishlistItem struct {
+	gorm.Model
+	WishlistID        int      `json:"wishlist_id" gorm:"not null;uniqueIndex:idx_wishlist_product"`
+	ProductID         int      `json:"product_id" gorm:"not null;uniqueIndex:idx_wishlist_product"`
+	PriceWhenAdded    float64  `json:"price_when_added" gorm:"not null"` // effective price when the product was added
+	LastNotifiedPrice *float64 `json:"last_notified_price,omitempty"`    // price of the last price-drop alert
+	Product           Product  `json:"product" gorm:"foreignKey:ProductID"`
+}
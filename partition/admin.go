@@ -1,16 +1,22 @@
 package partition
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/go-redis/redis"
 	"github.com/gorilla/mux"
+	"github.com/theinvincible/ecommerce-backend/cache"
 	"github.com/theinvincible/ecommerce-backend/config"
 	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
 	"github.com/theinvincible/ecommerce-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func AdminHandler(w http.ResponseWriter, r *http.Request) {
@@ -31,55 +37,38 @@ func AdminMiddleware(next http.Handler) http.Handler {
 }
 
 func AdminDashboardHandler(w http.ResponseWriter, r *http.Request) {
-	var dashboardData map[string]interface{}
-	cacheKey := "admin_dashboard"
-
-	// Create a context with a timeout for Redis operations
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Attempt to get the cached dashboard data from Redis
-	cachedData, err := utils.InitRedisClient().Get(ctx, cacheKey).Result()
-	if err == redis.Nil {
-		// Cache miss: Fetch from the database
+	// Counts are cached for a minute; a stale copy is served for another minute while one request recounts
+	opts := cache.Options{TTL: time.Minute, Stale: time.Minute}
+	dashboardJSON, err := cache.Fetch(r.Context(), "admin_dashboard", opts, func() ([]byte, []string, error) {
 		var userCount, productCount, orderCount int64
 
 		if err := config.DB.Model(&models.User{}).Count(&userCount).Error; err != nil {
-			http.Error(w, "Failed to retrieve user count", http.StatusInternalServerError)
-			return
+			return nil, nil, err
 		}
 
 		if err := config.DB.Model(&models.Product{}).Count(&productCount).Error; err != nil {
-			http.Error(w, "Failed to retrieve product count", http.StatusInternalServerError)
-			return
+			return nil, nil, err
 		}
 
 		if err := config.DB.Model(&models.Order{}).Count(&orderCount).Error; err != nil {
-			http.Error(w, "Failed to retrieve order count", http.StatusInternalServerError)
-			return
+			return nil, nil, err
 		}
 
-		dashboardData = map[string]interface{}{
+		dashboardJSON, err := json.Marshal(map[string]interface{}{
 			"userCount":    userCount,
 			"productCount": productCount,
 			"orderCount":   orderCount,
-		}
-
-		// Cache the data in Redis with an expiration time
-		jsonData, _ := json.Marshal(dashboardData)
-		utils.InitRedisClient().Set(ctx, cacheKey, jsonData, time.Minute)
-	} else if err != nil {
-		// Redis error
+		})
+		return dashboardJSON, nil, err
+	})
+	if err != nil {
 		http.Error(w, "Failed to retrieve data", http.StatusInternalServerError)
 		return
-	} else {
-		// Cache hit: Unmarshal the cached data
-		json.Unmarshal([]byte(cachedData), &dashboardData)
 	}
 
 	// Return the data as JSON
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(dashboardData)
+	w.Write(dashboardJSON)
 }
 
 // <=============================================User Management=============================================>
@@ -131,10 +120,29 @@ func AddProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := config.DB.Create(&product).Error; err != nil {
+	if err := services.ValidateProductLifecycle(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := services.ValidatePricing(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+		if err := services.RecordPriceChange(tx, nil, &product, utils.ActorID(r), "admin"); err != nil {
+			return err
+		}
+		return services.RecordStockChange(tx, nil, &product, utils.ActorID(r))
+	})
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	services.InvalidateProductCache(int(product.ID))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Product added successfully"})
@@ -147,10 +155,48 @@ func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := config.DB.Save(&product).Error; err != nil {
+	if err := services.ValidateProductLifecycle(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := services.ValidatePricing(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var previous *models.Product
+	var existing models.Product
+	if product.ID != 0 && config.DB.First(&existing, product.ID).Error == nil {
+		previous = &existing
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if previous != nil {
+			if err := services.ReconcileSlug(tx, models.SlugEntityProduct, int(product.ID), previous.Slug, &product.Slug); err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(&product).Error; err != nil {
+			return err
+		}
+		if err := services.RecordPriceChange(tx, previous, &product, utils.ActorID(r), "admin"); err != nil {
+			return err
+		}
+		return services.RecordStockChange(tx, previous, &product, utils.ActorID(r))
+	})
+	if errors.Is(err, services.ErrSlugTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	services.InvalidateProductCache(int(product.ID))
+	if previous != nil && previous.CategoryID != product.CategoryID {
+		services.InvalidateCategoryCache(previous.CategoryID)
+	}
+	services.NotifyIfRestocked(previous, &product)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Product updated successfully"})
@@ -162,38 +208,1688 @@ func DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if productID, err := strconv.Atoi(id); err == nil {
+		services.InvalidateProductCache(productID)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Product deleted successfully"})
 }
 
-// <=============================================Order Management=============================================>
+// <=============================================Pricing Management=============================================>
 
-func GetOrdersHandler(w http.ResponseWriter, r *http.Request) {
-	var orders []models.Order
-	if err := config.DB.Find(&orders).Error; err != nil {
+// CreateSaleHandler schedules a sale price for a product between starts_at and ends_at.
+func CreateSaleHandler(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if err := config.DB.First(&product, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var sale models.Sale
+	if err := json.NewDecoder(r.Body).Decode(&sale); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	sale.ID = 0
+	sale.ProductID = int(product.ID)
+	sale.CreatedBy = utils.ActorID(r)
+
+	if err := services.ValidateSale(config.DB, &product, &sale); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := config.DB.Create(&sale).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A sale starting immediately is picked up right away instead of on the next scheduler tick
+	if err := services.ApplySaleWindows(); err != nil {
+		log.Printf("Error applying sale windows: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sale)
+}
+
+// GetSalesHandler lists the scheduled, running and past sales of a product.
+func GetSalesHandler(w http.ResponseWriter, r *http.Request) {
+	var sales []models.Sale
+	if err := config.DB.Where("product_id = ?", mux.Vars(r)["id"]).Order("starts_at desc").Find(&sales).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(orders)
+	json.NewEncoder(w).Encode(sales)
 }
 
-func UpdateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
-	var order models.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+// DeleteSaleHandler cancels a sale. A running sale ends immediately.
+func DeleteSaleHandler(w http.ResponseWriter, r *http.Request) {
+	var sale models.Sale
+	if err := config.DB.First(&sale, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Sale not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	if sale.StartsAt.After(now) {
+		// Never started, so there is no price history to close off
+		if err := config.DB.Delete(&sale).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if sale.EndsAt.After(now) {
+		if err := config.DB.Model(&sale).Update("ends_at", now).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := services.ApplySaleWindows(); err != nil {
+			log.Printf("Error applying sale windows: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Sale cancelled successfully"})
+}
+
+// GetPriceHistoryHandler returns every recorded price change of a product, newest first.
+func GetPriceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	var history []models.PriceHistory
+	if err := config.DB.Where("product_id = ?", mux.Vars(r)["id"]).Order("created_at desc, id desc").Find(&history).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// <=============================================Currency Management=============================================>
+
+// UpsertCurrencyHandler creates or updates the presentment and rounding rules of a currency. Decimals
+// default to the ISO 4217 minor units of the currency, and a currency is enabled unless told otherwise.
+func UpsertCurrencyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Symbol            string  `json:"symbol"`
+		Decimals          *int    `json:"decimals"`
+		RoundingIncrement float64 `json:"rounding_increment"`
+		Enabled           *bool   `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
+	currency := models.Currency{
+		Code:              strings.ToUpper(mux.Vars(r)["code"]),
+		Symbol:            req.Symbol,
+		Decimals:          services.MinorUnits(mux.Vars(r)["code"]),
+		RoundingIncrement: req.RoundingIncrement,
+		Enabled:           true,
+	}
+	if req.Decimals != nil {
+		currency.Decimals = *req.Decimals
+	}
+	if req.Enabled != nil {
+		currency.Enabled = *req.Enabled
+	}
 
-	if err := config.DB.Save(&order).Error; err != nil {
+	if len(currency.Code) != 3 {
+		http.Error(w, "Currency code must be a 3-letter ISO 4217 code", http.StatusBadRequest)
+		return
+	}
+	if currency.Decimals < 0 || currency.Decimals > 4 || currency.RoundingIncrement < 0 {
+		http.Error(w, "Invalid rounding rules", http.StatusBadRequest)
+		return
+	}
+
+	if err := config.DB.Save(&currency).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Order status updated successfully"})
+	json.NewEncoder(w).Encode(currency)
+}
+
+// RefreshExchangeRatesHandler fetches exchange rates from the configured source immediately.
+func RefreshExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	if services.RateSourceFromEnv() == nil {
+		http.Error(w, "No exchange rate source configured", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.RefreshExchangeRates(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Exchange rates refreshed successfully"})
+}
+
+// SetProductCurrencyPriceHandler fixes a product's regular price in a currency instead of converting it.
+func SetProductCurrencyPriceHandler(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if err := config.DB.First(&product, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Price float64 `json:"price"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Price <= 0 {
+		http.Error(w, "A positive price is required", http.StatusBadRequest)
+		return
+	}
+
+	currency := strings.ToUpper(mux.Vars(r)["currency"])
+	if currency == services.BaseCurrency() {
+		http.Error(w, "Use the product price for the base currency", http.StatusBadRequest)
+		return
+	}
+	if _, err := services.NewConverter(config.DB, currency); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	override := models.ProductCurrencyPrice{ProductID: int(product.ID), Currency: currency}
+	if err := config.DB.Where(&override).Assign(models.ProductCurrencyPrice{Price: req.Price}).FirstOrCreate(&override).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(override)
+}
+
+// DeleteProductCurrencyPriceHandler removes a fixed price so the product price is converted again.
+func DeleteProductCurrencyPriceHandler(w http.ResponseWriter, r *http.Request) {
+	currency := strings.ToUpper(mux.Vars(r)["currency"])
+	if err := config.DB.Unscoped().Where("product_id = ? AND currency = ?", mux.Vars(r)["id"], currency).Delete(&models.ProductCurrencyPrice{}).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Currency price removed successfully"})
+}
+
+// <=============================================Product Tags=============================================>
+
+// ProductTagsRequest is the body for replacing a product's tags.
+type ProductTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// SetProductTagsHandler replaces the tags of a product, creating tags that do not exist yet.
+func SetProductTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if err := config.DB.First(&product, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var req ProductTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tags, err := services.SetProductTags(config.DB, int(product.ID), req.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	services.InvalidateProductCache(int(product.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"product_id": product.ID, "tags": tags})
+}
+
+// DeleteProductTagHandler removes one tag from a product.
+func DeleteProductTagHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	removed, err := services.RemoveProductTag(config.DB, productID, mux.Vars(r)["tag"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !removed {
+		http.Error(w, "Product does not have this tag", http.StatusNotFound)
+		return
+	}
+	services.InvalidateProductCache(productID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Tag removed"})
+}
+
+// <=============================================Translations=============================================>
+
+// TranslationRequest is the body for setting a product or category translation.
+type TranslationRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// GetProductTranslationsHandler lists the translations of a product.
+func GetProductTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	var translations []models.ProductTranslation
+	if err := config.DB.Where("product_id = ?", mux.Vars(r)["id"]).Order("language").Find(&translations).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(translations)
+}
+
+// SetProductTranslationHandler sets a product's name and description in the language of the URL.
+func SetProductTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if err := config.DB.First(&product, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	translation, err := services.SetProductTranslation(config.DB, int(product.ID), mux.Vars(r)["lang"], req.Name, req.Description)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	services.InvalidateProductCache(int(product.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(translation)
+}
+
+// DeleteProductTranslationHandler removes a product's translation into the language of the URL.
+func DeleteProductTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	language, err := services.NormaliseLanguage(mux.Vars(r)["lang"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := config.DB.Where("product_id = ? AND language = ?", productID, language).Delete(&models.ProductTranslation{})
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Translation not found", http.StatusNotFound)
+		return
+	}
+	services.InvalidateProductCache(productID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Translation deleted successfully"})
+}
+
+// GetCategoryTranslationsHandler lists the translations of a category.
+func GetCategoryTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	var translations []models.CategoryTranslation
+	if err := config.DB.Where("category_id = ?", mux.Vars(r)["id"]).Order("language").Find(&translations).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(translations)
+}
+
+// SetCategoryTranslationHandler sets a category's name in the language of the URL.
+func SetCategoryTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	var category models.Category
+	if err := config.DB.First(&category, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	var req TranslationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	translation, err := services.SetCategoryTranslation(config.DB, int(category.ID), mux.Vars(r)["lang"], req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(translation)
+}
+
+// DeleteCategoryTranslationHandler removes a category's translation into the language of the URL.
+func DeleteCategoryTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	language, err := services.NormaliseLanguage(mux.Vars(r)["lang"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := config.DB.Where("category_id = ? AND language = ?", mux.Vars(r)["id"], language).Delete(&models.CategoryTranslation{})
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "Translation not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Translation deleted successfully"})
+}
+
+// <=============================================Category Attribute Management=============================================>
+
+// AddCategoryAttributeHandler adds an attribute to a category's schema.
+func AddCategoryAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	var category models.Category
+	if err := config.DB.First(&category, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	var attribute models.CategoryAttribute
+	if err := json.NewDecoder(r.Body).Decode(&attribute); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	attribute.CategoryID = int(category.ID)
+
+	if err := services.ValidateCategoryAttribute(&attribute); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := config.DB.Create(&attribute).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attribute)
+}
+
+// UpdateCategoryAttributeHandler updates an attribute definition. The attribute name and type cannot change
+// because stored product values depend on them.
+func UpdateCategoryAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	var attribute models.CategoryAttribute
+	if err := config.DB.Where("id = ? AND category_id = ?", mux.Vars(r)["attributeID"], mux.Vars(r)["id"]).First(&attribute).Error; err != nil {
+		http.Error(w, "Attribute not found", http.StatusNotFound)
+		return
+	}
+
+	id, categoryID, name, attributeType := attribute.ID, attribute.CategoryID, attribute.Name, attribute.Type
+	if err := json.NewDecoder(r.Body).Decode(&attribute); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	attribute.ID, attribute.CategoryID, attribute.Name, attribute.Type = id, categoryID, name, attributeType
+
+	if err := services.ValidateCategoryAttribute(&attribute); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := config.DB.Save(&attribute).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attribute)
+}
+
+// DeleteCategoryAttributeHandler removes an attribute and every product value stored for it.
+func DeleteCategoryAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	var attribute models.CategoryAttribute
+	if err := config.DB.Where("id = ? AND category_id = ?", mux.Vars(r)["attributeID"], mux.Vars(r)["id"]).First(&attribute).Error; err != nil {
+		http.Error(w, "Attribute not found", http.StatusNotFound)
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("attribute_id = ?", attribute.ID).Delete(&models.ProductAttributeValue{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&attribute).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Attribute deleted successfully"})
+}
+
+// GetAllProductsHandler lists products in any lifecycle state, optionally filtered by status.
+func GetAllProductsHandler(w http.ResponseWriter, r *http.Request) {
+	query := config.DB.Model(&models.Product{})
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var products []models.Product
+	if err := query.Order("updated_at desc").Find(&products).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(products)
+}
+
+// PreviewProductHandler returns a product in any lifecycle state. It bypasses the cache so drafts are never cached.
+func PreviewProductHandler(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if err := config.DB.First(&product, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// SetProductStatusHandler changes a product's lifecycle state and its publish/unpublish schedule.
+func SetProductStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if err := config.DB.First(&product, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Status      string     `json:"status"`
+		PublishAt   *time.Time `json:"publish_at"`
+		UnpublishAt *time.Time `json:"unpublish_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if req.Status != "" {
+		product.Status = req.Status
+	}
+	product.PublishAt = req.PublishAt
+	product.UnpublishAt = req.UnpublishAt
+
+	if err := services.ValidateProductLifecycle(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := config.DB.Model(&product).Select("status", "publish_at", "unpublish_at").Updates(&product).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	services.InvalidateProductCache(int(product.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// SetBundleComponentsHandler replaces the components of a bundle, turning the product into a bundle if needed.
+func SetBundleComponentsHandler(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if err := config.DB.First(&product, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var components []models.BundleComponent
+	if err := json.NewDecoder(r.Body).Decode(&components); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.SetBundleComponents(config.DB, &product, components); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	services.InvalidateProductCache(int(product.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(components)
+}
+
+// GetStockSubscriptionsHandler returns how many shoppers are waiting for a product and how many were notified.
+func GetStockSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var waiting, notified int64
+	if err := config.DB.Model(&models.StockSubscription{}).Where("product_id = ? AND notified_at IS NULL", id).Count(&waiting).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := config.DB.Model(&models.StockSubscription{}).Where("product_id = ? AND notified_at IS NOT NULL", id).Count(&notified).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{
+		"waiting":  waiting,
+		"notified": notified,
+	})
+}
+
+// <=============================================Warehouses=============================================>
+
+// GetWarehousesHandler lists the warehouses, highest priority first.
+func GetWarehousesHandler(w http.ResponseWriter, r *http.Request) {
+	var warehouses []models.Warehouse
+	if err := config.DB.Order("priority, id").Find(&warehouses).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(warehouses)
+}
+
+// CreateWarehouseHandler adds a warehouse.
+func CreateWarehouseHandler(w http.ResponseWriter, r *http.Request) {
+	// Active unless the request says otherwise
+	warehouse := models.Warehouse{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&warehouse); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	warehouse.ID = 0
+	warehouse.Code = strings.ToUpper(strings.TrimSpace(warehouse.Code))
+	warehouse.Country = strings.ToUpper(warehouse.Country)
+	if warehouse.Code == "" || warehouse.Name == "" {
+		http.Error(w, "code and name are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := config.DB.Create(&warehouse).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(warehouse)
+}
+
+// UpdateWarehouseHandler updates a warehouse. Inactive warehouses keep their stock but are not allocated from.
+func UpdateWarehouseHandler(w http.ResponseWriter, r *http.Request) {
+	var warehouse models.Warehouse
+	if err := config.DB.First(&warehouse, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Warehouse not found", http.StatusNotFound)
+		return
+	}
+	id, createdAt := warehouse.ID, warehouse.CreatedAt
+
+	if err := json.NewDecoder(r.Body).Decode(&warehouse); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	warehouse.ID, warehouse.CreatedAt = id, createdAt
+	warehouse.Code = strings.ToUpper(strings.TrimSpace(warehouse.Code))
+	warehouse.Country = strings.ToUpper(warehouse.Country)
+
+	if err := config.DB.Save(&warehouse).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(warehouse)
+}
+
+// GetProductInventoryHandler lists the stock of a product at each warehouse.
+func GetProductInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	var inventories []models.Inventory
+	if err := config.DB.Preload("Warehouse").Where("product_id = ?", mux.Vars(r)["id"]).Order("warehouse_id").Find(&inventories).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inventories)
+}
+
+// SetProductInventoryHandler sets the quantity, reorder level and stock level of a product at a warehouse.
+func SetProductInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	warehouseID, err := strconv.Atoi(mux.Vars(r)["warehouseID"])
+	if err != nil {
+		http.Error(w, "Warehouse not found", http.StatusNotFound)
+		return
+	}
+
+	var inventory models.Inventory
+	if err := json.NewDecoder(r.Body).Decode(&inventory); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	saved, err := services.SetLocationStock(config.DB, productID, warehouseID, inventory, utils.ActorID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// GetOrderAllocationsHandler lists the warehouses an order's stock was allocated from.
+func GetOrderAllocationsHandler(w http.ResponseWriter, r *http.Request) {
+	var reservations []models.StockReservation
+	if err := config.DB.Where("order_id = ?", mux.Vars(r)["id"]).Order("warehouse_id, product_id").Find(&reservations).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reservations)
+}
+
+// <=============================================Transfer Orders=============================================>
+
+// CreateTransferOrderHandler creates a draft transfer of stock between two warehouses.
+func CreateTransferOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var transfer models.TransferOrder
+	if err := json.NewDecoder(r.Body).Decode(&transfer); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	transfer.CreatedBy = utils.ActorID(r)
+
+	if err := services.CreateTransferOrder(config.DB, &transfer); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// GetTransferOrdersHandler lists transfer orders, newest first, optionally by ?status=.
+func GetTransferOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	query := config.DB.Preload("Items").Order("created_at desc")
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var transfers []models.TransferOrder
+	if err := query.Find(&transfers).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfers)
+}
+
+// GetTransferOrderHandler returns a transfer order with its items.
+func GetTransferOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var transfer models.TransferOrder
+	if err := config.DB.Preload("Items").First(&transfer, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Transfer order not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfer)
+}
+
+// transferAction runs a transfer order status change and writes the result.
+func transferAction(move func(db *gorm.DB, transferID, actorID int) (*models.TransferOrder, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transferID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Transfer order not found", http.StatusNotFound)
+			return
+		}
+
+		transfer, err := move(config.DB, transferID, utils.ActorID(r))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Transfer order not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, services.ErrTransferState) || errors.Is(err, services.ErrInsufficientStock) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(transfer)
+	}
+}
+
+// ShipTransferOrderHandler takes a draft transfer's items out of the source warehouse.
+var ShipTransferOrderHandler = transferAction(services.ShipTransferOrder)
+
+// ReceiveTransferOrderHandler puts a transfer's items into the destination warehouse.
+var ReceiveTransferOrderHandler = transferAction(services.ReceiveTransferOrder)
+
+// CancelTransferOrderHandler cancels a transfer, returning shipped items to the source warehouse.
+var CancelTransferOrderHandler = transferAction(services.CancelTransferOrder)
+
+// <=============================================Suppliers and Purchase Orders=============================================>
+
+// GetSuppliersHandler lists the suppliers by name.
+func GetSuppliersHandler(w http.ResponseWriter, r *http.Request) {
+	var suppliers []models.Supplier
+	if err := config.DB.Order("name, id").Find(&suppliers).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suppliers)
+}
+
+// CreateSupplierHandler adds a supplier.
+func CreateSupplierHandler(w http.ResponseWriter, r *http.Request) {
+	// Active unless the request says otherwise
+	supplier := models.Supplier{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&supplier); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	supplier.ID = 0
+	supplier.Currency = strings.ToUpper(supplier.Currency)
+	if strings.TrimSpace(supplier.Name) == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := config.DB.Create(&supplier).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(supplier)
+}
+
+// UpdateSupplierHandler updates a supplier. Inactive suppliers keep their purchase orders but cannot get new ones.
+func UpdateSupplierHandler(w http.ResponseWriter, r *http.Request) {
+	var supplier models.Supplier
+	if err := config.DB.First(&supplier, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Supplier not found", http.StatusNotFound)
+		return
+	}
+	id, createdAt := supplier.ID, supplier.CreatedAt
+
+	if err := json.NewDecoder(r.Body).Decode(&supplier); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	supplier.ID, supplier.CreatedAt = id, createdAt
+	supplier.Currency = strings.ToUpper(supplier.Currency)
+
+	if err := config.DB.Save(&supplier).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(supplier)
+}
+
+// CreatePurchaseOrderHandler creates a draft purchase order.
+func CreatePurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var order models.PurchaseOrder
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	order.CreatedBy = utils.ActorID(r)
+
+	if err := services.CreatePurchaseOrder(config.DB, &order); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// GetPurchaseOrdersHandler lists purchase orders, newest first, optionally by ?status= and ?supplier_id=.
+func GetPurchaseOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	query := config.DB.Preload("Items").Order("created_at desc")
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if supplierID := r.URL.Query().Get("supplier_id"); supplierID != "" {
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+
+	var orders []models.PurchaseOrder
+	if err := query.Find(&orders).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// GetPurchaseOrderHandler returns a purchase order with its items.
+func GetPurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var order models.PurchaseOrder
+	if err := config.DB.Preload("Items").First(&order, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Purchase order not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// writePurchaseOrderResult writes a purchase order after a change, or the error that stopped it.
+func writePurchaseOrderResult(w http.ResponseWriter, order *models.PurchaseOrder, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Purchase order not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, services.ErrPurchaseOrderState) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// UpdatePurchaseOrderHandler replaces the supplier, warehouse and items of a draft purchase order.
+func UpdatePurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Purchase order not found", http.StatusNotFound)
+		return
+	}
+	var changes models.PurchaseOrder
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	order, err := services.UpdatePurchaseOrder(config.DB, orderID, &changes)
+	writePurchaseOrderResult(w, order, err)
+}
+
+// SendPurchaseOrderHandler sends a draft purchase order to its supplier.
+func SendPurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Purchase order not found", http.StatusNotFound)
+		return
+	}
+
+	order, err := services.SendPurchaseOrder(config.DB, orderID)
+	writePurchaseOrderResult(w, order, err)
+}
+
+// ReceivePurchaseOrderHandler books a delivery of the given lines, or of everything outstanding when
+// the body has none, restocking the receiving warehouse.
+func ReceivePurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Purchase order not found", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Lines []services.ReceiptLine `json:"lines"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	order, err := services.ReceivePurchaseOrder(config.DB, orderID, req.Lines, utils.ActorID(r))
+	writePurchaseOrderResult(w, order, err)
+}
+
+// CancelPurchaseOrderHandler cancels a purchase order nothing has been received on.
+func CancelPurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Purchase order not found", http.StatusNotFound)
+		return
+	}
+
+	order, err := services.CancelPurchaseOrder(config.DB, orderID)
+	writePurchaseOrderResult(w, order, err)
+}
+
+// GetLowStockHandler lists the locations at or below their reorder level, optionally for one ?vendor_id=.
+func GetLowStockHandler(w http.ResponseWriter, r *http.Request) {
+	var vendorID uint64
+	if value := r.URL.Query().Get("vendor_id"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid vendor_id", http.StatusBadRequest)
+			return
+		}
+		vendorID = parsed
+	}
+
+	lines, err := services.LowStock(config.DB, uint(vendorID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lines)
+}
+
+// <=============================================Stock Ledger=============================================>
+
+// StockMovementRequest records a stock movement by hand, e.g. damaged units or a delivery.
+type StockMovementRequest struct {
+	WarehouseID   int    `json:"warehouse_id"`
+	Reason        string `json:"reason"`
+	Delta         int    `json:"delta"`
+	ReferenceType string `json:"reference_type"`
+	ReferenceID   int    `json:"reference_id"`
+	Note          string `json:"note"`
+}
+
+// RecordStockMovementHandler posts a return, adjustment, damage or restock movement of a product.
+func RecordStockMovementHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var req StockMovementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if !services.ManualMovementReasons[req.Reason] {
+		http.Error(w, "reason must be return, adjustment, damage or restock", http.StatusBadRequest)
+		return
+	}
+	if req.Delta == 0 {
+		http.Error(w, "delta cannot be 0", http.StatusBadRequest)
+		return
+	}
+	if err := config.DB.First(&models.Warehouse{}, req.WarehouseID).Error; err != nil {
+		http.Error(w, "Warehouse not found", http.StatusBadRequest)
+		return
+	}
+
+	movement := models.StockMovement{
+		ProductID:     productID,
+		WarehouseID:   req.WarehouseID,
+		Reason:        req.Reason,
+		Delta:         req.Delta,
+		ReferenceType: req.ReferenceType,
+		ReferenceID:   req.ReferenceID,
+		Note:          req.Note,
+		ActorID:       utils.ActorID(r),
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		return services.PostStockMovement(tx, &movement)
+	})
+	if errors.Is(err, services.ErrInsufficientStock) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	services.InvalidateProductCache(productID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(movement)
+}
+
+// GetStockMovementsHandler lists the stock movements of a product, newest first, optionally by
+// ?warehouse_id=, ?reason= and a ?from= and ?to= time range (RFC 3339), paged with ?page= and ?limit=.
+func GetStockMovementsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := services.StockMovementFilter{Reason: query.Get("reason")}
+	if warehouseID := query.Get("warehouse_id"); warehouseID != "" {
+		if filter.WarehouseID, err = strconv.Atoi(warehouseID); err != nil {
+			http.Error(w, "Invalid warehouse_id", http.StatusBadRequest)
+			return
+		}
+	}
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			http.Error(w, "from must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			http.Error(w, "to must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, limit := 1, 50
+	if value, err := strconv.Atoi(query.Get("page")); err == nil && value > 0 {
+		page = value
+	}
+	if value, err := strconv.Atoi(query.Get("limit")); err == nil && value > 0 {
+		limit = min(value, 500)
+	}
+
+	movements, total, err := services.ProductStockMovements(config.DB, productID, filter, (page-1)*limit, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"movements": movements,
+		"page":      page,
+		"limit":     limit,
+		"total":     total,
+	})
+}
+
+// GetStockValuationHandler reports the stock on hand and its value at ?at= (RFC 3339, default now),
+// optionally for one ?warehouse_id=.
+func GetStockValuationHandler(w http.ResponseWriter, r *http.Request) {
+	at := time.Now()
+	if value := r.URL.Query().Get("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "at must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		at = parsed
+	}
+	warehouseID := 0
+	if value := r.URL.Query().Get("warehouse_id"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid warehouse_id", http.StatusBadRequest)
+			return
+		}
+		warehouseID = parsed
+	}
+
+	valuation, err := services.ValueStock(config.DB, at, warehouseID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(valuation)
+}
+
+// <=============================================Stock Takes=============================================>
+
+// CreateStockTakeHandler opens a stock take of the given product_ids and/or warehouse_ids.
+func CreateStockTakeHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		services.StockTakeScope
+		Notes string `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	stockTake, err := services.OpenStockTake(config.DB, req.StockTakeScope, req.Notes, utils.ActorID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(stockTake)
+}
+
+// GetStockTakesHandler lists stock takes without their lines, newest first, optionally by ?status=.
+func GetStockTakesHandler(w http.ResponseWriter, r *http.Request) {
+	query := config.DB.Order("created_at desc")
+	if status := r.URL.Query().Get("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var stockTakes []models.StockTake
+	if err := query.Find(&stockTakes).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stockTakes)
+}
+
+// GetStockTakeHandler returns a stock take with its lines.
+func GetStockTakeHandler(w http.ResponseWriter, r *http.Request) {
+	var stockTake models.StockTake
+	if err := config.DB.Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("warehouse_id, product_id")
+	}).First(&stockTake, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Stock take not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stockTake)
+}
+
+// writeStockTakeResult writes a stock take after a change, or the error that stopped it.
+func writeStockTakeResult(w http.ResponseWriter, stockTake *models.StockTake, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Stock take not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, services.ErrStockTakeState) || errors.Is(err, services.ErrInsufficientStock) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stockTake)
+}
+
+// RecordStockCountsHandler stores counted quantities on an open stock take, either as JSON
+// {"counts": [...]} or as a CSV file sent with Content-Type text/csv.
+func RecordStockCountsHandler(w http.ResponseWriter, r *http.Request) {
+	stockTakeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Stock take not found", http.StatusNotFound)
+		return
+	}
+
+	var counts []services.StockCount
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		if counts, err = services.ParseStockCountsCSV(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		var req struct {
+			Counts []services.StockCount `json:"counts"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		counts = req.Counts
+	}
+
+	stockTake, err := services.RecordStockCounts(config.DB, stockTakeID, counts, utils.ActorID(r))
+	writeStockTakeResult(w, stockTake, err)
+}
+
+// GetStockTakeVarianceHandler reports the variance between the expected and counted stock of a stock take.
+func GetStockTakeVarianceHandler(w http.ResponseWriter, r *http.Request) {
+	stockTakeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Stock take not found", http.StatusNotFound)
+		return
+	}
+
+	report, err := services.StockTakeVariance(config.DB, stockTakeID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Stock take not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// ApproveStockTakeHandler posts the variances of a fully counted stock take as adjustments.
+func ApproveStockTakeHandler(w http.ResponseWriter, r *http.Request) {
+	stockTakeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Stock take not found", http.StatusNotFound)
+		return
+	}
+
+	stockTake, err := services.ApproveStockTake(config.DB, stockTakeID, utils.ActorID(r))
+	writeStockTakeResult(w, stockTake, err)
+}
+
+// CancelStockTakeHandler abandons an open stock take.
+func CancelStockTakeHandler(w http.ResponseWriter, r *http.Request) {
+	stockTakeID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Stock take not found", http.StatusNotFound)
+		return
+	}
+
+	stockTake, err := services.CancelStockTake(config.DB, stockTakeID)
+	writeStockTakeResult(w, stockTake, err)
+}
+
+// <=============================================Digital Products=============================================>
+
+// SetDigitalAssetHandler attaches the downloadable file to a product and makes it a digital product.
+func SetDigitalAssetHandler(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if err := config.DB.First(&product, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if product.Type == models.ProductTypeBundle {
+		http.Error(w, "A bundle cannot be a digital product", http.StatusBadRequest)
+		return
+	}
+
+	var asset models.DigitalAsset
+	if err := json.NewDecoder(r.Body).Decode(&asset); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if asset.FilePath == "" {
+		http.Error(w, "file_path is required", http.StatusBadRequest)
+		return
+	}
+	if asset.MaxDownloads < 1 {
+		asset.MaxDownloads = 5
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var existing models.DigitalAsset
+		if err := tx.Where("product_id = ?", product.ID).First(&existing).Error; err == nil {
+			asset.ID = existing.ID
+			asset.CreatedAt = existing.CreatedAt
+		}
+		asset.ProductID = int(product.ID)
+		if err := tx.Save(&asset).Error; err != nil {
+			return err
+		}
+		return tx.Model(&product).UpdateColumn("type", models.ProductTypeDigital).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	services.InvalidateProductCache(int(product.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(asset)
+}
+
+// AddLicenceKeysHandler adds keys to a digital product's licence-key pool. Keys already in a pool are skipped.
+func AddLicenceKeysHandler(w http.ResponseWriter, r *http.Request) {
+	var product models.Product
+	if err := config.DB.First(&product, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if product.Type != models.ProductTypeDigital {
+		http.Error(w, "Licence keys can only be added to digital products", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Keys []string `json:"keys"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var keys []models.LicenceKey
+	for _, key := range req.Keys {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, models.LicenceKey{ProductID: int(product.ID), Key: key})
+		}
+	}
+	if len(keys) == 0 {
+		http.Error(w, "No licence keys given", http.StatusBadRequest)
+		return
+	}
+
+	result := config.DB.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "key"}}, DoNothing: true}).Create(&keys)
+	if result.Error != nil {
+		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"added":   result.RowsAffected,
+		"skipped": int64(len(keys)) - result.RowsAffected,
+	})
+}
+
+// GetLicenceKeyStockHandler returns how many keys in a product's pool are still available.
+func GetLicenceKeyStockHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var available, assigned int64
+	if err := config.DB.Model(&models.LicenceKey{}).Where("product_id = ? AND order_item_id IS NULL", id).Count(&available).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := config.DB.Model(&models.LicenceKey{}).Where("product_id = ? AND order_item_id IS NOT NULL", id).Count(&assigned).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{
+		"available": available,
+		"assigned":  assigned,
+	})
+}
+
+// <=============================================Cache Management=============================================>
+
+// InvalidateCatalogCacheHandler invalidates every cached product, listing and recommendation at once,
+// e.g. after editing products directly in the database.
+func InvalidateCatalogCacheHandler(w http.ResponseWriter, r *http.Request) {
+	services.InvalidateCatalogCache()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Catalog cache invalidated"})
+}
+
+// <=============================================Product Feeds=============================================>
+
+// GenerateFeedsHandler regenerates the product feeds now instead of waiting for the schedule.
+func GenerateFeedsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := services.GenerateFeeds(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Product feeds generated"})
+}
+
+// <=============================================Order Management=============================================>
+
+func GetOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	var orders []models.Order
+	if err := config.DB.Find(&orders).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+func UpdateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var order models.Order
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := config.DB.Save(&order).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Order status updated successfully"})
+}
+
+// <=============================================Review Moderation=============================================>
+
+// GetReviewQueueHandler lists reviews by moderation status (pending by default), most reported first.
+func GetReviewQueueHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.ReviewStatusPending
+	}
+	if status != models.ReviewStatusPending && status != models.ReviewStatusApproved && status != models.ReviewStatusRejected {
+		http.Error(w, "Invalid review status", http.StatusBadRequest)
+		return
+	}
+
+	var reviews []models.Review
+	if err := config.DB.Where("status = ?", status).Order("report_count desc, created_at asc").Find(&reviews).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviews)
+}
+
+// GetReviewReportsHandler lists the abuse reports filed against a review.
+func GetReviewReportsHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var reports []models.ReviewReport
+	if err := config.DB.Where("review_id = ?", id).Order("created_at asc").Find(&reports).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// ModerateReviewHandler approves or rejects a review and refreshes the product rating aggregates.
+func ModerateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	var decision struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if decision.Status != models.ReviewStatusApproved && decision.Status != models.ReviewStatusRejected {
+		http.Error(w, "Status must be approved or rejected", http.StatusBadRequest)
+		return
+	}
+
+	var review models.Review
+	if err := config.DB.First(&review, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"status":            decision.Status,
+			"moderation_reason": decision.Reason,
+		}
+		if decision.Status == models.ReviewStatusApproved {
+			// Approving clears the reports so the review is not immediately held again
+			updates["report_count"] = 0
+		}
+		if err := tx.Model(&review).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+		return services.RecalculateProductRating(tx, review.ProductID)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	services.InvalidateProductCache(review.ProductID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Review " + decision.Status})
+}
+
+// <=============================================Q&A Moderation=============================================>
+
+// GetQuestionQueueHandler lists product questions by moderation status (pending by default), oldest first.
+func GetQuestionQueueHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.QAStatusPending
+	}
+	if status != models.QAStatusPending && status != models.QAStatusApproved && status != models.QAStatusRejected {
+		http.Error(w, "Invalid question status", http.StatusBadRequest)
+		return
+	}
+
+	var questions []models.ProductQuestion
+	if err := config.DB.Where("status = ?", status).Order("created_at asc").Find(&questions).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(questions)
+}
+
+// GetAnswerQueueHandler lists answers by moderation status (pending by default), oldest first.
+func GetAnswerQueueHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.QAStatusPending
+	}
+	if status != models.QAStatusPending && status != models.QAStatusApproved && status != models.QAStatusRejected {
+		http.Error(w, "Invalid answer status", http.StatusBadRequest)
+		return
+	}
+
+	var answers []models.ProductAnswer
+	if err := config.DB.Where("status = ?", status).Order("created_at asc").Find(&answers).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(answers)
+}
+
+// qaDecision is the body of a Q&A moderation request.
+type qaDecision struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// decodeQADecision reads a moderation decision, writing the error response itself when it is invalid.
+func decodeQADecision(w http.ResponseWriter, r *http.Request) (qaDecision, bool) {
+	var decision qaDecision
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return decision, false
+	}
+	if decision.Status != models.QAStatusApproved && decision.Status != models.QAStatusRejected {
+		http.Error(w, "Status must be approved or rejected", http.StatusBadRequest)
+		return decision, false
+	}
+	return decision, true
+}
+
+// ModerateQuestionHandler approves or rejects a product question.
+func ModerateQuestionHandler(w http.ResponseWriter, r *http.Request) {
+	decision, ok := decodeQADecision(w, r)
+	if !ok {
+		return
+	}
+
+	var question models.ProductQuestion
+	if err := config.DB.First(&question, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Question not found", http.StatusNotFound)
+		return
+	}
+
+	if err := services.ModerateQuestion(config.DB, &question, decision.Status, decision.Reason); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Question " + decision.Status})
+}
+
+// ModerateAnswerHandler approves or rejects an answer.
+func ModerateAnswerHandler(w http.ResponseWriter, r *http.Request) {
+	decision, ok := decodeQADecision(w, r)
+	if !ok {
+		return
+	}
+
+	var answer models.ProductAnswer
+	if err := config.DB.First(&answer, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Answer not found", http.StatusNotFound)
+		return
+	}
+
+	if err := services.ModerateAnswer(config.DB, &answer, decision.Status, decision.Reason); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Answer " + decision.Status})
 }
 
 // <=============================================Role Management=============================================>
@@ -2,13 +2,17 @@ package partition
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/theinvincible/ecommerce-backend/config"
 	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/services"
 	"github.com/theinvincible/ecommerce-backend/utils"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 /*
@@ -128,12 +132,31 @@ func AddProduct(w http.ResponseWriter, r *http.Request) {
 	// This associates the product with the vendor who added it.
 	// Ensuring that each product can be traced back to the vendor who created it, which is crucial for managing inventory, order processing, and overall business logic.
 	vendorID := r.Context().Value("vendorID").(uint)
-	product.ID = vendorID
+	product.VendorID = vendorID
 
-	if err := config.DB.Create(&product).Error; err != nil {
+	if err := services.ValidateProductLifecycle(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := services.ValidatePricing(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&product).Error; err != nil {
+			return err
+		}
+		if err := services.RecordPriceChange(tx, nil, &product, int(vendorID), "vendor"); err != nil {
+			return err
+		}
+		return services.RecordStockChange(tx, nil, &product, int(vendorID))
+	})
+	if err != nil {
 		http.Error(w, "Error adding product", http.StatusInternalServerError)
 		return
 	}
+	services.InvalidateProductCache(int(product.ID))
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(product)
@@ -152,12 +175,67 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	// Get vendor ID from the JWT token or session.
 	// This ensures that only the vendor who created the product can update it.
 	vendorID := r.Context().Value("vendorID").(uint)
-	product.ID = vendorID
 
-	if err := config.DB.Save(&product).Error; err != nil {
+	var existing models.Product
+	if err := config.DB.First(&existing, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if existing.VendorID != vendorID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	product.ID = existing.ID
+	product.VendorID = vendorID
+	product.CreatedAt = existing.CreatedAt
+
+	// Keep the lifecycle state when the body leaves it out, so a product never ends up with no status
+	if product.Status == "" {
+		product.Status = existing.Status
+	}
+	if product.PublishAt == nil {
+		product.PublishAt = existing.PublishAt
+	}
+	if product.UnpublishAt == nil {
+		product.UnpublishAt = existing.UnpublishAt
+	}
+
+	if err := services.ValidateProductLifecycle(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := services.ValidatePricing(&product); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	previous := &existing
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := services.ReconcileSlug(tx, models.SlugEntityProduct, int(product.ID), previous.Slug, &product.Slug); err != nil {
+			return err
+		}
+		if err := tx.Save(&product).Error; err != nil {
+			return err
+		}
+		if err := services.RecordPriceChange(tx, previous, &product, int(vendorID), "vendor"); err != nil {
+			return err
+		}
+		return services.RecordStockChange(tx, previous, &product, int(vendorID))
+	})
+	if errors.Is(err, services.ErrSlugTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
 		http.Error(w, "Error updating product", http.StatusInternalServerError)
 		return
 	}
+	services.InvalidateProductCache(int(product.ID))
+	if previous.CategoryID != product.CategoryID {
+		services.InvalidateCategoryCache(previous.CategoryID)
+	}
+	services.NotifyIfRestocked(previous, &product)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(product)
@@ -172,11 +250,59 @@ func DeleteProduct(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error deleting product", http.StatusInternalServerError)
 		return
 	}
+	services.InvalidateProductCache(int(productID))
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Product deleted successfully"})
 }
 
+// SetProductTags replaces the tags of one of the vendor's products.
+func SetProductTags(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vendorID := r.Context().Value("vendorID").(uint)
+
+	var product models.Product
+	if err := config.DB.First(&product, mux.Vars(r)["id"]).Error; err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if product.VendorID != vendorID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req ProductTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	tags, err := services.SetProductTags(config.DB, int(product.ID), req.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	services.InvalidateProductCache(int(product.ID))
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"product_id": product.ID, "tags": tags})
+}
+
+// GetLowStock lists the vendor's products that are at or below their reorder level at a warehouse.
+func GetLowStock(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vendorID := r.Context().Value("vendorID").(uint)
+
+	lines, err := services.LowStock(config.DB, vendorID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(lines)
+}
+
 // <=============================================Order Management=============================================>
 
 func GetOrders(w http.ResponseWriter, r *http.Request) {
@@ -218,6 +344,10 @@ func DeleteOrder(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error deleting order", http.StatusInternalServerError)
 		return
 	}
+	if err := services.ReleaseOrderReservations(config.DB, int(orderID)); err != nil {
+		http.Error(w, "Order deleted but its stock could not be released", http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Order deleted successfully"})
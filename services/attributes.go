@@ -0,0 +1,236 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Matches attr.<name><op><value> query parameters such as attr.ram_gb>=16 or attr.color=black
+var attributeFilterPattern = regexp.MustCompile(`^attr\.([a-z][a-z0-9_]*)(>=|<=|!=|>|<|=)(.*)$`)
+
+// AttributeFilter is a parsed attr.<name><op><value> condition for GetProducts.
+type AttributeFilter struct {
+	Name     string
+	Type     string
+	Operator string
+	Value    string
+}
+
+// ValidateCategoryAttribute checks that an attribute schema entry is well formed.
+func ValidateCategoryAttribute(attr *models.CategoryAttribute) error {
+	if !attributeNamePattern.MatchString(attr.Name) {
+		return fmt.Errorf("attribute name %q must be lowercase letters, digits and underscores", attr.Name)
+	}
+
+	switch attr.Type {
+	case models.AttributeTypeString, models.AttributeTypeNumber, models.AttributeTypeBoolean:
+	case models.AttributeTypeEnum:
+		if len(attr.AllowedValues) == 0 {
+			return fmt.Errorf("enum attribute %q must define allowed_values", attr.Name)
+		}
+	default:
+		return fmt.Errorf("unsupported attribute type %q", attr.Type)
+	}
+
+	if attr.Label == "" {
+		attr.Label = attr.Name
+	}
+	return nil
+}
+
+// BuildAttributeValue converts a raw JSON value into a ProductAttributeValue after checking it against the schema.
+func BuildAttributeValue(attr models.CategoryAttribute, raw interface{}) (models.ProductAttributeValue, error) {
+	value := models.ProductAttributeValue{AttributeID: int(attr.ID)}
+
+	switch attr.Type {
+	case models.AttributeTypeNumber:
+		number, ok := raw.(float64)
+		if !ok {
+			return value, fmt.Errorf("attribute %q must be a number", attr.Name)
+		}
+		value.ValueNumber = &number
+	case models.AttributeTypeBoolean:
+		flag, ok := raw.(bool)
+		if !ok {
+			return value, fmt.Errorf("attribute %q must be a boolean", attr.Name)
+		}
+		value.ValueBool = &flag
+	default:
+		text, ok := raw.(string)
+		if !ok {
+			return value, fmt.Errorf("attribute %q must be a string", attr.Name)
+		}
+		if len(attr.AllowedValues) > 0 && !containsString(attr.AllowedValues, text) {
+			return value, fmt.Errorf("attribute %q must be one of %s", attr.Name, strings.Join(attr.AllowedValues, ", "))
+		}
+		value.ValueString = text
+	}
+
+	return value, nil
+}
+
+// SetProductAttributes validates the given values against the product's category schema
+// and replaces the product's stored attribute values with them.
+func SetProductAttributes(db *gorm.DB, product *models.Product, values map[string]interface{}) error {
+	var schema []models.CategoryAttribute
+	if err := db.Where("category_id = ?", product.CategoryID).Find(&schema).Error; err != nil {
+		return err
+	}
+
+	byName := make(map[string]models.CategoryAttribute, len(schema))
+	for _, attr := range schema {
+		byName[attr.Name] = attr
+	}
+
+	var rows []models.ProductAttributeValue
+	for name, raw := range values {
+		attr, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("attribute %q is not defined for this category", name)
+		}
+		row, err := BuildAttributeValue(attr, raw)
+		if err != nil {
+			return err
+		}
+		row.ProductID = int(product.ID)
+		rows = append(rows, row)
+	}
+
+	for _, attr := range schema {
+		if _, ok := values[attr.Name]; attr.Required && !ok {
+			return fmt.Errorf("attribute %q is required", attr.Name)
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("product_id = ?", product.ID).Delete(&models.ProductAttributeValue{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// ParseAttributeFilters extracts attr.<name><op><value> conditions from a raw query string.
+// Only attributes marked filterable can be used, and range operators require a number attribute.
+// Attributes are looked up in the category when categoryID is not 0. Across categories, an attribute
+// name must have the same type everywhere it is filterable.
+func ParseAttributeFilters(db *gorm.DB, rawQuery string, categoryID int) ([]AttributeFilter, error) {
+	var filters []AttributeFilter
+
+	for _, part := range strings.Split(rawQuery, "&") {
+		decoded, err := url.QueryUnescape(part)
+		if err != nil || !strings.HasPrefix(decoded, "attr.") {
+			continue
+		}
+
+		// url.ParseQuery splits attr.ram_gb>=16 at "=", so the operator is recovered from the raw pair
+		match := attributeFilterPattern.FindStringSubmatch(decoded)
+		if match == nil {
+			return nil, fmt.Errorf("invalid attribute filter %q", decoded)
+		}
+
+		query := db.Where("name = ? AND filterable = ?", match[1], true)
+		if categoryID != 0 {
+			query = query.Where("category_id = ?", categoryID)
+		}
+		var definitions []models.CategoryAttribute
+		if err := query.Order("id").Find(&definitions).Error; err != nil {
+			return nil, err
+		}
+		if len(definitions) == 0 {
+			return nil, fmt.Errorf("attribute %q is not filterable", match[1])
+		}
+		attr := definitions[0]
+		for _, definition := range definitions[1:] {
+			if definition.Type != attr.Type {
+				return nil, fmt.Errorf("attribute %q has different types across categories; filter by category", match[1])
+			}
+		}
+
+		filter := AttributeFilter{Name: match[1], Type: attr.Type, Operator: match[2], Value: match[3]}
+		switch attr.Type {
+		case models.AttributeTypeNumber:
+			if _, err := strconv.ParseFloat(filter.Value, 64); err != nil {
+				return nil, fmt.Errorf("attribute %q must be filtered by a number", filter.Name)
+			}
+		case models.AttributeTypeBoolean:
+			if _, err := strconv.ParseBool(filter.Value); err != nil || (filter.Operator != "=" && filter.Operator != "!=") {
+				return nil, fmt.Errorf("attribute %q must be filtered with =true or =false", filter.Name)
+			}
+		default:
+			if filter.Operator != "=" && filter.Operator != "!=" {
+				return nil, fmt.Errorf("attribute %q only supports = and != filters", filter.Name)
+			}
+		}
+
+		filters = append(filters, filter)
+	}
+
+	// Sorted so equivalent filter sets share a cache key regardless of parameter order
+	sort.Slice(filters, func(i, j int) bool {
+		return filters[i].String() < filters[j].String()
+	})
+	return filters, nil
+}
+
+// String renders the filter back to its query form, e.g. ram_gb>=16.
+func (f AttributeFilter) String() string {
+	return f.Name + f.Operator + f.Value
+}
+
+// AttributeFiltersKey renders filters into a stable string suitable for cache keys.
+func AttributeFiltersKey(filters []AttributeFilter) string {
+	parts := make([]string, len(filters))
+	for i, filter := range filters {
+		parts[i] = filter.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// ApplyAttributeFilters restricts a products query to products whose attribute values satisfy every filter.
+func ApplyAttributeFilters(query *gorm.DB, filters []AttributeFilter) *gorm.DB {
+	for _, filter := range filters {
+		var condition string
+		var value interface{}
+
+		switch filter.Type {
+		case models.AttributeTypeNumber:
+			condition = "pav.value_number " + filter.Operator + " ?"
+			value, _ = strconv.ParseFloat(filter.Value, 64)
+		case models.AttributeTypeBoolean:
+			condition = "pav.value_bool " + filter.Operator + " ?"
+			value, _ = strconv.ParseBool(filter.Value)
+		default:
+			condition = "pav.value_string " + filter.Operator + " ?"
+			value = filter.Value
+		}
+
+		// Operators come from attributeFilterPattern, so concatenating them into SQL is safe
+		query = query.Where("products.id IN (SELECT pav.product_id FROM product_attribute_values pav "+
+			"JOIN category_attributes ca ON ca.id = pav.attribute_id "+
+			"WHERE pav.deleted_at IS NULL AND ca.deleted_at IS NULL AND ca.filterable = true "+
+			"AND ca.name = ? AND ca.type = ? AND "+condition+")", filter.Name, filter.Type, value)
+	}
+	return query
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
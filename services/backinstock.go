@@ -0,0 +1,201 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrProductInStock is returned when subscribing to a product that can be bought right now.
+var ErrProductInStock = errors.New("product is in stock")
+
+// backInStockPerUnit is how many subscribers are notified per available unit, from BACK_IN_STOCK_PER_UNIT (default 1).
+func backInStockPerUnit() int {
+	if perUnit, err := strconv.Atoi(os.Getenv("BACK_IN_STOCK_PER_UNIT")); err == nil && perUnit > 0 {
+		return perUnit
+	}
+	return 1
+}
+
+// backInStockBatchInterval is the pause between notification batches for one product, from
+// BACK_IN_STOCK_BATCH_INTERVAL (default 1h). It gives earlier recipients time to buy before more are told.
+func backInStockBatchInterval() time.Duration {
+	if interval, err := time.ParseDuration(os.Getenv("BACK_IN_STOCK_BATCH_INTERVAL")); err == nil && interval >= 0 {
+		return interval
+	}
+	return time.Hour
+}
+
+// availableStock is how many units of a product can be sold, counting bundles by their components.
+func availableStock(db *gorm.DB, product *models.Product) (int, error) {
+	if product.Type == models.ProductTypeBundle {
+		if err := ApplyProductBundleAvailability(db, product); err != nil {
+			return 0, err
+		}
+	}
+	return product.Quantity, nil
+}
+
+// SubscribeBackInStock records a request to be emailed when an out-of-stock product returns.
+// Subscribing again after being notified re-queues the subscription.
+func SubscribeBackInStock(db *gorm.DB, productID int, userID *int, email string) (*models.StockSubscription, error) {
+	var product models.Product
+	if err := db.Scopes(PublishedProducts).First(&product, productID).Error; err != nil {
+		return nil, fmt.Errorf("product %d not found", productID)
+	}
+	if product.Type == models.ProductTypeDigital {
+		return nil, ErrProductInStock
+	}
+	available, err := availableStock(db, &product)
+	if err != nil {
+		return nil, err
+	}
+	if available > 0 {
+		return nil, ErrProductInStock
+	}
+
+	if email == "" && userID != nil {
+		var user models.User
+		if err := db.First(&user, *userID).Error; err != nil {
+			return nil, fmt.Errorf("user %d not found", *userID)
+		}
+		email = user.Email
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !strings.Contains(email, "@") {
+		return nil, errors.New("a valid email is required")
+	}
+
+	var subscription models.StockSubscription
+	err = db.Where("product_id = ? AND email = ?", productID, email).First(&subscription).Error
+	if err == nil {
+		subscription.NotifiedAt = nil
+		if userID != nil {
+			subscription.UserID = userID
+		}
+		return &subscription, db.Save(&subscription).Error
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	token, err := NewShareToken()
+	if err != nil {
+		return nil, err
+	}
+	subscription = models.StockSubscription{ProductID: productID, Email: email, UserID: userID, Token: token}
+	if err := db.Create(&subscription).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// NotifyIfRestocked starts notifying subscribers in the background when an update takes a product
+// from zero to positive stock. Paths that do not call it are caught by the scheduled sweep.
+func NotifyIfRestocked(previous, product *models.Product) {
+	if previous == nil || previous.Quantity > 0 || product.Quantity <= 0 {
+		return
+	}
+
+	productID := int(product.ID)
+	go func() {
+		if err := ProcessBackInStock(productID); err != nil {
+			log.Printf("Error sending back-in-stock notifications for product %d: %v", productID, err)
+		}
+	}()
+}
+
+// ProcessBackInStock notifies the next batch of a product's subscribers if it is in stock.
+// A batch is at most BACK_IN_STOCK_PER_UNIT subscribers per available unit, oldest first, and
+// no new batch starts within BACK_IN_STOCK_BATCH_INTERVAL of the previous one. The product row
+// is locked while a batch is picked so concurrent runs never notify anyone twice.
+func ProcessBackInStock(productID int) error {
+	var product models.Product
+	var batch []models.StockSubscription
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(PublishedProducts).First(&product, productID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		available, err := availableStock(tx, &product)
+		if err != nil || available <= 0 {
+			return err
+		}
+
+		var lastBatch models.StockSubscription
+		err = tx.Where("product_id = ? AND notified_at IS NOT NULL", productID).Order("notified_at desc").First(&lastBatch).Error
+		if err == nil && time.Since(*lastBatch.NotifiedAt) < backInStockBatchInterval() {
+			return nil
+		} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := tx.Where("product_id = ? AND notified_at IS NULL", productID).
+			Order("created_at").Limit(available * backInStockPerUnit()).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, len(batch))
+		for i, subscription := range batch {
+			ids[i] = subscription.ID
+			if subscription.UserID != nil {
+				notification := models.Notification{
+					UserID:    *subscription.UserID,
+					ProductID: productID,
+					Title:     fmt.Sprintf("%s is back in stock", product.Name),
+					Message:   fmt.Sprintf("%s is available again. Stock is limited, so order soon.", product.Name),
+				}
+				if err := tx.Create(&notification).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Model(&models.StockSubscription{}).Where("id IN ?", ids).UpdateColumn("notified_at", time.Now()).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range batch {
+		body := fmt.Sprintf("Good news! %s is back in stock. Stock is limited, so order soon.\n\nTo stop these emails, unsubscribe at %s/api/v1/stock-subscriptions/%s",
+			product.Name, strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/"), subscription.Token)
+		if err := utils.SendEmail(subscription.Email, fmt.Sprintf("%s is back in stock", product.Name), body); err != nil {
+			log.Printf("Error emailing back-in-stock notification %d: %v", subscription.ID, err)
+		}
+	}
+	if len(batch) > 0 {
+		log.Printf("Sent %d back-in-stock notifications for product %d", len(batch), productID)
+	}
+	return nil
+}
+
+// ProcessAllBackInStock runs ProcessBackInStock for every product with waiting subscribers. It is run
+// by the scheduler in main and catches restocks from paths that do not call NotifyIfRestocked.
+func ProcessAllBackInStock() error {
+	var productIDs []int
+	if err := config.DB.Model(&models.StockSubscription{}).Where("notified_at IS NULL").Distinct().Pluck("product_id", &productIDs).Error; err != nil {
+		return err
+	}
+
+	for _, productID := range productIDs {
+		if err := ProcessBackInStock(productID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
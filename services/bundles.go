@@ -0,0 +1,192 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// LoadBundleComponents returns the components, with their products, of every bundle among the given products.
+// Products that are not bundles are absent from the result.
+func LoadBundleComponents(db *gorm.DB, productIDs []int) (map[int][]models.BundleComponent, error) {
+	bundles := map[int][]models.BundleComponent{}
+	if len(productIDs) == 0 {
+		return bundles, nil
+	}
+
+	var components []models.BundleComponent
+	err := db.Preload("Component").
+		Joins("JOIN products ON products.id = bundle_components.bundle_id AND products.type = ?", models.ProductTypeBundle).
+		Where("bundle_components.bundle_id IN ?", productIDs).
+		Order("bundle_components.id").
+		Find(&components).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, component := range components {
+		bundles[component.BundleID] = append(bundles[component.BundleID], component)
+	}
+	return bundles, nil
+}
+
+// BundleAvailability is how many complete bundles can be assembled from the component stock.
+func BundleAvailability(components []models.BundleComponent) int {
+	if len(components) == 0 {
+		return 0
+	}
+
+	available := math.MaxInt
+	for _, component := range components {
+		if fits := component.Component.Quantity / component.Quantity; fits < available {
+			available = fits
+		}
+	}
+	return available
+}
+
+// ApplyBundleAvailability replaces the Quantity of bundle products with the availability derived from their components.
+func ApplyBundleAvailability(db *gorm.DB, products []models.Product) error {
+	var bundleIDs []int
+	for _, product := range products {
+		if product.Type == models.ProductTypeBundle {
+			bundleIDs = append(bundleIDs, int(product.ID))
+		}
+	}
+	if len(bundleIDs) == 0 {
+		return nil
+	}
+
+	bundles, err := LoadBundleComponents(db, bundleIDs)
+	if err != nil {
+		return err
+	}
+	for i := range products {
+		if products[i].Type == models.ProductTypeBundle {
+			products[i].Quantity = BundleAvailability(bundles[int(products[i].ID)])
+		}
+	}
+	return nil
+}
+
+// MaybeInStock is a scope for products that may be in stock: simple products with stock and every bundle,
+// whose availability depends on its components. Filter the results with InStockProducts.
+func MaybeInStock(db *gorm.DB) *gorm.DB {
+	return db.Where("(products.quantity > 0 OR products.type = ?)", models.ProductTypeBundle)
+}
+
+// InStockProducts applies bundle availability to products and keeps the ones with stock.
+func InStockProducts(db *gorm.DB, products []models.Product) ([]models.Product, error) {
+	if err := ApplyBundleAvailability(db, products); err != nil {
+		return nil, err
+	}
+	inStock := products[:0]
+	for _, product := range products {
+		if product.Quantity > 0 {
+			inStock = append(inStock, product)
+		}
+	}
+	return inStock, nil
+}
+
+// SetBundleComponents replaces the components of a bundle and marks the product as a bundle.
+// Bundles cannot contain themselves or other bundles.
+func SetBundleComponents(db *gorm.DB, bundle *models.Product, components []models.BundleComponent) error {
+	if len(components) == 0 {
+		return errors.New("a bundle needs at least one component")
+	}
+
+	var usedAsComponent int64
+	if err := db.Model(&models.BundleComponent{}).Where("component_id = ?", bundle.ID).Count(&usedAsComponent).Error; err != nil {
+		return err
+	}
+	if usedAsComponent > 0 {
+		return errors.New("product is a component of another bundle and cannot become a bundle")
+	}
+
+	seen := map[int]bool{}
+	for i := range components {
+		component := &components[i]
+		if component.Quantity < 1 {
+			return fmt.Errorf("quantity for component %d must be at least 1", component.ComponentID)
+		}
+		if component.ComponentID == int(bundle.ID) {
+			return errors.New("a bundle cannot contain itself")
+		}
+		if seen[component.ComponentID] {
+			return fmt.Errorf("component %d is listed more than once", component.ComponentID)
+		}
+		seen[component.ComponentID] = true
+
+		var product models.Product
+		if err := db.First(&product, component.ComponentID).Error; err != nil {
+			return fmt.Errorf("component %d not found", component.ComponentID)
+		}
+		if product.Type == models.ProductTypeBundle {
+			return fmt.Errorf("component %d is itself a bundle", component.ComponentID)
+		}
+		if product.Type == models.ProductTypeDigital {
+			return fmt.Errorf("component %d is a digital product", component.ComponentID)
+		}
+
+		component.ID = 0
+		component.BundleID = int(bundle.ID)
+		component.Component = models.Product{}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("bundle_id = ?", bundle.ID).Delete(&models.BundleComponent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&components).Error; err != nil {
+			return err
+		}
+		bundle.Type = models.ProductTypeBundle
+		return tx.Model(bundle).UpdateColumn("type", models.ProductTypeBundle).Error
+	})
+}
+
+// AllocateBundleLine splits a bundle order line into component quantities and shares of the line total.
+// Shares are weighted by each component's standalone price times its quantity, and the rounding
+// remainder goes to the last component so the shares always add up to the line total.
+func AllocateBundleLine(components []models.BundleComponent, lineQuantity int, lineTotal float64) []models.OrderItemComponent {
+	var weightTotal float64
+	for _, component := range components {
+		weightTotal += component.Component.Price * float64(component.Quantity)
+	}
+
+	breakdown := make([]models.OrderItemComponent, len(components))
+	var allocated float64
+	for i, component := range components {
+		breakdown[i] = models.OrderItemComponent{
+			ProductID: component.ComponentID,
+			Quantity:  component.Quantity * lineQuantity,
+		}
+
+		if i == len(components)-1 {
+			breakdown[i].AllocatedTotal = RoundPrice(lineTotal - allocated)
+			break
+		}
+
+		share := lineTotal / float64(len(components))
+		if weightTotal > 0 {
+			share = lineTotal * component.Component.Price * float64(component.Quantity) / weightTotal
+		}
+		breakdown[i].AllocatedTotal = RoundPrice(share)
+		allocated += breakdown[i].AllocatedTotal
+	}
+	return breakdown
+}
+
+// ApplyProductBundleAvailability is ApplyBundleAvailability for a single product.
+func ApplyProductBundleAvailability(db *gorm.DB, product *models.Product) error {
+	products := []models.Product{*product}
+	if err := ApplyBundleAvailability(db, products); err != nil {
+		return err
+	}
+	*product = products[0]
+	return nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+)
+
+func component(productID, quantity int, price float64) models.BundleComponent {
+	return models.BundleComponent{ComponentID: productID, Quantity: quantity, Component: models.Product{Price: price}}
+}
+
+func TestAllocateBundleLine(t *testing.T) {
+	tests := []struct {
+		name         string
+		components   []models.BundleComponent
+		lineQuantity int
+		lineTotal    float64
+		want         []models.OrderItemComponent
+	}{
+		{
+			name:         "weighted by price times quantity",
+			components:   []models.BundleComponent{component(1, 1, 30), component(2, 2, 10)},
+			lineQuantity: 2,
+			lineTotal:    80,
+			want: []models.OrderItemComponent{
+				{ProductID: 1, Quantity: 2, AllocatedTotal: 48},
+				{ProductID: 2, Quantity: 4, AllocatedTotal: 32},
+			},
+		},
+		{
+			name:         "rounding remainder goes to the last component",
+			components:   []models.BundleComponent{component(1, 1, 10), component(2, 1, 10), component(3, 1, 10)},
+			lineQuantity: 1,
+			lineTotal:    10,
+			want: []models.OrderItemComponent{
+				{ProductID: 1, Quantity: 1, AllocatedTotal: 3.33},
+				{ProductID: 2, Quantity: 1, AllocatedTotal: 3.33},
+				{ProductID: 3, Quantity: 1, AllocatedTotal: 3.34},
+			},
+		},
+		{
+			name:         "split evenly without prices",
+			components:   []models.BundleComponent{component(1, 1, 0), component(2, 3, 0)},
+			lineQuantity: 1,
+			lineTotal:    9,
+			want: []models.OrderItemComponent{
+				{ProductID: 1, Quantity: 1, AllocatedTotal: 4.5},
+				{ProductID: 2, Quantity: 3, AllocatedTotal: 4.5},
+			},
+		},
+		{
+			name:         "single component takes the whole line",
+			components:   []models.BundleComponent{component(1, 2, 5)},
+			lineQuantity: 3,
+			lineTotal:    25,
+			want:         []models.OrderItemComponent{{ProductID: 1, Quantity: 6, AllocatedTotal: 25}},
+		},
+		{
+			name:         "no components",
+			lineQuantity: 1,
+			lineTotal:    10,
+			want:         []models.OrderItemComponent{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := AllocateBundleLine(test.components, test.lineQuantity, test.lineTotal)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("AllocateBundleLine() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
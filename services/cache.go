@@ -0,0 +1,49 @@
+package services
+
+import (
+	"github.com/theinvincible/ecommerce-backend/cache"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+)
+
+// InvalidateProductCache invalidates everything cached about products after a write: their own entries,
+// every listing containing them and the listings they may have entered or left, i.e. those of their
+// categories and the unfiltered ones. Bundles containing the products are included because their stock
+// is computed from their components. Deleted products are included so their listings are refreshed too.
+func InvalidateProductCache(productIDs ...int) {
+	if len(productIDs) == 0 {
+		return
+	}
+
+	var bundleIDs []int
+	config.DB.Model(&models.BundleComponent{}).Where("component_id IN ?", productIDs).Distinct().Pluck("bundle_id", &bundleIDs)
+	productIDs = append(productIDs, bundleIDs...)
+
+	tags := []string{cache.AllCategoriesTag}
+	for _, productID := range productIDs {
+		tags = append(tags, cache.ProductTag(productID))
+	}
+
+	var categoryIDs []int
+	config.DB.Unscoped().Model(&models.Product{}).Where("id IN ?", productIDs).Distinct().Pluck("category_id", &categoryIDs)
+	for _, categoryID := range categoryIDs {
+		tags = append(tags, cache.CategoryTag(categoryID))
+	}
+
+	cache.InvalidateTags(tags...)
+}
+
+// InvalidateCategoryCache invalidates the listings filtered by the given categories, e.g. the category
+// a product was moved out of, and the unfiltered ones, which include the categories themselves.
+func InvalidateCategoryCache(categoryIDs ...int) {
+	tags := []string{cache.AllCategoriesTag}
+	for _, categoryID := range categoryIDs {
+		tags = append(tags, cache.CategoryTag(categoryID))
+	}
+	cache.InvalidateTags(tags...)
+}
+
+// InvalidateCatalogCache invalidates every cached catalog entry at once, for changes that affect the whole catalog.
+func InvalidateCatalogCache() {
+	cache.InvalidateTags(cache.CatalogTag)
+}
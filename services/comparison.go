@@ -0,0 +1,314 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxComparedProducts is how many products can be compared side by side.
+const MaxComparedProducts = 4
+
+// Errors returned by the comparison operations.
+var (
+	ErrTooManyCompared = fmt.Errorf("at most %d products can be compared", MaxComparedProducts)
+	ErrComparisonFull  = fmt.Errorf("the comparison list already holds %d products", MaxComparedProducts)
+)
+
+// ComparedProduct identifies one column of a comparison.
+type ComparedProduct struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Image    string `json:"image"`
+	Language string `json:"language"`
+}
+
+// ComparisonRow is one line of a comparison, with a value per product in column order.
+// Values are null where a product has no value, and Identical marks rows the UI may hide.
+type ComparisonRow struct {
+	Key       string        `json:"key"`
+	Label     string        `json:"label"`
+	Unit      string        `json:"unit,omitempty"`
+	Values    []interface{} `json:"values"`
+	Identical bool          `json:"identical"`
+}
+
+// Comparison is a normalised comparison matrix: fixed product fields first, then the union of the
+// products' category attributes.
+type Comparison struct {
+	Currency string            `json:"currency"`
+	Products []ComparedProduct `json:"products"`
+	Rows     []ComparisonRow   `json:"rows"`
+}
+
+// Dimensions are a product's length, width and height in centimetres.
+type Dimensions struct {
+	Length float64 `json:"length"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+var dimensionsPattern = regexp.MustCompile(`(?i)^\s*([\d.]+)\s*[x×*]\s*([\d.]+)\s*[x×*]\s*([\d.]+)\s*(mm|cm|m|in|inch|inches|")?\s*$`)
+
+// centimetresPer converts the units accepted in Product.Dimensions; no unit means centimetres.
+var centimetresPer = map[string]float64{"": 1, "mm": 0.1, "cm": 1, "m": 100, "in": 2.54, "inch": 2.54, "inches": 2.54, `"`: 2.54}
+
+// ParseDimensions parses free-form dimensions such as "30 x 20 x 5 cm" or `12x8x1"` into centimetres.
+func ParseDimensions(raw string) (*Dimensions, error) {
+	match := dimensionsPattern.FindStringSubmatch(raw)
+	if match == nil {
+		return nil, fmt.Errorf("unrecognised dimensions %q", raw)
+	}
+
+	factor := centimetresPer[strings.ToLower(match[4])]
+	var sides [3]float64
+	for i := range sides {
+		side, err := strconv.ParseFloat(match[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("unrecognised dimensions %q", raw)
+		}
+		sides[i] = math.Round(side*factor*100) / 100
+	}
+	return &Dimensions{Length: sides[0], Width: sides[1], Height: sides[2]}, nil
+}
+
+// CompareProducts builds the comparison matrix of published products, in the order given, with
+// prices in currency and names in the first available of languages. Duplicate IDs are ignored.
+func CompareProducts(db *gorm.DB, productIDs []int, currency string, languages []string) (*Comparison, error) {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, id := range productIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("at least one product is required")
+	}
+	if len(ids) > MaxComparedProducts {
+		return nil, ErrTooManyCompared
+	}
+
+	var found []models.Product
+	if err := db.Scopes(PublishedProducts).Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int]models.Product, len(found))
+	for _, product := range found {
+		byID[int(product.ID)] = product
+	}
+	products := make([]models.Product, len(ids))
+	for i, id := range ids {
+		product, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("product %d not found", id)
+		}
+		products[i] = product
+	}
+
+	if err := ApplyPricing(products); err != nil {
+		return nil, err
+	}
+	if err := PresentProducts(db, products, currency); err != nil {
+		return nil, err
+	}
+	if err := LocaliseProducts(db, products, languages); err != nil {
+		return nil, err
+	}
+
+	comparison := &Comparison{Currency: currency, Products: make([]ComparedProduct, len(products))}
+	for i, product := range products {
+		comparison.Products[i] = ComparedProduct{ID: product.ID, Name: product.Name, Image: product.Image, Language: product.Language}
+	}
+
+	dimensions := make([]*Dimensions, len(products))
+	for i, product := range products {
+		dimensions[i], _ = ParseDimensions(product.Dimensions)
+	}
+
+	column := func(value func(i int, product models.Product) interface{}) []interface{} {
+		values := make([]interface{}, len(products))
+		for i, product := range products {
+			values[i] = value(i, product)
+		}
+		return values
+	}
+	side := func(pick func(d *Dimensions) float64) []interface{} {
+		return column(func(i int, _ models.Product) interface{} {
+			if dimensions[i] == nil {
+				return nil
+			}
+			return pick(dimensions[i])
+		})
+	}
+
+	comparison.Rows = []ComparisonRow{
+		{Key: "price", Label: "Price", Unit: currency, Values: column(func(_ int, p models.Product) interface{} { return p.Price })},
+		{Key: "effective_price", Label: "Price you pay", Unit: currency, Values: column(func(_ int, p models.Product) interface{} { return p.EffectivePrice })},
+		{Key: "discount_percent", Label: "Discount", Unit: "%", Values: column(func(_ int, p models.Product) interface{} { return effectiveDiscount(p) })},
+		{Key: "average_rating", Label: "Rating", Values: column(func(_ int, p models.Product) interface{} { return p.AverageRating })},
+		{Key: "number_of_ratings", Label: "Number of ratings", Values: column(func(_ int, p models.Product) interface{} { return p.NumberOfRatings })},
+		{Key: "brand", Label: "Brand", Values: column(func(_ int, p models.Product) interface{} { return nullIfEmpty(p.Brand) })},
+		{Key: "weight", Label: "Weight", Values: column(func(_ int, p models.Product) interface{} { return nullIfZero(p.Weight) })},
+		{Key: "length", Label: "Length", Unit: "cm", Values: side(func(d *Dimensions) float64 { return d.Length })},
+		{Key: "width", Label: "Width", Unit: "cm", Values: side(func(d *Dimensions) float64 { return d.Width })},
+		{Key: "height", Label: "Height", Unit: "cm", Values: side(func(d *Dimensions) float64 { return d.Height })},
+	}
+
+	attributeRows, err := attributeComparisonRows(db, products)
+	if err != nil {
+		return nil, err
+	}
+	comparison.Rows = append(comparison.Rows, attributeRows...)
+
+	for i := range comparison.Rows {
+		comparison.Rows[i].Identical = identicalValues(comparison.Rows[i].Values)
+	}
+	return comparison, nil
+}
+
+// attributeComparisonRows returns a row per attribute of the products' categories. Attributes of
+// different categories sharing a name, e.g. ram_gb for laptops and tablets, share a row.
+func attributeComparisonRows(db *gorm.DB, products []models.Product) ([]ComparisonRow, error) {
+	categoryIDs := make([]int, len(products))
+	productIDs := make([]int, len(products))
+	column := make(map[int]int, len(products))
+	for i, product := range products {
+		categoryIDs[i] = product.CategoryID
+		productIDs[i] = int(product.ID)
+		column[int(product.ID)] = i
+	}
+
+	var attributes []models.CategoryAttribute
+	if err := db.Where("category_id IN ?", categoryIDs).Order("category_id, id").Find(&attributes).Error; err != nil {
+		return nil, err
+	}
+	var values []models.ProductAttributeValue
+	if err := db.Preload("Attribute").Where("product_id IN ?", productIDs).Find(&values).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []ComparisonRow
+	rowIndex := make(map[string]int)
+	for _, attribute := range attributes {
+		if _, ok := rowIndex[attribute.Name]; ok {
+			continue
+		}
+		label := attribute.Label
+		if label == "" {
+			label = attribute.Name
+		}
+		rowIndex[attribute.Name] = len(rows)
+		rows = append(rows, ComparisonRow{
+			Key:    "attr." + attribute.Name,
+			Label:  label,
+			Unit:   attribute.Unit,
+			Values: make([]interface{}, len(products)),
+		})
+	}
+
+	for _, value := range values {
+		row, ok := rowIndex[value.Attribute.Name]
+		if !ok {
+			continue
+		}
+		switch {
+		case value.ValueNumber != nil:
+			rows[row].Values[column[value.ProductID]] = *value.ValueNumber
+		case value.ValueBool != nil:
+			rows[row].Values[column[value.ProductID]] = *value.ValueBool
+		default:
+			rows[row].Values[column[value.ProductID]] = value.ValueString
+		}
+	}
+	return rows, nil
+}
+
+// effectiveDiscount is how much below the regular price the product sells, as a percentage,
+// whether from its discount or a running sale.
+func effectiveDiscount(product models.Product) float64 {
+	if product.Price <= 0 || product.EffectivePrice >= product.Price {
+		return 0
+	}
+	return math.Round((product.Price-product.EffectivePrice)/product.Price*10000) / 100
+}
+
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func nullIfZero(value float64) interface{} {
+	if value == 0 {
+		return nil
+	}
+	return value
+}
+
+// identicalValues reports whether every value of a row is the same, comparing their JSON form
+// so numbers of different Go types still match.
+func identicalValues(values []interface{}) bool {
+	var first []byte
+	for i, value := range values {
+		encoded, _ := json.Marshal(value)
+		if i == 0 {
+			first = encoded
+		} else if string(encoded) != string(first) {
+			return false
+		}
+	}
+	return true
+}
+
+// ComparisonProductIDs returns the products on a shopper's comparison list, oldest first. Products that
+// are no longer published are taken off the list.
+func ComparisonProductIDs(db *gorm.DB, owner string) ([]int, error) {
+	published := db.Model(&models.Product{}).Select("id").Scopes(PublishedProducts)
+	if err := db.Where("owner = ? AND product_id NOT IN (?)", owner, published).Delete(&models.ComparisonItem{}).Error; err != nil {
+		return nil, err
+	}
+
+	var productIDs []int
+	err := db.Model(&models.ComparisonItem{}).Where("owner = ?", owner).Order("created_at, id").Pluck("product_id", &productIDs).Error
+	return productIDs, err
+}
+
+// AddToComparison adds a published product to a shopper's comparison list. Adding a product
+// already on the list does nothing.
+func AddToComparison(db *gorm.DB, owner string, productID int) error {
+	var product models.Product
+	if err := db.Scopes(PublishedProducts).First(&product, productID).Error; err != nil {
+		return fmt.Errorf("product %d not found", productID)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Row locks cannot stop two adds to a short list from both inserting, so adds to one list take turns
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "comparison:"+owner).Error; err != nil {
+			return err
+		}
+		var items []models.ComparisonItem
+		if err := tx.Where("owner = ?", owner).Find(&items).Error; err != nil {
+			return err
+		}
+		for _, item := range items {
+			if item.ProductID == productID {
+				return nil
+			}
+		}
+		if len(items) >= MaxComparedProducts {
+			return ErrComparisonFull
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.ComparisonItem{Owner: owner, ProductID: productID}).Error
+	})
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDimensions(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    *Dimensions
+		wantErr bool
+	}{
+		{"30 x 20 x 5 cm", &Dimensions{Length: 30, Width: 20, Height: 5}, false},
+		{"30x20x5", &Dimensions{Length: 30, Width: 20, Height: 5}, false},
+		{"300×200×50 mm", &Dimensions{Length: 30, Width: 20, Height: 5}, false},
+		{"1.2 * 0.5 * 0.25 M", &Dimensions{Length: 120, Width: 50, Height: 25}, false},
+		{`12x8x1"`, &Dimensions{Length: 30.48, Width: 20.32, Height: 2.54}, false},
+		{" 10 x 10 x 10 inches ", &Dimensions{Length: 25.4, Width: 25.4, Height: 25.4}, false},
+		{"30 x 20 cm", nil, true},
+		{"30 x 20 x 5 ft", nil, true},
+		{"1.2.3 x 1 x 1", nil, true},
+		{"", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			got, err := ParseDimensions(test.raw)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseDimensions(%q) error = %v, want error %v", test.raw, err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseDimensions(%q) = %+v, want %+v", test.raw, got, test.want)
+			}
+		})
+	}
+}
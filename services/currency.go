@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RateSource fetches exchange rates relative to a base currency.
+type RateSource interface {
+	Name() string
+	FetchRates(ctx context.Context, base string) (map[string]float64, error)
+}
+
+// ratesPayload is the JSON document both rate sources read: {"base": "USD", "rates": {"EUR": 0.92}}
+type ratesPayload struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// FileRateSource reads rates from a JSON file on disk.
+type FileRateSource struct {
+	Path string
+}
+
+// HTTPRateSource reads rates from a JSON endpoint.
+type HTTPRateSource struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s FileRateSource) Name() string { return "file" }
+
+func (s FileRateSource) FetchRates(ctx context.Context, base string) (map[string]float64, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	var payload ratesPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", s.Path, err)
+	}
+	return rebaseRates(payload, base)
+}
+
+func (s HTTPRateSource) Name() string { return "http" }
+
+func (s HTTPRateSource) FetchRates(ctx context.Context, base string) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rate source returned %s", resp.Status)
+	}
+
+	var payload ratesPayload
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+	return rebaseRates(payload, base)
+}
+
+// rebaseRates converts rates quoted against another currency into rates against base.
+func rebaseRates(payload ratesPayload, base string) (map[string]float64, error) {
+	payloadBase := strings.ToUpper(payload.Base)
+	rates := make(map[string]float64, len(payload.Rates)+1)
+	for code, rate := range payload.Rates {
+		rates[strings.ToUpper(code)] = rate
+	}
+	if payloadBase == "" || payloadBase == base {
+		return rates, nil
+	}
+
+	rates[payloadBase] = 1
+	baseRate, ok := rates[base]
+	if !ok || baseRate <= 0 {
+		return nil, fmt.Errorf("rates are quoted in %s and do not include %s", payloadBase, base)
+	}
+	for code, rate := range rates {
+		rates[code] = rate / baseRate
+	}
+	return rates, nil
+}
+
+// BaseCurrency is the currency catalog prices are stored in, set with BASE_CURRENCY (USD by default).
+func BaseCurrency() string {
+	if base := strings.ToUpper(os.Getenv("BASE_CURRENCY")); base != "" {
+		return base
+	}
+	return "USD"
+}
+
+// RateSourceFromEnv builds the rate source selected by EXCHANGE_RATE_SOURCE, or nil when none is configured.
+func RateSourceFromEnv() RateSource {
+	switch os.Getenv("EXCHANGE_RATE_SOURCE") {
+	case "file":
+		path := os.Getenv("EXCHANGE_RATES_FILE")
+		if path == "" {
+			path = "exchange_rates.json"
+		}
+		return FileRateSource{Path: path}
+	case "http":
+		return HTTPRateSource{URL: os.Getenv("EXCHANGE_RATES_URL"), Client: &http.Client{Timeout: 10 * time.Second}}
+	default:
+		return nil
+	}
+}
+
+// RefreshExchangeRates fetches the latest rates from the configured source and stores them.
+func RefreshExchangeRates() error {
+	source := RateSourceFromEnv()
+	if source == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	base := BaseCurrency()
+	rates, err := source.FetchRates(ctx, base)
+	if err != nil {
+		return fmt.Errorf("fetching exchange rates from %s source: %v", source.Name(), err)
+	}
+
+	now := time.Now()
+	rows := make([]models.ExchangeRate, 0, len(rates))
+	for code, rate := range rates {
+		if code == base || rate <= 0 {
+			continue
+		}
+		rows = append(rows, models.ExchangeRate{Currency: code, Rate: rate, Source: source.Name(), FetchedAt: now})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	err = config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "fetched_at"}),
+	}).Create(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Refreshed %d exchange rates from %s source", len(rows), source.Name())
+	return nil
+}
+
+// Converter converts base-currency amounts into one presentment currency using its rate and rounding rules.
+type Converter struct {
+	Currency string
+	rate     float64
+	rules    models.Currency
+}
+
+// NewConverter loads the rate and rounding rules of a currency. The base currency always converts at 1.
+// A currency without a Currency row is not supported.
+func NewConverter(db *gorm.DB, currency string) (*Converter, error) {
+	currency = strings.ToUpper(currency)
+	converter := &Converter{Currency: currency, rate: 1}
+
+	if err := db.First(&converter.rules, "code = ?", currency).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("currency %s is not supported", currency)
+		}
+		return nil, err
+	}
+	if !converter.rules.Enabled {
+		return nil, fmt.Errorf("currency %s is not supported", currency)
+	}
+
+	if currency != BaseCurrency() {
+		var rate models.ExchangeRate
+		if err := db.First(&rate, "currency = ?", currency).Error; err != nil {
+			return nil, fmt.Errorf("currency %s is not supported", currency)
+		}
+		converter.rate = rate.Rate
+	}
+	return converter, nil
+}
+
+// Round applies the currency's rounding rules to an amount already in that currency.
+func (c *Converter) Round(amount float64) float64 {
+	return RoundAmount(amount, c.rules)
+}
+
+// Convert converts a base-currency amount and rounds it.
+func (c *Converter) Convert(amount float64) float64 {
+	return c.Round(amount * c.rate)
+}
+
+// RoundAmount rounds to the currency's rounding increment, if it has one, and to its number of decimals.
+func RoundAmount(amount float64, rules models.Currency) float64 {
+	if rules.RoundingIncrement > 0 {
+		amount = math.Round(amount/rules.RoundingIncrement) * rules.RoundingIncrement
+	}
+	// Rounding to the decimals also drops the float error a rounding increment leaves, e.g. 10.100000000000001
+	factor := math.Pow(10, float64(rules.Decimals))
+	return math.Round(amount*factor) / factor
+}
+
+// ToMinorUnits converts an amount into the smallest unit of the currency as payment providers expect,
+// e.g. cents for USD and whole yen for JPY. It fails for a currency without a Currency row rather than
+// guess its number of decimals.
+func ToMinorUnits(db *gorm.DB, amount float64, currency string) (int64, error) {
+	var rules models.Currency
+	if err := db.First(&rules, "code = ?", strings.ToUpper(currency)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, fmt.Errorf("currency %s is not configured", strings.ToUpper(currency))
+		}
+		return 0, err
+	}
+	return int64(math.Round(amount * math.Pow(10, float64(rules.Decimals)))), nil
+}
+
+// OrderCharge is what an order is charged: its total in the minor units of its currency, and the currency.
+func OrderCharge(db *gorm.DB, order *models.Order) (int64, string, error) {
+	currency := strings.ToUpper(order.Currency)
+	if currency == "" {
+		currency = BaseCurrency()
+	}
+	if order.TotalAmount <= 0 {
+		return 0, "", fmt.Errorf("order %d has nothing to pay", order.ID)
+	}
+	amount, err := ToMinorUnits(db, order.TotalAmount, currency)
+	if err != nil {
+		return 0, "", err
+	}
+	return amount, currency, nil
+}
+
+// zeroDecimalCurrencies are the ISO 4217 currencies without minor units.
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true, "JPY": true, "KMF": true, "KRW": true,
+	"PYG": true, "RWF": true, "UGX": true, "UYI": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// threeDecimalCurrencies are the ISO 4217 currencies with three decimal places.
+var threeDecimalCurrencies = map[string]bool{
+	"BHD": true, "IQD": true, "JOD": true, "KWD": true, "LYD": true, "OMR": true, "TND": true,
+}
+
+// MinorUnits returns the number of decimals ISO 4217 gives a currency.
+func MinorUnits(currency string) int {
+	currency = strings.ToUpper(currency)
+	switch {
+	case zeroDecimalCurrencies[currency]:
+		return 0
+	case threeDecimalCurrencies[currency]:
+		return 3
+	}
+	return 2
+}
+
+// EnsureBaseCurrency creates the Currency row of the base currency, with its ISO 4217 decimals, when it
+// is missing so the store can always price and charge in it. It is run at startup.
+func EnsureBaseCurrency() error {
+	base := models.Currency{Code: BaseCurrency(), Decimals: MinorUnits(BaseCurrency()), Enabled: true}
+	return config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&base).Error
+}
+
+// ResolveCurrency picks the presentment currency: an explicit request, then the user's preference,
+// then the store's base currency.
+func ResolveCurrency(db *gorm.DB, requested string, userID int) string {
+	if requested != "" {
+		return strings.ToUpper(requested)
+	}
+	if userID != 0 {
+		var user models.User
+		if err := db.Select("id", "currency").First(&user, userID).Error; err == nil && user.Currency != "" {
+			return strings.ToUpper(user.Currency)
+		}
+	}
+	return BaseCurrency()
+}
+
+// PresentProducts converts the priced products (see ApplyPricing) into the given currency.
+// A fixed ProductCurrencyPrice replaces the converted regular price, and discounts are applied on top of it.
+func PresentProducts(db *gorm.DB, products []models.Product, currency string) error {
+	converter, err := NewConverter(db, currency)
+	if err != nil {
+		return err
+	}
+	return presentProducts(db, products, converter)
+}
+
+func presentProducts(db *gorm.DB, products []models.Product, converter *Converter) error {
+	if converter.Currency == BaseCurrency() || len(products) == 0 {
+		for i := range products {
+			products[i].Currency = converter.Currency
+		}
+		return nil
+	}
+
+	overrides, err := currencyPriceOverrides(db, products, converter.Currency)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		product := &products[i]
+		if override, ok := overrides[product.ID]; ok {
+			product.Price = override
+		} else {
+			product.Price = converter.Convert(product.Price)
+		}
+
+		var salePrice float64
+		if product.SalePrice != nil {
+			salePrice = converter.Convert(*product.SalePrice)
+			product.SalePrice = &salePrice
+		}
+		if product.LowestPrice30Days != nil {
+			lowest := converter.Convert(*product.LowestPrice30Days)
+			product.LowestPrice30Days = &lowest
+		}
+
+		product.EffectivePrice = product.Price
+		if product.Discount > 0 && product.Discount < 100 {
+			product.EffectivePrice = product.Price * (1 - product.Discount/100)
+		}
+		if product.SalePrice != nil && salePrice < product.EffectivePrice {
+			product.EffectivePrice = salePrice
+		}
+		product.EffectivePrice = converter.Round(product.EffectivePrice)
+		product.Currency = converter.Currency
+	}
+	return nil
+}
+
+func currencyPriceOverrides(db *gorm.DB, products []models.Product, currency string) (map[uint]float64, error) {
+	ids := make([]uint, len(products))
+	for i := range products {
+		ids[i] = products[i].ID
+	}
+
+	var rows []models.ProductCurrencyPrice
+	if err := db.Where("product_id IN ? AND currency = ?", ids, currency).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	overrides := make(map[uint]float64, len(rows))
+	for _, row := range rows {
+		overrides[uint(row.ProductID)] = row.Price
+	}
+	return overrides, nil
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+)
+
+func TestRoundAmount(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount float64
+		rules  models.Currency
+		want   float64
+	}{
+		{"cents", 10.005, models.Currency{Code: "USD", Decimals: 2}, 10.01},
+		{"no decimals", 1234.5, models.Currency{Code: "JPY", Decimals: 0}, 1235},
+		{"three decimals", 1.23456, models.Currency{Code: "KWD", Decimals: 3}, 1.235},
+		{"rounding increment", 10.12, models.Currency{Code: "CHF", Decimals: 2, RoundingIncrement: 0.05}, 10.1},
+		{"rounding increment up", 10.13, models.Currency{Code: "CHF", Decimals: 2, RoundingIncrement: 0.05}, 10.15},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := RoundAmount(test.amount, test.rules); got != test.want {
+				t.Errorf("RoundAmount(%v) = %v, want %v", test.amount, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errors returned when a download link cannot be honoured.
+var (
+	ErrDownloadLinkInvalid  = errors.New("invalid download link")
+	ErrDownloadLinkExpired  = errors.New("download link has expired")
+	ErrDownloadLimitReached = errors.New("download limit reached")
+)
+
+// DownloadLink is a signed, expiring URL for one download grant.
+type DownloadLink struct {
+	URL                string    `json:"url"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	DownloadsRemaining int       `json:"downloads_remaining"`
+}
+
+// DigitalDelivery is what the buyer of a digital order item receives: a download link, licence keys, or both.
+type DigitalDelivery struct {
+	OrderItemID int           `json:"order_item_id"`
+	ProductID   int           `json:"product_id"`
+	Download    *DownloadLink `json:"download,omitempty"`
+	LicenceKeys []string      `json:"licence_keys,omitempty"`
+}
+
+// downloadSecret is the HMAC key for download links, DOWNLOAD_SIGNING_SECRET or the JWT secret when unset.
+func downloadSecret() []byte {
+	if secret := os.Getenv("DOWNLOAD_SIGNING_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte(os.Getenv("JWT_SECRET_KEY"))
+}
+
+// DownloadLinkTTL is how long a signed download link stays valid, from DOWNLOAD_LINK_TTL (default 24h).
+func DownloadLinkTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("DOWNLOAD_LINK_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 24 * time.Hour
+}
+
+// SignDownload returns the hex HMAC-SHA256 signature of a grant and expiry.
+func SignDownload(grantID uint, expires int64) string {
+	mac := hmac.New(sha256.New, downloadSecret())
+	fmt.Fprintf(mac, "%d:%d", grantID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyDownload checks the signature and expiry of a download link.
+func VerifyDownload(grantID uint, expires int64, signature string) error {
+	expected := SignDownload(grantID, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrDownloadLinkInvalid
+	}
+	if time.Now().Unix() > expires {
+		return ErrDownloadLinkExpired
+	}
+	return nil
+}
+
+// NewDownloadLink signs a fresh link for a grant. Links are relative unless APP_BASE_URL is set.
+func NewDownloadLink(grant models.DownloadGrant) *DownloadLink {
+	expiresAt := time.Now().Add(DownloadLinkTTL()).Truncate(time.Second)
+	expires := expiresAt.Unix()
+	url := fmt.Sprintf("%s/api/v1/downloads/%d?expires=%d&signature=%s",
+		strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/"), grant.ID, expires, SignDownload(grant.ID, expires))
+
+	return &DownloadLink{
+		URL:                url,
+		ExpiresAt:          expiresAt,
+		DownloadsRemaining: grant.MaxDownloads - grant.DownloadCount,
+	}
+}
+
+// OrderDeliveries signs fresh download links and collects the licence keys for every digital item of an order.
+func OrderDeliveries(db *gorm.DB, orderID int) ([]DigitalDelivery, error) {
+	var items []models.OrderItem
+	err := db.Joins("JOIN products ON products.id = order_items.product_id AND products.type = ?", models.ProductTypeDigital).
+		Where("order_items.order_id = ?", orderID).Order("order_items.id").Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]DigitalDelivery, 0, len(items))
+	for _, item := range items {
+		delivery := DigitalDelivery{OrderItemID: int(item.ID), ProductID: item.ProductID}
+
+		var grant models.DownloadGrant
+		if err := db.Where("order_item_id = ?", item.ID).First(&grant).Error; err == nil {
+			delivery.Download = NewDownloadLink(grant)
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		if err := db.Model(&models.LicenceKey{}).Where("order_item_id = ?", item.ID).Order("id").Pluck("key", &delivery.LicenceKeys).Error; err != nil {
+			return nil, err
+		}
+		if delivery.Download != nil || len(delivery.LicenceKeys) > 0 {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+// ConsumeDownload counts one download against a grant and returns the file to serve.
+// The guarded UPDATE keeps concurrent downloads from exceeding the limit.
+func ConsumeDownload(db *gorm.DB, grantID uint) (*models.DigitalAsset, error) {
+	var grant models.DownloadGrant
+	if err := db.First(&grant, grantID).Error; err != nil {
+		return nil, ErrDownloadLinkInvalid
+	}
+
+	var asset models.DigitalAsset
+	if err := db.Where("product_id = ?", grant.ProductID).First(&asset).Error; err != nil {
+		return nil, err
+	}
+
+	result := db.Model(&models.DownloadGrant{}).
+		Where("id = ? AND download_count < max_downloads", grant.ID).
+		UpdateColumn("download_count", gorm.Expr("download_count + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrDownloadLimitReached
+	}
+	return &asset, nil
+}
+
+// DigitalFilePath resolves an asset to a path inside DIGITAL_FILES_DIR (default ./downloads),
+// never outside it.
+func DigitalFilePath(asset *models.DigitalAsset) string {
+	dir := os.Getenv("DIGITAL_FILES_DIR")
+	if dir == "" {
+		dir = "./downloads"
+	}
+	return filepath.Join(dir, filepath.Clean("/"+asset.FilePath))
+}
+
+// DigitalProductIDs returns which of the given products are digital.
+func DigitalProductIDs(db *gorm.DB, productIDs []int) (map[int]bool, error) {
+	digital := map[int]bool{}
+	if len(productIDs) == 0 {
+		return digital, nil
+	}
+
+	var ids []int
+	if err := db.Model(&models.Product{}).Where("id IN ? AND type = ?", productIDs, models.ProductTypeDigital).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		digital[id] = true
+	}
+	return digital, nil
+}
+
+// FulfilDigitalItems issues download grants and licence keys for the digital items of a paid order.
+// It is safe to call more than once: existing grants are kept and only missing keys are handed out.
+func FulfilDigitalItems(tx *gorm.DB, order *models.Order) error {
+	var items []models.OrderItem
+	if err := tx.Where("order_id = ?", order.ID).Find(&items).Error; err != nil {
+		return err
+	}
+
+	productIDs := make([]int, len(items))
+	for i, item := range items {
+		productIDs[i] = item.ProductID
+	}
+	digital, err := DigitalProductIDs(tx, productIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if !digital[item.ProductID] {
+			continue
+		}
+
+		var asset models.DigitalAsset
+		if err := tx.Where("product_id = ?", item.ProductID).First(&asset).Error; err == nil {
+			grant := models.DownloadGrant{
+				OrderID:      int(order.ID),
+				OrderItemID:  int(item.ID),
+				ProductID:    item.ProductID,
+				UserID:       order.UserID,
+				MaxDownloads: asset.MaxDownloads * item.Quantity,
+			}
+			if err := tx.Where(models.DownloadGrant{OrderItemID: int(item.ID)}).FirstOrCreate(&grant).Error; err != nil {
+				return err
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := assignLicenceKeys(tx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignLicenceKeys hands out one unassigned key per purchased unit from the product's pool, if it has one.
+// SKIP LOCKED lets concurrent fulfilments claim different keys without waiting on each other.
+func assignLicenceKeys(tx *gorm.DB, item models.OrderItem) error {
+	var assigned int64
+	if err := tx.Model(&models.LicenceKey{}).Where("order_item_id = ?", item.ID).Count(&assigned).Error; err != nil {
+		return err
+	}
+	needed := item.Quantity - int(assigned)
+	if needed <= 0 {
+		return nil
+	}
+
+	var keys []models.LicenceKey
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("product_id = ? AND order_item_id IS NULL", item.ProductID).
+		Order("id").Limit(needed).Find(&keys).Error
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if len(keys) < needed {
+		log.Printf("Licence key pool for product %d is short by %d keys for order item %d", item.ProductID, needed-len(keys), item.ID)
+	}
+
+	ids := make([]uint, len(keys))
+	for i, key := range keys {
+		ids[i] = key.ID
+	}
+	orderItemID := int(item.ID)
+	return tx.Model(&models.LicenceKey{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"order_item_id": orderItemID,
+		"assigned_at":   time.Now(),
+	}).Error
+}
+
+// CompleteOrderPayment marks an order as paid and fulfils its digital items, then emails the buyer
+// their download links and licence keys. Calling it again for a paid order fulfils anything still
+// missing without emailing the buyer a second time.
+func CompleteOrderPayment(db *gorm.DB, orderID int) error {
+	var order models.Order
+	alreadyPaid := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error; err != nil {
+			return err
+		}
+		alreadyPaid = order.OrderPaymentStatus == "Paid"
+		if err := tx.Model(&order).UpdateColumn("order_payment_status", "Paid").Error; err != nil {
+			return err
+		}
+		if !alreadyPaid {
+			short, err := CommitOrderReservations(tx, orderID)
+			if err != nil {
+				return err
+			}
+			if len(short) > 0 {
+				// Paid after its reservation lapsed and the stock was sold meanwhile
+				log.Printf("Order %d was paid but products %v are out of stock; marking it backordered", orderID, short)
+				if err := tx.Model(&order).UpdateColumn("order_status", "Backordered").Error; err != nil {
+					return err
+				}
+			}
+		}
+		return FulfilDigitalItems(tx, &order)
+	})
+	if err != nil || alreadyPaid {
+		return err
+	}
+
+	deliveries, err := OrderDeliveries(db, orderID)
+	if err != nil || len(deliveries) == 0 {
+		return err
+	}
+
+	var user models.User
+	if err := db.First(&user, order.UserID).Error; err != nil {
+		return err
+	}
+	if err := utils.SendEmail(user.Email, "Your downloads", downloadEmailBody(order, deliveries)); err != nil {
+		log.Printf("Error emailing download links for order %d: %v", order.ID, err)
+	}
+	return nil
+}
+
+// downloadEmailBody lists the download links and licence keys of an order.
+func downloadEmailBody(order models.Order, deliveries []DigitalDelivery) string {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Thank you for your order #%d. Your digital items are ready:\n\n", order.ID)
+	for _, delivery := range deliveries {
+		fmt.Fprintf(&body, "Product %d\n", delivery.ProductID)
+		if delivery.Download != nil {
+			fmt.Fprintf(&body, "  Download: %s\n  %d downloads, link valid until %s\n",
+				delivery.Download.URL, delivery.Download.DownloadsRemaining, delivery.Download.ExpiresAt.Format(time.RFC1123))
+		}
+		for _, key := range delivery.LicenceKeys {
+			fmt.Fprintf(&body, "  Licence key: %s\n", key)
+		}
+	}
+	fmt.Fprintf(&body, "\nExpired links can be renewed from your order at /api/v1/orders/%d/downloads.\n", order.ID)
+	return body.String()
+}
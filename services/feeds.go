@@ -0,0 +1,403 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// feedBatchSize is how many products are loaded at a time while writing a feed.
+const feedBatchSize = 500
+
+// ErrUnknownFeed is returned for a feed name that is not generated.
+var ErrUnknownFeed = errors.New("unknown feed")
+
+// FeedItem is one product of a shopping feed, in the attributes of the Google Merchant product data specification.
+type FeedItem struct {
+	XMLName               xml.Name `xml:"item"`
+	ID                    string   `xml:"g:id"`
+	Title                 string   `xml:"g:title"`
+	Description           string   `xml:"g:description"`
+	Link                  string   `xml:"g:link"`
+	ImageLink             string   `xml:"g:image_link,omitempty"`
+	Availability          string   `xml:"g:availability"`
+	Price                 string   `xml:"g:price"`
+	SalePrice             string   `xml:"g:sale_price,omitempty"`
+	SalePriceEffective    string   `xml:"g:sale_price_effective_date,omitempty"`
+	Brand                 string   `xml:"g:brand,omitempty"`
+	GTIN                  string   `xml:"g:gtin,omitempty"`
+	MPN                   string   `xml:"g:mpn,omitempty"`
+	IdentifierExists      string   `xml:"g:identifier_exists,omitempty"`
+	Condition             string   `xml:"g:condition"`
+	GoogleProductCategory string   `xml:"g:google_product_category,omitempty"`
+	ProductType           string   `xml:"g:product_type,omitempty"`
+	ShippingWeight        string   `xml:"g:shipping_weight,omitempty"`
+}
+
+// feedCSVHeader are the columns of the CSV feed, named as in the Google Merchant specification.
+var feedCSVHeader = []string{
+	"id", "title", "description", "link", "image_link", "availability", "price", "sale_price",
+	"sale_price_effective_date", "brand", "gtin", "mpn", "identifier_exists", "condition",
+	"google_product_category", "product_type", "shipping_weight",
+}
+
+func (item FeedItem) csvRecord() []string {
+	return []string{
+		item.ID, item.Title, item.Description, item.Link, item.ImageLink, item.Availability, item.Price, item.SalePrice,
+		item.SalePriceEffective, item.Brand, item.GTIN, item.MPN, item.IdentifierExists, item.Condition,
+		item.GoogleProductCategory, item.ProductType, item.ShippingWeight,
+	}
+}
+
+// feedWriter streams feed items into a feed file. begin is called once, then add for every item.
+type feedWriter interface {
+	begin() error
+	add(item FeedItem) error
+	end() error
+}
+
+// Feeds are the generated feeds by file name, served under /feeds/.
+var Feeds = map[string]func(w io.Writer) feedWriter{
+	"google.xml":   newGoogleFeedWriter,
+	"products.csv": newCSVFeedWriter,
+}
+
+// FeedContentTypes are the content types the feeds are served with.
+var FeedContentTypes = map[string]string{
+	"google.xml":   "application/xml; charset=utf-8",
+	"products.csv": "text/csv; charset=utf-8",
+}
+
+type googleFeedWriter struct {
+	w   io.Writer
+	enc *xml.Encoder
+}
+
+func newGoogleFeedWriter(w io.Writer) feedWriter {
+	return &googleFeedWriter{w: w, enc: xml.NewEncoder(w)}
+}
+
+func (f *googleFeedWriter) begin() error {
+	storeURL := strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/")
+	_, err := fmt.Fprintf(f.w, "%s<rss version=\"2.0\" xmlns:g=\"http://base.google.com/ns/1.0\">\n<channel>\n<title>%s</title>\n<link>%s</link>\n<description>%s</description>\n",
+		xml.Header, xmlEscape(feedTitle()), xmlEscape(storeURL), xmlEscape(feedTitle()+" product feed"))
+	return err
+}
+
+func (f *googleFeedWriter) add(item FeedItem) error {
+	if err := f.enc.Encode(item); err != nil {
+		return err
+	}
+	_, err := io.WriteString(f.w, "\n")
+	return err
+}
+
+func (f *googleFeedWriter) end() error {
+	if err := f.enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(f.w, "</channel>\n</rss>\n")
+	return err
+}
+
+type csvFeedWriter struct {
+	w *csv.Writer
+}
+
+func newCSVFeedWriter(w io.Writer) feedWriter {
+	return &csvFeedWriter{w: csv.NewWriter(w)}
+}
+
+func (f *csvFeedWriter) begin() error { return f.w.Write(feedCSVHeader) }
+
+func (f *csvFeedWriter) add(item FeedItem) error { return f.w.Write(item.csvRecord()) }
+
+func (f *csvFeedWriter) end() error {
+	f.w.Flush()
+	return f.w.Error()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// feedTitle names the store in feeds, from FEED_TITLE (default "Product feed").
+func feedTitle() string {
+	if title := os.Getenv("FEED_TITLE"); title != "" {
+		return title
+	}
+	return "Product feed"
+}
+
+// FeedsDir is where generated feeds are written, from FEEDS_DIR (default ./feeds).
+func FeedsDir() string {
+	if dir := os.Getenv("FEEDS_DIR"); dir != "" {
+		return dir
+	}
+	return "./feeds"
+}
+
+// FeedInterval is how often feeds are regenerated, from FEED_INTERVAL (default 1h).
+func FeedInterval() time.Duration {
+	if interval, err := time.ParseDuration(os.Getenv("FEED_INTERVAL")); err == nil && interval > 0 {
+		return interval
+	}
+	return time.Hour
+}
+
+// FeedPath is the file a feed is served from.
+func FeedPath(name string) (string, error) {
+	if _, ok := Feeds[name]; !ok {
+		return "", ErrUnknownFeed
+	}
+	return filepath.Join(FeedsDir(), name), nil
+}
+
+// generateFeedsMu keeps the scheduled run and admin-triggered runs from writing feeds at the same time.
+var generateFeedsMu sync.Mutex
+
+// GenerateFeeds writes every feed of the published catalog. Each feed is written to a temporary file and
+// renamed into place, so a feed being downloaded is never cut short by the next run. The hash of each
+// feed is stored next to it to serve as its ETag, and a feed whose content has not changed is kept.
+func GenerateFeeds() error {
+	generateFeedsMu.Lock()
+	defer generateFeedsMu.Unlock()
+
+	if err := os.MkdirAll(FeedsDir(), 0o755); err != nil {
+		return err
+	}
+
+	var categories []models.Category
+	if err := config.DB.Find(&categories).Error; err != nil {
+		return err
+	}
+	categoriesByID := make(map[int]models.Category, len(categories))
+	for _, category := range categories {
+		categoriesByID[int(category.ID)] = category
+	}
+
+	for name, newWriter := range Feeds {
+		if err := writeFeed(config.DB, name, newWriter, categoriesByID); err != nil {
+			return fmt.Errorf("writing feed %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func writeFeed(db *gorm.DB, name string, newWriter func(io.Writer) feedWriter, categories map[int]models.Category) error {
+	path, err := FeedPath(name)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+name+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	buffered := bufio.NewWriter(io.MultiWriter(tmp, hash))
+	feed := newWriter(buffered)
+	if err := feed.begin(); err != nil {
+		return err
+	}
+
+	var batch []models.Product
+	err = db.Scopes(PublishedProducts).FindInBatches(&batch, feedBatchSize, func(tx *gorm.DB, _ int) error {
+		items, err := feedItems(db, batch, categories)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := feed.add(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	if err := feed.end(); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// An unchanged feed is left in place so clients polling with If-None-Match keep getting 304
+	etag := hex.EncodeToString(hash.Sum(nil))
+	if previous, err := FeedETag(name); err == nil && previous == etag {
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return writeFileAtomically(path+feedETagSuffix, []byte(etag))
+}
+
+// feedETagSuffix names the file next to a feed that holds the SHA-256 of its content.
+const feedETagSuffix = ".etag"
+
+// FeedETag returns the SHA-256 of a feed's content, recorded when it was generated.
+func FeedETag(name string) (string, error) {
+	path, err := FeedPath(name)
+	if err != nil {
+		return "", err
+	}
+	etag, err := os.ReadFile(path + feedETagSuffix)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(etag)), nil
+}
+
+// writeFileAtomically replaces a file through a temporary file and a rename.
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// feedItems converts published products to feed items, with stock, prices and active sales applied.
+func feedItems(db *gorm.DB, products []models.Product, categories map[int]models.Category) ([]FeedItem, error) {
+	if err := ApplyPricing(products); err != nil {
+		return nil, err
+	}
+	if err := ApplyBundleAvailability(db, products); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	sales, err := activeSales(db, ids, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]FeedItem, len(products))
+	for i, product := range products {
+		item := FeedItem{
+			ID:           product.SKU,
+			Title:        product.Name,
+			Description:  product.Description,
+			Link:         CanonicalURL(models.SlugEntityProduct, product.Slug),
+			ImageLink:    absoluteURL(product.Image),
+			Availability: feedAvailability(product),
+			Price:        feedPrice(product.Price, product.Currency),
+			Brand:        product.Brand,
+			MPN:          product.SKU,
+			Condition:    "new",
+		}
+		if item.ID == "" {
+			item.ID = strconv.Itoa(int(product.ID))
+		}
+		if product.EffectivePrice < product.Price {
+			item.SalePrice = feedPrice(product.EffectivePrice, product.Currency)
+			if sale := sales[int(product.ID)]; sale != nil {
+				item.SalePriceEffective = sale.StartsAt.UTC().Format(time.RFC3339) + "/" + sale.EndsAt.UTC().Format(time.RFC3339)
+			}
+		}
+		if ValidGTIN(product.GTIN) {
+			item.GTIN = product.GTIN
+		}
+		if item.GTIN == "" && item.Brand == "" {
+			item.IdentifierExists = "no"
+		}
+		if category, ok := categories[product.CategoryID]; ok {
+			item.GoogleProductCategory = category.GoogleProductCategory
+			item.ProductType = category.Name
+		}
+		if product.Weight > 0 && product.Type != models.ProductTypeDigital {
+			item.ShippingWeight = strconv.FormatFloat(product.Weight, 'f', -1, 64) + " kg"
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+// feedAvailability derives the feed availability from stock. Digital products are always available.
+func feedAvailability(product models.Product) string {
+	if product.Type == models.ProductTypeDigital || product.Quantity > 0 {
+		return "in_stock"
+	}
+	return "out_of_stock"
+}
+
+func feedPrice(amount float64, currency string) string {
+	return fmt.Sprintf("%.2f %s", amount, currency)
+}
+
+// absoluteURL prefixes relative image paths with APP_BASE_URL.
+func absoluteURL(path string) string {
+	if path == "" || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// ValidGTIN reports whether gtin is a GTIN-8, UPC (GTIN-12), EAN (GTIN-13) or GTIN-14 with a correct check digit.
+func ValidGTIN(gtin string) bool {
+	switch len(gtin) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+
+	sum := 0
+	for i := len(gtin) - 1; i >= 0; i-- {
+		digit := gtin[i]
+		if digit < '0' || digit > '9' {
+			return false
+		}
+		weight := 1
+		if (len(gtin)-1-i)%2 == 1 {
+			weight = 3
+		}
+		sum += int(digit-'0') * weight
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,27 @@
+package services
+
+import "testing"
+
+func TestValidGTIN(t *testing.T) {
+	tests := []struct {
+		gtin string
+		want bool
+	}{
+		{"96385074", true},       // GTIN-8
+		{"036000291452", true},   // UPC
+		{"4006381333931", true},  // EAN
+		{"10012345678902", true}, // GTIN-14
+		{"4006381333932", false}, // wrong check digit
+		{"400638133393", false},  // wrong length for its check digit
+		{"40063813339", false},   // 11 digits
+		{"400638133393A", false}, // not a digit
+		{"", false},
+	}
+	for _, test := range tests {
+		t.Run(test.gtin, func(t *testing.T) {
+			if got := ValidGTIN(test.gtin); got != test.want {
+				t.Errorf("ValidGTIN(%q) = %v, want %v", test.gtin, got, test.want)
+			}
+		})
+	}
+}
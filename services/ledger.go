@@ -0,0 +1,264 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ManualMovementReasons are the reasons an admin can record a movement with; sales and transfers are
+// only posted by checkout and transfer orders.
+var ManualMovementReasons = map[string]bool{
+	models.MovementReturn:     true,
+	models.MovementAdjustment: true,
+	models.MovementDamage:     true,
+	models.MovementRestock:    true,
+}
+
+// ProtectStockLedger installs a database trigger that rejects updates and deletes of stock movements, so
+// the ledger stays append-only for writes that bypass the model hooks as well. It is run at startup.
+func ProtectStockLedger() error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			CREATE OR REPLACE FUNCTION reject_stock_movement_change() RETURNS trigger AS $$
+			BEGIN
+				RAISE EXCEPTION 'stock movements cannot be changed';
+			END;
+			$$ LANGUAGE plpgsql`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DROP TRIGGER IF EXISTS stock_movements_append_only ON stock_movements").Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			CREATE TRIGGER stock_movements_append_only
+			BEFORE UPDATE OR DELETE OR TRUNCATE ON stock_movements
+			FOR EACH STATEMENT EXECUTE FUNCTION reject_stock_movement_change()`).Error
+	})
+}
+
+// lockProducts locks the rows of products in ID order. Stock changes lock a product before its inventory
+// rows (see PostStockMovement), so code changing the stock of several products locks them all up front:
+// two transactions then never hold one product each while waiting for the other's.
+func lockProducts(tx *gorm.DB, productIDs []int) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+	return tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id IN ?", productIDs).
+		Order("id").Find(&[]models.Product{}).Error
+}
+
+// PostStockMovement records a change to the stock of a product at a warehouse in the ledger and applies
+// it: the location's inventory row moves by Delta, created if needed, and the product's Quantity is
+// recomputed as the total over its locations. A location cannot go below zero. movement.Balance is set
+// to the stock of the location after the movement.
+func PostStockMovement(tx *gorm.DB, movement *models.StockMovement) error {
+	if movement.Delta == 0 {
+		return nil
+	}
+
+	var product models.Product
+	if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "type").First(&product, movement.ProductID).Error; err != nil {
+		return fmt.Errorf("product %d not found", movement.ProductID)
+	}
+	if !stocksProduct(&product) {
+		return fmt.Errorf("product %d is a %s and has no stock of its own", movement.ProductID, product.Type)
+	}
+
+	if movement.Delta > 0 {
+		if err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.Inventory{ProductID: movement.ProductID, WarehouseID: movement.WarehouseID}).Error; err != nil {
+			return err
+		}
+	}
+	var inventory models.Inventory
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id = ? AND warehouse_id = ?", movement.ProductID, movement.WarehouseID).First(&inventory).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if inventory.Quantity+movement.Delta < 0 {
+		return fmt.Errorf("%w for product %d at warehouse %d", ErrInsufficientStock, movement.ProductID, movement.WarehouseID)
+	}
+
+	movement.Balance = inventory.Quantity + movement.Delta
+	if err := tx.Model(&inventory).UpdateColumn("quantity", movement.Balance).Error; err != nil {
+		return err
+	}
+	if err := syncProductStock(tx, movement.ProductID); err != nil {
+		return err
+	}
+	movement.ID, movement.CreatedAt = 0, time.Time{}
+	return tx.Create(movement).Error
+}
+
+// syncProductStock sets a product's Quantity to the total of its locations.
+func syncProductStock(tx *gorm.DB, productID int) error {
+	return tx.Model(&models.Product{}).Unscoped().Where("id = ?", productID).
+		UpdateColumn("quantity", tx.Model(&models.Inventory{}).Select("COALESCE(SUM(quantity), 0)").Where("product_id = ?", productID)).Error
+}
+
+// StockMovementFilter narrows the movement history of a product. Zero values match everything.
+type StockMovementFilter struct {
+	WarehouseID int
+	Reason      string
+	From        time.Time
+	To          time.Time
+}
+
+// ProductStockMovements returns a page of the movements of a product, newest first, with the total
+// number of movements matching the filter.
+func ProductStockMovements(db *gorm.DB, productID int, filter StockMovementFilter, offset, limit int) ([]models.StockMovement, int64, error) {
+	query := db.Model(&models.StockMovement{}).Where("product_id = ?", productID)
+	if filter.WarehouseID != 0 {
+		query = query.Where("warehouse_id = ?", filter.WarehouseID)
+	}
+	if filter.Reason != "" {
+		query = query.Where("reason = ?", filter.Reason)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	movements := []models.StockMovement{}
+	err := query.Order("created_at desc, id desc").Offset(offset).Limit(limit).Find(&movements).Error
+	return movements, total, err
+}
+
+// ValuationLine is the stock of a product at one warehouse in a valuation report.
+type ValuationLine struct {
+	ProductID   int     `json:"product_id"`
+	SKU         string  `json:"sku"`
+	Name        string  `json:"name"`
+	WarehouseID int     `json:"warehouse_id"`
+	Quantity    int     `json:"quantity"`
+	UnitCost    float64 `json:"unit_cost"`
+	Costed      bool    `json:"costed"` // false when the product was never received from a supplier
+	Value       float64 `json:"value"`
+}
+
+// StockValuation is the stock on hand at a point in time, valued at weighted average purchase cost.
+type StockValuation struct {
+	At            time.Time       `json:"at"`
+	Currency      string          `json:"currency"`
+	TotalUnits    int             `json:"total_units"`
+	TotalValue    float64         `json:"total_value"`
+	UncostedUnits int             `json:"uncosted_units"`
+	Lines         []ValuationLine `json:"lines"`
+}
+
+// stockReceipt is a delivery of a product from a supplier: the units restocked and their unit cost
+// on the purchase order.
+type stockReceipt struct {
+	ProductID int
+	Quantity  int
+	UnitCost  float64
+}
+
+// averageCosts returns the weighted average unit cost of every product received, by product ID.
+func averageCosts(receipts []stockReceipt) map[int]float64 {
+	units := make(map[int]int)
+	costs := make(map[int]float64)
+	for _, receipt := range receipts {
+		units[receipt.ProductID] += receipt.Quantity
+		costs[receipt.ProductID] += float64(receipt.Quantity) * receipt.UnitCost
+	}
+	averages := make(map[int]float64, len(units))
+	for productID, quantity := range units {
+		if quantity > 0 {
+			averages[productID] = costs[productID] / float64(quantity)
+		}
+	}
+	return averages
+}
+
+// ValueStock builds the stock valuation at a point in time from the ledger: the balance of every
+// location is that of its last movement up to at, and units are valued at the weighted average unit
+// cost of the product's purchase order deliveries up to that time. Products never received from a
+// supplier have no cost; they are valued at 0 and counted in UncostedUnits. warehouseID limits the
+// report to one warehouse when it is not 0.
+func ValueStock(db *gorm.DB, at time.Time, warehouseID int) (*StockValuation, error) {
+	balances := db.Model(&models.StockMovement{}).
+		Select("DISTINCT ON (product_id, warehouse_id) product_id, warehouse_id, balance").
+		Where("created_at <= ?", at).
+		Order("product_id, warehouse_id, created_at desc, id desc")
+	if warehouseID != 0 {
+		balances = balances.Where("warehouse_id = ?", warehouseID)
+	}
+	var rows []struct {
+		ProductID   int
+		WarehouseID int
+		Balance     int
+	}
+	if err := db.Table("(?) AS balances", balances).Where("balance <> 0").Order("product_id, warehouse_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	valuation := &StockValuation{At: at, Currency: BaseCurrency(), Lines: []ValuationLine{}}
+	if len(rows) == 0 {
+		return valuation, nil
+	}
+	productIDs := make([]int, len(rows))
+	for i, row := range rows {
+		productIDs[i] = row.ProductID
+	}
+
+	var products []models.Product
+	if err := db.Unscoped().Select("id", "sku", "name").Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	productsByID := make(map[int]models.Product, len(products))
+	for _, product := range products {
+		productsByID[int(product.ID)] = product
+	}
+
+	// Every delivery is a restock movement referring to its purchase order, so the deliveries up to at
+	// are those movements joined to the order's line for the product.
+	itemCosts := db.Model(&models.PurchaseOrderItem{}).
+		Select("purchase_order_id, product_id, AVG(unit_cost) AS unit_cost").
+		Group("purchase_order_id, product_id")
+	var receipts []stockReceipt
+	if err := db.Table("stock_movements").
+		Select("stock_movements.product_id, stock_movements.delta AS quantity, items.unit_cost").
+		Joins("JOIN (?) AS items ON items.purchase_order_id = stock_movements.reference_id AND items.product_id = stock_movements.product_id", itemCosts).
+		Where("stock_movements.reason = ? AND stock_movements.reference_type = ?", models.MovementRestock, models.MovementRefPurchaseOrder).
+		Where("stock_movements.product_id IN ? AND stock_movements.created_at <= ?", productIDs, at).
+		Scan(&receipts).Error; err != nil {
+		return nil, err
+	}
+	costs := averageCosts(receipts)
+
+	for _, row := range rows {
+		product := productsByID[row.ProductID]
+		unitCost, costed := costs[row.ProductID]
+		line := ValuationLine{
+			ProductID:   row.ProductID,
+			SKU:         product.SKU,
+			Name:        product.Name,
+			WarehouseID: row.WarehouseID,
+			Quantity:    row.Balance,
+			UnitCost:    unitCost,
+			Costed:      costed,
+			Value:       float64(row.Balance) * unitCost,
+		}
+		valuation.Lines = append(valuation.Lines, line)
+		valuation.TotalUnits += line.Quantity
+		valuation.TotalValue += line.Value
+		if !costed {
+			valuation.UncostedUnits += line.Quantity
+		}
+	}
+	return valuation, nil
+}
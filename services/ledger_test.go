@@ -0,0 +1,34 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAverageCosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		receipts []stockReceipt
+		want     map[int]float64
+	}{
+		{"no receipts", nil, map[int]float64{}},
+		{"one receipt", []stockReceipt{{ProductID: 1, Quantity: 4, UnitCost: 2.5}}, map[int]float64{1: 2.5}},
+		{
+			name: "weighted by units received",
+			receipts: []stockReceipt{
+				{ProductID: 1, Quantity: 10, UnitCost: 2},
+				{ProductID: 1, Quantity: 30, UnitCost: 4},
+				{ProductID: 2, Quantity: 1, UnitCost: 9},
+			},
+			want: map[int]float64{1: 3.5, 2: 9},
+		},
+		{"free goods", []stockReceipt{{ProductID: 1, Quantity: 5, UnitCost: 0}}, map[int]float64{1: 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := averageCosts(test.receipts); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("averageCosts() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// PublishedProducts is a query scope restricting products to the public catalog.
+func PublishedProducts(db *gorm.DB) *gorm.DB {
+	return db.Where("products.status = ?", models.ProductStatusPublished)
+}
+
+// ValidateProductLifecycle checks the status and the publish/unpublish schedule of a product.
+func ValidateProductLifecycle(product *models.Product) error {
+	switch product.Status {
+	case "", models.ProductStatusDraft, models.ProductStatusPublished, models.ProductStatusArchived:
+	default:
+		return fmt.Errorf("invalid product status %q", product.Status)
+	}
+
+	if product.PublishAt != nil && product.UnpublishAt != nil && !product.UnpublishAt.After(*product.PublishAt) {
+		return fmt.Errorf("unpublish_at must be after publish_at")
+	}
+	return nil
+}
+
+// ApplyProductSchedules publishes drafts whose publish_at has passed and archives published products
+// whose unpublish_at has passed, then invalidates the caches of every product that changed state.
+func ApplyProductSchedules() error {
+	now := time.Now()
+	var changed []int
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var toPublish []int
+		if err := tx.Model(&models.Product{}).
+			Where("status = ? AND publish_at <= ? AND (unpublish_at IS NULL OR unpublish_at > ?)", models.ProductStatusDraft, now, now).
+			Pluck("id", &toPublish).Error; err != nil {
+			return err
+		}
+		if len(toPublish) > 0 {
+			if err := tx.Model(&models.Product{}).Where("id IN ?", toPublish).
+				Updates(map[string]interface{}{"status": models.ProductStatusPublished}).Error; err != nil {
+				return err
+			}
+		}
+
+		var toArchive []int
+		if err := tx.Model(&models.Product{}).
+			Where("status = ? AND unpublish_at <= ?", models.ProductStatusPublished, now).
+			Pluck("id", &toArchive).Error; err != nil {
+			return err
+		}
+		if len(toArchive) > 0 {
+			if err := tx.Model(&models.Product{}).Where("id IN ?", toArchive).
+				Updates(map[string]interface{}{"status": models.ProductStatusArchived}).Error; err != nil {
+				return err
+			}
+		}
+
+		changed = append(toPublish, toArchive...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(changed) > 0 {
+		log.Printf("Product scheduler changed the state of %d products", len(changed))
+		InvalidateProductCache(changed...)
+	}
+	return nil
+}
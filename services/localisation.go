@@ -0,0 +1,323 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// DefaultLanguage is the language product and category text is written in, from DEFAULT_LANGUAGE (default en).
+func DefaultLanguage() string {
+	if language, err := NormaliseLanguage(os.Getenv("DEFAULT_LANGUAGE")); err == nil {
+		return language
+	}
+	return "en"
+}
+
+// NormaliseLanguage validates a BCP 47 style language tag and lower-cases it, e.g. "pt_BR" becomes "pt-br".
+func NormaliseLanguage(tag string) (string, error) {
+	language := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if !languagePattern.MatchString(language) {
+		return "", fmt.Errorf("invalid language %q", tag)
+	}
+	return language, nil
+}
+
+// parseAcceptLanguage returns the languages of an Accept-Language header, most preferred first.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		language string
+		q        float64
+	}
+
+	var entries []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		language, err := NormaliseLanguage(fields[0])
+		if err != nil {
+			continue // also skips "*"
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			entries = append(entries, weighted{language, q})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].q > entries[j].q })
+
+	languages := make([]string, len(entries))
+	for i, entry := range entries {
+		languages[i] = entry.language
+	}
+	return languages
+}
+
+// ResolveLanguages builds the fallback chain content is localised with: an explicit request (?lang=),
+// then the user's Profile.PreferredLanguage, then the Accept-Language header, and finally the default
+// language. Each regional language is followed by its base language, so "fr-ca" falls back to "fr".
+func ResolveLanguages(db *gorm.DB, requested, acceptLanguage string, userID int) []string {
+	var candidates []string
+	if requested != "" {
+		candidates = append(candidates, requested)
+	}
+	if userID != 0 {
+		var profile models.Profile
+		if err := db.Select("preferred_language").Where("user_id = ?", userID).First(&profile).Error; err == nil && profile.PreferredLanguage != "" {
+			candidates = append(candidates, profile.PreferredLanguage)
+		}
+	}
+	candidates = append(candidates, parseAcceptLanguage(acceptLanguage)...)
+	candidates = append(candidates, DefaultLanguage())
+
+	var chain []string
+	seen := make(map[string]bool)
+	add := func(language string) {
+		if !seen[language] {
+			seen[language] = true
+			chain = append(chain, language)
+		}
+	}
+	for _, candidate := range candidates {
+		language, err := NormaliseLanguage(candidate)
+		if err != nil {
+			continue
+		}
+		add(language)
+		if base, _, regional := strings.Cut(language, "-"); regional {
+			add(base)
+		}
+	}
+	return chain
+}
+
+// translationLanguages is the part of a chain that needs translations: everything before the default
+// language, whose text is the products' own.
+func translationLanguages(languages []string) []string {
+	for i, language := range languages {
+		if language == DefaultLanguage() {
+			return languages[:i]
+		}
+	}
+	return languages
+}
+
+// translatedLanguagesTTL is how long the set of languages with translations is reused before it is reloaded.
+const translatedLanguagesTTL = time.Minute
+
+// translatedLanguagesCache holds the languages products or categories have translations in.
+var translatedLanguagesCache struct {
+	sync.Mutex
+	languages map[string]bool
+	loadedAt  time.Time
+}
+
+// translatedLanguages returns the languages products or categories have translations in.
+func translatedLanguages(db *gorm.DB) (map[string]bool, error) {
+	translatedLanguagesCache.Lock()
+	defer translatedLanguagesCache.Unlock()
+	if translatedLanguagesCache.languages != nil && time.Since(translatedLanguagesCache.loadedAt) < translatedLanguagesTTL {
+		return translatedLanguagesCache.languages, nil
+	}
+
+	var languages []string
+	if err := db.Raw("SELECT language FROM product_translations UNION SELECT language FROM category_translations").
+		Scan(&languages).Error; err != nil {
+		return nil, err
+	}
+	translatedLanguagesCache.languages = make(map[string]bool, len(languages))
+	for _, language := range languages {
+		translatedLanguagesCache.languages[language] = true
+	}
+	translatedLanguagesCache.loadedAt = time.Now()
+	return translatedLanguagesCache.languages, nil
+}
+
+// forgetTranslatedLanguages makes the next request reload the languages with translations.
+func forgetTranslatedLanguages() {
+	translatedLanguagesCache.Lock()
+	translatedLanguagesCache.languages = nil
+	translatedLanguagesCache.Unlock()
+}
+
+// TranslatedChain narrows a fallback chain to the languages that have translations, up to the default
+// language, and ends it with the default language. Localising with it gives the same text as the full
+// chain, so requests sharing it can share cache entries however their Accept-Language headers differ.
+func TranslatedChain(db *gorm.DB, languages []string) []string {
+	available, err := translatedLanguages(db)
+	if err != nil {
+		return languages
+	}
+	chain := []string{}
+	for _, language := range translationLanguages(languages) {
+		if available[language] {
+			chain = append(chain, language)
+		}
+	}
+	return append(chain, DefaultLanguage())
+}
+
+// LocaliseProducts replaces the name and description of products with their translation in the first
+// language of the chain that has one, field by field, and records the language used in Product.Language.
+func LocaliseProducts(db *gorm.DB, products []models.Product, languages []string) error {
+	for i := range products {
+		products[i].Language = DefaultLanguage()
+	}
+	wanted := translationLanguages(languages)
+	if len(products) == 0 || len(wanted) == 0 {
+		return nil
+	}
+
+	productIDs := make([]uint, len(products))
+	for i, product := range products {
+		productIDs[i] = product.ID
+	}
+	var translations []models.ProductTranslation
+	if err := db.Where("product_id IN ? AND language IN ?", productIDs, wanted).Find(&translations).Error; err != nil {
+		return err
+	}
+
+	byProduct := make(map[int]map[string]models.ProductTranslation)
+	for _, translation := range translations {
+		if byProduct[translation.ProductID] == nil {
+			byProduct[translation.ProductID] = make(map[string]models.ProductTranslation)
+		}
+		byProduct[translation.ProductID][translation.Language] = translation
+	}
+
+	for i := range products {
+		available := byProduct[int(products[i].ID)]
+		nameSet, descriptionSet := false, false
+		for _, language := range wanted {
+			translation, ok := available[language]
+			if !ok {
+				continue
+			}
+			if !nameSet && translation.Name != "" {
+				products[i].Name, products[i].Language, nameSet = translation.Name, language, true
+			}
+			if !descriptionSet && translation.Description != "" {
+				products[i].Description, descriptionSet = translation.Description, true
+			}
+		}
+	}
+	return nil
+}
+
+// LocaliseCategories replaces category names with their translation in the first language of the chain
+// that has one, and localises their preloaded products.
+func LocaliseCategories(db *gorm.DB, categories []models.Category, languages []string) error {
+	for i := range categories {
+		categories[i].Language = DefaultLanguage()
+		if err := LocaliseProducts(db, categories[i].Products, languages); err != nil {
+			return err
+		}
+	}
+	wanted := translationLanguages(languages)
+	if len(categories) == 0 || len(wanted) == 0 {
+		return nil
+	}
+
+	categoryIDs := make([]uint, len(categories))
+	for i, category := range categories {
+		categoryIDs[i] = category.ID
+	}
+	var translations []models.CategoryTranslation
+	if err := db.Where("category_id IN ? AND language IN ?", categoryIDs, wanted).Find(&translations).Error; err != nil {
+		return err
+	}
+
+	names := make(map[string]string, len(translations))
+	for _, translation := range translations {
+		names[fmt.Sprintf("%d:%s", translation.CategoryID, translation.Language)] = translation.Name
+	}
+	for i := range categories {
+		for _, language := range wanted {
+			if name, ok := names[fmt.Sprintf("%d:%s", categories[i].ID, language)]; ok {
+				categories[i].Name, categories[i].Language = name, language
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// SearchProductNames filters a product query to names matching search in the products' own language
+// or any translation in the chain.
+func SearchProductNames(query *gorm.DB, search string, languages []string) *gorm.DB {
+	pattern := "%" + search + "%"
+	wanted := translationLanguages(languages)
+	if len(wanted) == 0 {
+		return query.Where("products.name ILIKE ?", pattern)
+	}
+	return query.Where("(products.name ILIKE ? OR EXISTS (SELECT 1 FROM product_translations WHERE product_translations.product_id = products.id AND product_translations.language IN ? AND product_translations.name ILIKE ?))",
+		pattern, wanted, pattern)
+}
+
+// SetProductTranslation creates or replaces a product's translation into language.
+func SetProductTranslation(db *gorm.DB, productID int, language, name, description string) (*models.ProductTranslation, error) {
+	language, err := NormaliseLanguage(language)
+	if err != nil {
+		return nil, err
+	}
+	if language == DefaultLanguage() {
+		return nil, fmt.Errorf("%s is the default language; edit the product itself", language)
+	}
+	name, description = strings.TrimSpace(name), strings.TrimSpace(description)
+	if name == "" && description == "" {
+		return nil, errors.New("name or description is required")
+	}
+
+	translation := models.ProductTranslation{ProductID: productID, Language: language, Name: name, Description: description}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "language"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "updated_at"}),
+	}).Create(&translation).Error
+	if err != nil {
+		return nil, err
+	}
+	forgetTranslatedLanguages()
+	return &translation, nil
+}
+
+// SetCategoryTranslation creates or replaces a category's name in language.
+func SetCategoryTranslation(db *gorm.DB, categoryID int, language, name string) (*models.CategoryTranslation, error) {
+	language, err := NormaliseLanguage(language)
+	if err != nil {
+		return nil, err
+	}
+	if language == DefaultLanguage() {
+		return nil, fmt.Errorf("%s is the default language; edit the category itself", language)
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		return nil, errors.New("name is required")
+	}
+
+	translation := models.CategoryTranslation{CategoryID: categoryID, Language: language, Name: name}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "category_id"}, {Name: "language"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "updated_at"}),
+	}).Create(&translation).Error
+	if err != nil {
+		return nil, err
+	}
+	forgetTranslatedLanguages()
+	return &translation, nil
+}
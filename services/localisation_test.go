@@ -0,0 +1,30 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", []string{}},
+		{"fr", []string{"fr"}},
+		{"fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", []string{"fr-ch", "fr", "en", "de"}},
+		{"en;q=0.5, de", []string{"de", "en"}},
+		{"en;q=0.8, fr;q=0.8", []string{"en", "fr"}},
+		{"en_GB", []string{"en-gb"}},
+		{"en;q=0, fr", []string{"fr"}},
+		{"en;q=oops", []string{"en"}},
+		{"not a language, de", []string{"de"}},
+	}
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			if got := parseAcceptLanguage(test.header); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseAcceptLanguage(%q) = %v, want %v", test.header, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// Matches anything that looks like a URL or bare domain so link spam can be held for review
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)\S+|\b[a-z0-9-]+\.(com|net|org|io|biz|info|ru|xyz)\b`)
+
+// Number of abuse reports after which an approved review goes back to the moderation queue
+const defaultReviewReportThreshold = 3
+
+// bannedReviewWords returns the lowercased words configured in REVIEW_BANNED_WORDS (comma separated).
+func bannedReviewWords() []string {
+	var words []string
+	for _, word := range strings.Split(os.Getenv("REVIEW_BANNED_WORDS"), ",") {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// ReviewReportThreshold reads REVIEW_REPORT_THRESHOLD, falling back to the default when unset or invalid.
+func ReviewReportThreshold() int {
+	threshold, err := strconv.Atoi(os.Getenv("REVIEW_REPORT_THRESHOLD"))
+	if err != nil || threshold < 1 {
+		return defaultReviewReportThreshold
+	}
+	return threshold
+}
+
+// ModerateContent returns why user-written text should be held for moderation, or "" when it is clean.
+// Text containing banned words or links is held.
+func ModerateContent(text string) string {
+	lowered := strings.ToLower(text)
+
+	for _, word := range bannedReviewWords() {
+		if strings.Contains(lowered, word) {
+			return fmt.Sprintf("contains banned word %q", word)
+		}
+	}
+
+	if linkPattern.MatchString(text) {
+		return "contains a link"
+	}
+
+	return ""
+}
+
+// ModerateReviewContent decides the initial status of a review comment.
+// Comments that ModerateContent flags are held as pending together with the reason.
+func ModerateReviewContent(comment string) (string, string) {
+	if reason := ModerateContent(comment); reason != "" {
+		return models.ReviewStatusPending, reason
+	}
+	return models.ReviewStatusApproved, ""
+}
+
+// IsVerifiedPurchase reports whether the user has a delivered order containing the product.
+func IsVerifiedPurchase(db *gorm.DB, userID, productID int) (bool, error) {
+	var count int64
+	err := db.Model(&models.OrderItem{}).
+		Joins("JOIN orders ON orders.id = order_items.order_id AND orders.deleted_at IS NULL").
+		Where("orders.user_id = ? AND order_items.product_id = ? AND LOWER(orders.order_status) = ?", userID, productID, "delivered").
+		Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/cache"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+)
+
+const (
+	// Number of product views kept per viewer
+	recentlyViewedSize = 50
+	// How long an inactive viewer's history is kept
+	recentlyViewedTTL = 30 * 24 * time.Hour
+	// A purchase says more about a shopper's taste than a view
+	purchaseWeight = 3.0
+	viewWeight     = 1.0
+	// Candidates ranked per feed slot, and at most in all
+	feedCandidatesPerSlot = 20
+	maxFeedCandidates     = 500
+)
+
+// ScoredProduct is a feed entry with its personalisation score
+type ScoredProduct struct {
+	Product models.Product `json:"product"`
+	Score   float64        `json:"score"`
+}
+
+func recentlyViewedKey(viewer string) string {
+	return "recently-viewed:" + viewer
+}
+
+// recentlyViewed reads a viewer's history from the cache, newest first. A viewer without one has none.
+func recentlyViewed(ctx context.Context, viewer string) ([]int, error) {
+	data, err := cache.Default().Get(ctx, recentlyViewedKey(viewer))
+	if errors.Is(err, cache.ErrMiss) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, nil
+	}
+	return ids, nil
+}
+
+// TrackProductView records a product view for a viewer ("user:<id>" or "session:<id>") in the background,
+// so it adds no latency to the product read path. The most recent view is kept at the head of the history,
+// which lives in the cache: Redis, or the in-memory store while Redis is unavailable. Two views by the same
+// viewer at the same instant may keep only one of them, which a history of views can live with.
+func TrackProductView(viewer string, productID int) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		ids, err := recentlyViewed(ctx, viewer)
+		if err != nil {
+			log.Printf("Error tracking view of product ID %d for %s: %v", productID, viewer, err)
+			return
+		}
+		data, err := json.Marshal(addView(ids, productID))
+		if err == nil {
+			err = cache.Default().Set(ctx, recentlyViewedKey(viewer), data, recentlyViewedTTL)
+		}
+		if err != nil {
+			log.Printf("Error tracking view of product ID %d for %s: %v", productID, viewer, err)
+		}
+	}()
+}
+
+// addView puts a product at the head of a viewing history, removing its earlier view and keeping at most
+// recentlyViewedSize products.
+func addView(history []int, productID int) []int {
+	viewed := make([]int, 0, recentlyViewedSize)
+	viewed = append(viewed, productID)
+	for _, id := range history {
+		if id != productID && len(viewed) < recentlyViewedSize {
+			viewed = append(viewed, id)
+		}
+	}
+	return viewed
+}
+
+// RecentlyViewedIDs returns the IDs of the products a viewer saw most recently, newest first.
+func RecentlyViewedIDs(viewer string, limit int) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Views are a nice-to-have: while the cache fails, viewers simply have no history
+	ids, err := recentlyViewed(ctx, viewer)
+	if err != nil {
+		log.Printf("Error reading recently viewed products for %s: %v", viewer, err)
+		return []int{}, nil
+	}
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	if ids == nil {
+		ids = []int{}
+	}
+	return ids, nil
+}
+
+// RecentlyViewedProducts loads the published products a viewer saw most recently, keeping the view order.
+func RecentlyViewedProducts(viewer string, limit int) ([]models.Product, error) {
+	ids, err := RecentlyViewedIDs(viewer, limit)
+	if err != nil || len(ids) == 0 {
+		return []models.Product{}, err
+	}
+
+	var products []models.Product
+	if err := config.DB.Scopes(PublishedProducts).Where("id IN ?", ids).Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	ordered := make([]models.Product, 0, len(products))
+	for _, id := range ids {
+		if product, ok := byID[uint(id)]; ok {
+			ordered = append(ordered, product)
+		}
+	}
+	return ordered, ApplyPricing(ordered)
+}
+
+// PersonalizedFeed ranks in-stock, published products by how well their category and brand match what the
+// viewer has looked at and, for signed-in users, what they have bought in paid orders. Products the user
+// already bought are left out. Viewers without any history get the best rated products.
+func PersonalizedFeed(viewer string, userID int, limit int) ([]ScoredProduct, error) {
+	categoryWeights := map[int]float64{}
+	brandWeights := map[string]float64{}
+	addSignal := func(product models.Product, weight float64) {
+		categoryWeights[product.CategoryID] += weight
+		if product.Brand != "" {
+			brandWeights[product.Brand] += weight
+		}
+	}
+
+	viewed, err := RecentlyViewedProducts(viewer, recentlyViewedSize)
+	if err != nil {
+		log.Printf("Error loading recently viewed products for %s: %v", viewer, err)
+	}
+	for _, product := range viewed {
+		addSignal(product, viewWeight)
+	}
+
+	var purchasedIDs []int
+	if userID != 0 {
+		if err := config.DB.Model(&models.OrderItem{}).
+			Joins("JOIN orders ON orders.id = order_items.order_id AND orders.deleted_at IS NULL").
+			Where("orders.user_id = ? AND orders.order_payment_status = ?", userID, "Paid").
+			Distinct().Pluck("order_items.product_id", &purchasedIDs).Error; err != nil {
+			return nil, err
+		}
+
+		var purchased []models.Product
+		if len(purchasedIDs) > 0 {
+			if err := config.DB.Where("id IN ?", purchasedIDs).Find(&purchased).Error; err != nil {
+				return nil, err
+			}
+		}
+		for _, product := range purchased {
+			addSignal(product, purchaseWeight)
+		}
+	}
+
+	query := config.DB.Scopes(PublishedProducts, MaybeInStock)
+	if len(purchasedIDs) > 0 {
+		query = query.Where("id NOT IN ?", purchasedIDs)
+	}
+
+	if len(categoryWeights) == 0 {
+		var products []models.Product
+		if err := query.Order("average_rating desc, number_of_ratings desc").Limit(limit).Find(&products).Error; err != nil {
+			return nil, err
+		}
+		products, err = InStockProducts(config.DB, products)
+		if err != nil {
+			return nil, err
+		}
+		if err := ApplyPricing(products); err != nil {
+			return nil, err
+		}
+		feed := make([]ScoredProduct, 0, len(products))
+		for _, product := range products {
+			feed = append(feed, ScoredProduct{Product: product})
+		}
+		return feed, nil
+	}
+
+	categories := make([]int, 0, len(categoryWeights))
+	for category := range categoryWeights {
+		categories = append(categories, category)
+	}
+	brands := make([]string, 0, len(brandWeights))
+	for brand := range brandWeights {
+		brands = append(brands, brand)
+	}
+	if len(brands) > 0 {
+		query = query.Where("category_id IN ? OR brand IN ?", categories, brands)
+	} else {
+		query = query.Where("category_id IN ?", categories)
+	}
+
+	// Rank a bounded candidate set in memory rather than building a scoring expression in SQL
+	var candidates []models.Product
+	candidateLimit := min(limit*feedCandidatesPerSlot, maxFeedCandidates)
+	if err := query.Order("average_rating desc").Limit(candidateLimit).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	candidates, err = InStockProducts(config.DB, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := make([]ScoredProduct, 0, len(candidates))
+	for _, product := range candidates {
+		score := categoryWeights[product.CategoryID] + brandWeights[product.Brand] + product.AverageRating/5
+		feed = append(feed, ScoredProduct{Product: product, Score: score})
+	}
+	sort.SliceStable(feed, func(i, j int) bool {
+		return feed[i].Score > feed[j].Score
+	})
+	if len(feed) > limit {
+		feed = feed[:limit]
+	}
+
+	products := make([]models.Product, len(feed))
+	for i := range feed {
+		products[i] = feed[i].Product
+	}
+	if err := ApplyPricing(products); err != nil {
+		return nil, err
+	}
+	for i := range feed {
+		feed[i].Product = products[i]
+	}
+	return feed, nil
+}
+
+// ViewerKey builds the identifier views are tracked under, preferring a signed-in user over an anonymous session.
+func ViewerKey(userID int, sessionID string) string {
+	if userID != 0 {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	if sessionID != "" {
+		return "session:" + sessionID
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAddView(t *testing.T) {
+	full := make([]int, recentlyViewedSize)
+	for i := range full {
+		full[i] = i + 1
+	}
+
+	tests := []struct {
+		name      string
+		history   []int
+		productID int
+		want      []int
+	}{
+		{"first view", nil, 7, []int{7}},
+		{"newest first", []int{2, 1}, 3, []int{3, 2, 1}},
+		{"viewed again moves to the head", []int{3, 2, 1}, 1, []int{1, 3, 2}},
+		{"already at the head", []int{1, 2}, 1, []int{1, 2}},
+		{"oldest view dropped when full", full, 99, append([]int{99}, full[:recentlyViewedSize-1]...)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := addView(test.history, test.productID); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("addView(%v, %d) = %v, want %v", test.history, test.productID, got, test.want)
+			}
+		})
+	}
+}
+
+// Without Redis the cache is in memory, and views are still tracked.
+func TestRecentlyViewedWithoutRedis(t *testing.T) {
+	viewer := "session:test-recently-viewed"
+	for _, productID := range []int{1, 2, 1, 3} {
+		TrackProductView(viewer, productID)
+		deadline := time.Now().Add(time.Second)
+		for {
+			ids, _ := RecentlyViewedIDs(viewer, 1)
+			if len(ids) == 1 && ids[0] == productID {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("view of product %d was not recorded", productID)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	tests := []struct {
+		limit int
+		want  []int
+	}{
+		{10, []int{3, 1, 2}},
+		{2, []int{3, 1}},
+	}
+	for _, test := range tests {
+		if got, err := RecentlyViewedIDs(viewer, test.limit); err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("RecentlyViewedIDs(%d) = %v, %v, want %v", test.limit, got, err, test.want)
+		}
+	}
+	if got, _ := RecentlyViewedIDs("session:nobody", 10); !reflect.DeepEqual(got, []int{}) {
+		t.Errorf("RecentlyViewedIDs() of a new viewer = %v, want []", got)
+	}
+}
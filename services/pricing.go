@@ -0,0 +1,365 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// Window used for the lowest prior price that must be shown next to a discount
+const priceReferenceWindow = 30 * 24 * time.Hour
+
+// RoundPrice rounds an amount to cents.
+func RoundPrice(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// EffectivePrice is the price a customer pays: the lower of the discounted price and the active sale price.
+func EffectivePrice(product *models.Product, sale *models.Sale) float64 {
+	price := product.Price
+	if product.Discount > 0 && product.Discount < 100 {
+		price = product.Price * (1 - product.Discount/100)
+	}
+	if sale != nil && sale.SalePrice < price {
+		price = sale.SalePrice
+	}
+	return RoundPrice(price)
+}
+
+// ValidatePricing checks the price and discount percentage of a product.
+func ValidatePricing(product *models.Product) error {
+	if product.Price < 0 {
+		return errors.New("price cannot be negative")
+	}
+	if product.Discount < 0 || product.Discount >= 100 {
+		return errors.New("discount must be a percentage between 0 and 100")
+	}
+	return nil
+}
+
+// activeSales returns the sale currently running for each of the given products.
+func activeSales(db *gorm.DB, productIDs []uint, at time.Time) (map[int]*models.Sale, error) {
+	var sales []models.Sale
+	err := db.Where("product_id IN ? AND starts_at <= ? AND ends_at > ?", productIDs, at, at).
+		Order("sale_price desc").Find(&sales).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Ordered by descending price so the cheapest of any overlapping sales wins
+	byProduct := make(map[int]*models.Sale, len(sales))
+	for i := range sales {
+		byProduct[sales[i].ProductID] = &sales[i]
+	}
+	return byProduct, nil
+}
+
+// ApplyPricing fills in the computed pricing fields of products: effective price, active sale
+// and, for discounted products, the lowest price of the 30 days before the current price took effect.
+func ApplyPricing(products []models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(products))
+	for i := range products {
+		ids[i] = products[i].ID
+	}
+
+	now := time.Now()
+	sales, err := activeSales(config.DB, ids, now)
+	if err != nil {
+		return err
+	}
+
+	var discounted []int
+	for i := range products {
+		product := &products[i]
+		sale := sales[int(product.ID)]
+
+		product.Currency = BaseCurrency()
+		product.EffectivePrice = EffectivePrice(product, sale)
+		product.SalePrice, product.SaleEndsAt, product.LowestPrice30Days = nil, nil, nil
+		if sale != nil {
+			salePrice, endsAt := sale.SalePrice, sale.EndsAt
+			product.SalePrice, product.SaleEndsAt = &salePrice, &endsAt
+		}
+		if product.EffectivePrice < product.Price {
+			discounted = append(discounted, int(product.ID))
+		}
+	}
+
+	lowest, err := LowestPriorPrices(config.DB, discounted)
+	if err != nil {
+		return err
+	}
+	for i := range products {
+		if price, ok := lowest[int(products[i].ID)]; ok && products[i].EffectivePrice < products[i].Price {
+			products[i].LowestPrice30Days = &price
+		}
+	}
+	return nil
+}
+
+// ApplyProductPricing is ApplyPricing for a single product.
+func ApplyProductPricing(product *models.Product) error {
+	products := []models.Product{*product}
+	if err := ApplyPricing(products); err != nil {
+		return err
+	}
+	*product = products[0]
+	return nil
+}
+
+// CurrentEffectivePrice loads the active sale of a product and returns its effective price.
+func CurrentEffectivePrice(db *gorm.DB, product *models.Product) (float64, error) {
+	sales, err := activeSales(db, []uint{product.ID}, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return EffectivePrice(product, sales[int(product.ID)]), nil
+}
+
+// LowestPriorPrices returns, for each of the products, the lowest effective price during the 30 days before
+// its current price took effect, as required next to a price reduction. The price in effect when the window
+// opened also counts. Products with no earlier price on record are left out.
+func LowestPriorPrices(db *gorm.DB, productIDs []int) (map[int]float64, error) {
+	lowest := make(map[int]float64)
+	if len(productIDs) == 0 {
+		return lowest, nil
+	}
+
+	var rows []struct {
+		ProductID    int
+		WindowLowest sql.NullFloat64
+		Opening      sql.NullFloat64
+	}
+	err := db.Raw(`
+		WITH current AS (
+			SELECT DISTINCT ON (product_id) id, product_id, created_at, created_at - make_interval(secs => ?) AS window_start
+			FROM price_histories
+			WHERE product_id IN ?
+			ORDER BY product_id, created_at DESC, id DESC
+		)
+		SELECT current.product_id,
+			(SELECT MIN(h.effective_price) FROM price_histories h
+				WHERE h.product_id = current.product_id AND h.created_at >= current.window_start
+				AND h.created_at < current.created_at AND h.id <> current.id) AS window_lowest,
+			(SELECT h.effective_price FROM price_histories h
+				WHERE h.product_id = current.product_id AND h.created_at < current.window_start
+				ORDER BY h.created_at DESC, h.id DESC LIMIT 1) AS opening
+		FROM current`, priceReferenceWindow.Seconds(), productIDs).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		switch {
+		case row.WindowLowest.Valid && row.Opening.Valid:
+			lowest[row.ProductID] = math.Min(row.WindowLowest.Float64, row.Opening.Float64)
+		case row.WindowLowest.Valid:
+			lowest[row.ProductID] = row.WindowLowest.Float64
+		case row.Opening.Valid:
+			lowest[row.ProductID] = row.Opening.Float64
+		}
+	}
+	return lowest, nil
+}
+
+// RecordPriceChange appends a price history entry when the product is new or its price or discount changed.
+// previous is the product as it was before the change, or nil for a new product.
+func RecordPriceChange(tx *gorm.DB, previous, product *models.Product, changedBy int, source string) error {
+	if previous != nil && previous.Price == product.Price && previous.Discount == product.Discount {
+		return nil
+	}
+	return writePriceHistory(tx, product, changedBy, source)
+}
+
+func writePriceHistory(tx *gorm.DB, product *models.Product, changedBy int, source string) error {
+	sales, err := activeSales(tx, []uint{product.ID}, time.Now())
+	if err != nil {
+		return err
+	}
+	sale := sales[int(product.ID)]
+
+	entry := models.PriceHistory{
+		ProductID:      int(product.ID),
+		Price:          product.Price,
+		Discount:       product.Discount,
+		EffectivePrice: EffectivePrice(product, sale),
+		Source:         source,
+		ChangedBy:      changedBy,
+	}
+	if sale != nil {
+		salePrice := sale.SalePrice
+		entry.SalePrice = &salePrice
+	}
+	return tx.Create(&entry).Error
+}
+
+// ValidateSale checks a scheduled sale against the product it applies to and its other sales.
+func ValidateSale(db *gorm.DB, product *models.Product, sale *models.Sale) error {
+	if sale.SalePrice <= 0 || sale.SalePrice >= product.Price {
+		return errors.New("sale_price must be positive and below the regular price")
+	}
+	if !sale.EndsAt.After(sale.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	if !sale.EndsAt.After(time.Now()) {
+		return errors.New("ends_at must be in the future")
+	}
+
+	var overlapping int64
+	err := db.Model(&models.Sale{}).
+		Where("product_id = ? AND id <> ? AND starts_at < ? AND ends_at > ?", product.ID, sale.ID, sale.EndsAt, sale.StartsAt).
+		Count(&overlapping).Error
+	if err != nil {
+		return err
+	}
+	if overlapping > 0 {
+		return errors.New("sale overlaps an existing sale for this product")
+	}
+	return nil
+}
+
+// ApplySaleWindows records price history when scheduled sales start or end and invalidates the
+// cached products whose effective price changed. It is run every minute by the scheduler in main.
+func ApplySaleWindows() error {
+	now := time.Now()
+	var changed []int
+
+	transitions := []struct {
+		condition string
+		column    string
+		source    string
+	}{
+		{"starts_at <= ? AND start_recorded = false", "start_recorded", "sale_start"},
+		{"ends_at <= ? AND end_recorded = false", "end_recorded", "sale_end"},
+	}
+
+	for _, transition := range transitions {
+		var sales []models.Sale
+		if err := config.DB.Where(transition.condition, now).Find(&sales).Error; err != nil {
+			return err
+		}
+
+		for _, sale := range sales {
+			err := config.DB.Transaction(func(tx *gorm.DB) error {
+				var product models.Product
+				if err := tx.First(&product, sale.ProductID).Error; err != nil {
+					return err
+				}
+				// A sale that was created after its end has passed never changed the price
+				if transition.source == "sale_start" && !sale.EndsAt.After(now) {
+					return tx.Model(&sale).Update(transition.column, true).Error
+				}
+				if err := writePriceHistory(tx, &product, 0, transition.source); err != nil {
+					return err
+				}
+				return tx.Model(&sale).Update(transition.column, true).Error
+			})
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				config.DB.Model(&sale).Update(transition.column, true)
+				continue
+			} else if err != nil {
+				return err
+			}
+			changed = append(changed, sale.ProductID)
+		}
+	}
+
+	if len(changed) > 0 {
+		log.Printf("Sale scheduler updated pricing for %d products", len(changed))
+		InvalidateProductCache(changed...)
+	}
+	return nil
+}
+
+// PriceCartItems sets the price and total of each cart item from the current effective price of its product
+// in the given currency, so a client can never choose what it pays. Only published products can be bought:
+// an item whose product is missing, a draft or archived is an error.
+func PriceCartItems(db *gorm.DB, items []models.CartItem, currency string) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	converter, err := NewConverter(db, currency)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = uint(item.ProductID)
+	}
+
+	var products []models.Product
+	if err := db.Scopes(PublishedProducts).Where("id IN ?", ids).Find(&products).Error; err != nil {
+		return err
+	}
+
+	sales, err := activeSales(db, ids, time.Now())
+	if err != nil {
+		return err
+	}
+	for i := range products {
+		product := &products[i]
+		product.EffectivePrice = EffectivePrice(product, sales[int(product.ID)])
+		if sale := sales[int(product.ID)]; sale != nil {
+			salePrice := sale.SalePrice
+			product.SalePrice = &salePrice
+		}
+	}
+	if err := presentProducts(db, products, converter); err != nil {
+		return err
+	}
+
+	byID := make(map[int]*models.Product, len(products))
+	for i := range products {
+		byID[int(products[i].ID)] = &products[i]
+	}
+
+	for i := range items {
+		product, ok := byID[items[i].ProductID]
+		if !ok {
+			return fmt.Errorf("product %d is not available", items[i].ProductID)
+		}
+		if items[i].Quantity < 1 {
+			return fmt.Errorf("quantity for product %d must be at least 1", items[i].ProductID)
+		}
+		items[i].Price = product.EffectivePrice
+		items[i].Total = converter.Round(items[i].Price * float64(items[i].Quantity))
+	}
+	return nil
+}
+
+// PriceCart reprices every item of a cart in the cart's currency and recomputes the cart totals.
+func PriceCart(db *gorm.DB, cart *models.Cart) error {
+	if cart.Currency == "" {
+		cart.Currency = ResolveCurrency(db, "", cart.UserID)
+	}
+	converter, err := NewConverter(db, cart.Currency)
+	if err != nil {
+		return err
+	}
+	cart.Currency = converter.Currency
+
+	if err := PriceCartItems(db, cart.Items, cart.Currency); err != nil {
+		return err
+	}
+
+	cart.Total, cart.TotalItem = 0, 0
+	for _, item := range cart.Items {
+		cart.Total += item.Total
+		cart.TotalItem += item.Quantity
+	}
+	cart.Total = converter.Round(cart.Total)
+	return nil
+}
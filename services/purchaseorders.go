@@ -0,0 +1,269 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPurchaseOrderState is returned when a purchase order cannot make the requested move from its status.
+var ErrPurchaseOrderState = errors.New("purchase order cannot do this in its current status")
+
+// ReceiptLine is a delivered quantity of a product on a purchase order.
+type ReceiptLine struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// validatePurchaseOrder checks the supplier, warehouse and items of a purchase order.
+func validatePurchaseOrder(db *gorm.DB, order *models.PurchaseOrder) error {
+	var supplier models.Supplier
+	if err := db.First(&supplier, order.SupplierID).Error; err != nil {
+		return errors.New("supplier not found")
+	}
+	if !supplier.Active {
+		return errors.New("supplier is inactive")
+	}
+	if err := db.First(&models.Warehouse{}, order.WarehouseID).Error; err != nil {
+		return errors.New("warehouse not found")
+	}
+	if len(order.Items) == 0 {
+		return errors.New("a purchase order needs at least one item")
+	}
+
+	seen := make(map[int]bool)
+	for _, item := range order.Items {
+		if item.Quantity < 1 {
+			return fmt.Errorf("quantity of product %d must be at least 1", item.ProductID)
+		}
+		if item.UnitCost < 0 {
+			return fmt.Errorf("unit cost of product %d cannot be negative", item.ProductID)
+		}
+		if seen[item.ProductID] {
+			return fmt.Errorf("product %d is listed twice", item.ProductID)
+		}
+		seen[item.ProductID] = true
+
+		var product models.Product
+		if err := db.First(&product, item.ProductID).Error; err != nil {
+			return fmt.Errorf("product %d not found", item.ProductID)
+		}
+		if !stocksProduct(&product) {
+			return fmt.Errorf("product %d is a %s and has no stock of its own", item.ProductID, product.Type)
+		}
+	}
+	return nil
+}
+
+// CreatePurchaseOrder validates and saves a draft purchase order.
+func CreatePurchaseOrder(db *gorm.DB, order *models.PurchaseOrder) error {
+	if err := validatePurchaseOrder(db, order); err != nil {
+		return err
+	}
+	order.ID = 0
+	order.Status = models.PurchaseOrderDraft
+	order.SentAt, order.ReceivedAt = nil, nil
+	for i := range order.Items {
+		order.Items[i].ID = 0
+		order.Items[i].ReceivedQuantity = 0
+	}
+	return db.Create(order).Error
+}
+
+// UpdatePurchaseOrder replaces the supplier, warehouse, notes, expected date and items of a draft.
+func UpdatePurchaseOrder(db *gorm.DB, orderID int, changes *models.PurchaseOrder) (*models.PurchaseOrder, error) {
+	if err := validatePurchaseOrder(db, changes); err != nil {
+		return nil, err
+	}
+	return movePurchaseOrder(db, orderID, []string{models.PurchaseOrderDraft}, func(tx *gorm.DB, order *models.PurchaseOrder) error {
+		order.SupplierID, order.WarehouseID = changes.SupplierID, changes.WarehouseID
+		order.Notes, order.ExpectedAt = changes.Notes, changes.ExpectedAt
+		if err := tx.Where("purchase_order_id = ?", order.ID).Delete(&models.PurchaseOrderItem{}).Error; err != nil {
+			return err
+		}
+		items := make([]models.PurchaseOrderItem, len(changes.Items))
+		for i, item := range changes.Items {
+			items[i] = models.PurchaseOrderItem{PurchaseOrderID: int(order.ID), ProductID: item.ProductID, Quantity: item.Quantity, UnitCost: item.UnitCost}
+		}
+		if err := tx.Create(&items).Error; err != nil {
+			return err
+		}
+		order.Items = items
+		return nil
+	})
+}
+
+// movePurchaseOrder locks a purchase order, checks it is in one of the statuses from and changes it with apply.
+func movePurchaseOrder(db *gorm.DB, orderID int, from []string, apply func(tx *gorm.DB, order *models.PurchaseOrder) error) (*models.PurchaseOrder, error) {
+	var order models.PurchaseOrder
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).First(&order, orderID).Error; err != nil {
+			return err
+		}
+		allowed := false
+		for _, status := range from {
+			allowed = allowed || order.Status == status
+		}
+		if !allowed {
+			return fmt.Errorf("%w: it is %s", ErrPurchaseOrderState, order.Status)
+		}
+		productIDs := make([]int, len(order.Items))
+		for i, item := range order.Items {
+			productIDs[i] = item.ProductID
+		}
+		if err := lockProducts(tx, productIDs); err != nil {
+			return err
+		}
+		if err := apply(tx, &order); err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Save(&order).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// SendPurchaseOrder marks a draft as sent and emails it to the supplier.
+func SendPurchaseOrder(db *gorm.DB, orderID int) (*models.PurchaseOrder, error) {
+	order, err := movePurchaseOrder(db, orderID, []string{models.PurchaseOrderDraft}, func(tx *gorm.DB, order *models.PurchaseOrder) error {
+		now := time.Now()
+		order.Status, order.SentAt = models.PurchaseOrderSent, &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	go emailPurchaseOrder(*order)
+	return order, nil
+}
+
+// ReceivePurchaseOrder books a delivery against a sent purchase order. Each line is posted to the
+// ledger as a restock of the receiving warehouse, whose last restock date is updated. No lines receives
+// everything still outstanding. More than is outstanding cannot be received. The order ends received
+// once every item is delivered in full, and partially received until then.
+func ReceivePurchaseOrder(db *gorm.DB, orderID int, lines []ReceiptLine, actorID int) (*models.PurchaseOrder, error) {
+	var restocked []int
+	order, err := movePurchaseOrder(db, orderID, []string{models.PurchaseOrderSent, models.PurchaseOrderPartiallyReceived}, func(tx *gorm.DB, order *models.PurchaseOrder) error {
+		received := make(map[int]int)
+		if len(lines) == 0 {
+			for _, item := range order.Items {
+				received[item.ProductID] = item.Quantity - item.ReceivedQuantity
+			}
+		}
+		for _, line := range lines {
+			if line.Quantity < 1 {
+				return fmt.Errorf("received quantity of product %d must be at least 1", line.ProductID)
+			}
+			received[line.ProductID] += line.Quantity
+		}
+
+		now := time.Now()
+		complete := true
+		for i := range order.Items {
+			item := &order.Items[i]
+			quantity := received[item.ProductID]
+			delete(received, item.ProductID)
+			if quantity > item.Quantity-item.ReceivedQuantity {
+				return fmt.Errorf("only %d of product %d are outstanding", item.Quantity-item.ReceivedQuantity, item.ProductID)
+			}
+			if quantity > 0 {
+				if err := PostStockMovement(tx, &models.StockMovement{
+					ProductID:     item.ProductID,
+					WarehouseID:   order.WarehouseID,
+					Reason:        models.MovementRestock,
+					Delta:         quantity,
+					ReferenceType: models.MovementRefPurchaseOrder,
+					ReferenceID:   int(order.ID),
+					ActorID:       actorID,
+				}); err != nil {
+					return err
+				}
+				if err := tx.Model(&models.Inventory{}).Where("product_id = ? AND warehouse_id = ?", item.ProductID, order.WarehouseID).
+					UpdateColumn("last_restock", now).Error; err != nil {
+					return err
+				}
+				item.ReceivedQuantity += quantity
+				if err := tx.Model(item).UpdateColumn("received_quantity", item.ReceivedQuantity).Error; err != nil {
+					return err
+				}
+				restocked = append(restocked, item.ProductID)
+			}
+			complete = complete && item.ReceivedQuantity == item.Quantity
+		}
+		for productID, quantity := range received {
+			if quantity > 0 {
+				return fmt.Errorf("product %d is not on the purchase order", productID)
+			}
+		}
+		if len(restocked) == 0 {
+			return errors.New("nothing to receive")
+		}
+
+		order.Status = models.PurchaseOrderPartiallyReceived
+		if complete {
+			order.Status, order.ReceivedAt = models.PurchaseOrderReceived, &now
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	InvalidateProductCache(restocked...)
+	return order, nil
+}
+
+// CancelPurchaseOrder cancels a purchase order nothing has been received on yet.
+func CancelPurchaseOrder(db *gorm.DB, orderID int) (*models.PurchaseOrder, error) {
+	return movePurchaseOrder(db, orderID, []string{models.PurchaseOrderDraft, models.PurchaseOrderSent}, func(tx *gorm.DB, order *models.PurchaseOrder) error {
+		order.Status = models.PurchaseOrderCancelled
+		return nil
+	})
+}
+
+// emailPurchaseOrder sends a purchase order to its supplier. Suppliers without an email address are
+// left to be contacted by hand.
+func emailPurchaseOrder(order models.PurchaseOrder) {
+	var supplier models.Supplier
+	if err := config.DB.First(&supplier, order.SupplierID).Error; err != nil || supplier.Email == "" {
+		return
+	}
+	var warehouse models.Warehouse
+	config.DB.First(&warehouse, order.WarehouseID)
+
+	productIDs := make([]int, len(order.Items))
+	for i, item := range order.Items {
+		productIDs[i] = item.ProductID
+	}
+	var products []models.Product
+	config.DB.Select("id", "sku", "name").Where("id IN ?", productIDs).Find(&products)
+	productsByID := make(map[int]models.Product, len(products))
+	for _, product := range products {
+		productsByID[int(product.ID)] = product
+	}
+
+	lines := make([]string, len(order.Items))
+	for i, item := range order.Items {
+		product := productsByID[item.ProductID]
+		lines[i] = fmt.Sprintf("%d x %s (%s) at %.2f", item.Quantity, product.Name, product.SKU, item.UnitCost)
+	}
+	body := fmt.Sprintf("Purchase order %d\n\n%s\n\nPlease deliver to %s, %s, %s %s.",
+		order.ID, strings.Join(lines, "\n"), warehouse.Name, warehouse.Address, warehouse.City, warehouse.Country)
+	if order.ExpectedAt != nil {
+		body += fmt.Sprintf("\nExpected by %s.", order.ExpectedAt.Format("2 January 2006"))
+	}
+	if err := utils.SendEmail(supplier.Email, fmt.Sprintf("Purchase order %d", order.ID), body); err != nil {
+		log.Printf("Error emailing purchase order %d to supplier %d: %v", order.ID, supplier.ID, err)
+	}
+}
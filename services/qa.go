@@ -0,0 +1,197 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errors returned by the Q&A operations.
+var (
+	ErrNotProductVendor = errors.New("only the product's vendor or an admin can answer")
+	ErrAlreadyUpvoted   = errors.New("already upvoted")
+	ErrOwnContent       = errors.New("you cannot upvote your own question or answer")
+)
+
+// AskQuestion records a customer's question about a published product. Questions that ModerateContent
+// flags wait in the moderation queue; the others are published and the vendor is emailed.
+func AskQuestion(db *gorm.DB, productID, userID int, body string) (*models.ProductQuestion, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, errors.New("question cannot be empty")
+	}
+
+	var product models.Product
+	if err := db.Scopes(PublishedProducts).First(&product, productID).Error; err != nil {
+		return nil, fmt.Errorf("product %d not found", productID)
+	}
+
+	question := models.ProductQuestion{ProductID: productID, UserID: userID, Body: body, Status: models.QAStatusApproved}
+	if reason := ModerateContent(body); reason != "" {
+		question.Status, question.ModerationReason = models.QAStatusPending, reason
+	}
+	if err := db.Create(&question).Error; err != nil {
+		return nil, err
+	}
+
+	if question.Status == models.QAStatusApproved {
+		go notifyVendorOfQuestion(question)
+	}
+	return &question, nil
+}
+
+// AnswerQuestion records an answer from the product's vendor or an admin and emails the asker once it is published.
+func AnswerQuestion(db *gorm.DB, question *models.ProductQuestion, answerer *models.User, body string) (*models.ProductAnswer, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, errors.New("answer cannot be empty")
+	}
+
+	if answerer.Role != "admin" {
+		var product models.Product
+		if err := db.First(&product, question.ProductID).Error; err != nil {
+			return nil, err
+		}
+		if answerer.Role != "vendor" || product.VendorID == 0 || product.VendorID != uint(answerer.ID) {
+			return nil, ErrNotProductVendor
+		}
+	}
+
+	answer := models.ProductAnswer{
+		QuestionID:   int(question.ID),
+		UserID:       answerer.ID,
+		AnswererRole: answerer.Role,
+		Body:         body,
+		Status:       models.QAStatusApproved,
+	}
+	if reason := ModerateContent(body); reason != "" {
+		answer.Status, answer.ModerationReason = models.QAStatusPending, reason
+	}
+	if err := db.Create(&answer).Error; err != nil {
+		return nil, err
+	}
+
+	if answer.Status == models.QAStatusApproved && question.Status == models.QAStatusApproved {
+		go notifyAskerOfAnswer(answer)
+	}
+	return &answer, nil
+}
+
+// UpvoteQA adds a user's upvote to a question or answer. Each user can upvote a target once,
+// and never their own question or answer.
+func UpvoteQA(db *gorm.DB, targetType string, targetID, userID int) (int, error) {
+	var model interface{}
+	var authorID int
+	switch targetType {
+	case models.QAVoteQuestion:
+		var question models.ProductQuestion
+		if err := db.Where("status = ?", models.QAStatusApproved).First(&question, targetID).Error; err != nil {
+			return 0, err
+		}
+		model, authorID = &question, question.UserID
+	case models.QAVoteAnswer:
+		var answer models.ProductAnswer
+		if err := db.Where("status = ?", models.QAStatusApproved).First(&answer, targetID).Error; err != nil {
+			return 0, err
+		}
+		model, authorID = &answer, answer.UserID
+	default:
+		return 0, fmt.Errorf("unknown vote target %q", targetType)
+	}
+	if authorID == userID {
+		return 0, ErrOwnContent
+	}
+
+	var counts []int
+	err := db.Transaction(func(tx *gorm.DB) error {
+		vote := models.QAVote{TargetType: targetType, TargetID: targetID, UserID: userID}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&vote)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAlreadyUpvoted
+		}
+		if err := tx.Model(model).UpdateColumn("upvote_count", gorm.Expr("upvote_count + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(model).Where("id = ?", targetID).Pluck("upvote_count", &counts).Error
+	})
+	if err != nil || len(counts) == 0 {
+		return 0, err
+	}
+	return counts[0], nil
+}
+
+// ModerateQuestion approves or rejects a question. Approving a held question emails the vendor.
+func ModerateQuestion(db *gorm.DB, question *models.ProductQuestion, status, reason string) error {
+	wasApproved := question.Status == models.QAStatusApproved
+	question.Status, question.ModerationReason = status, reason
+	if err := db.Model(question).Select("status", "moderation_reason").Updates(question).Error; err != nil {
+		return err
+	}
+
+	if status == models.QAStatusApproved && !wasApproved {
+		go notifyVendorOfQuestion(*question)
+	}
+	return nil
+}
+
+// ModerateAnswer approves or rejects an answer. Approving a held answer emails the asker.
+func ModerateAnswer(db *gorm.DB, answer *models.ProductAnswer, status, reason string) error {
+	wasApproved := answer.Status == models.QAStatusApproved
+	answer.Status, answer.ModerationReason = status, reason
+	if err := db.Model(answer).Select("status", "moderation_reason").Updates(answer).Error; err != nil {
+		return err
+	}
+
+	if status == models.QAStatusApproved && !wasApproved {
+		go notifyAskerOfAnswer(*answer)
+	}
+	return nil
+}
+
+// notifyVendorOfQuestion emails the vendor of the product about a newly published question.
+// Questions on the store's own products are left for admins in the moderation queue.
+func notifyVendorOfQuestion(question models.ProductQuestion) {
+	var product models.Product
+	if err := config.DB.First(&product, question.ProductID).Error; err != nil || product.VendorID == 0 {
+		return
+	}
+	var vendor models.User
+	if err := config.DB.First(&vendor, product.VendorID).Error; err != nil || vendor.Email == "" {
+		return
+	}
+
+	body := fmt.Sprintf("A customer asked a question about %s:\n\n%s\n\nAnswer it at /api/v1/questions/%d/answers.",
+		product.Name, question.Body, question.ID)
+	if err := utils.SendEmail(vendor.Email, "New question about "+product.Name, body); err != nil {
+		log.Printf("Error emailing vendor %d about question %d: %v", vendor.ID, question.ID, err)
+	}
+}
+
+// notifyAskerOfAnswer emails the customer who asked a question that it has been answered.
+func notifyAskerOfAnswer(answer models.ProductAnswer) {
+	var question models.ProductQuestion
+	if err := config.DB.First(&question, answer.QuestionID).Error; err != nil || question.Status != models.QAStatusApproved {
+		return
+	}
+	var asker models.User
+	if err := config.DB.First(&asker, question.UserID).Error; err != nil || asker.Email == "" {
+		return
+	}
+	var product models.Product
+	config.DB.Select("id", "name").First(&product, question.ProductID)
+
+	body := fmt.Sprintf("Your question about %s has been answered.\n\nQ: %s\nA: %s", product.Name, question.Body, answer.Body)
+	if err := utils.SendEmail(asker.Email, "Your question about "+product.Name+" was answered", body); err != nil {
+		log.Printf("Error emailing user %d about answer %d: %v", asker.ID, answer.ID, err)
+	}
+}
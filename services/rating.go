@@ -0,0 +1,51 @@
+package services
+
+import (
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// RecalculateProductRating recomputes AverageRating and NumberOfRatings for a product from its approved reviews.
+// It should be called inside the same transaction as the review change so the aggregates never drift.
+func RecalculateProductRating(tx *gorm.DB, productID int) error {
+	var aggregate struct {
+		Average float64
+		Count   int
+	}
+
+	err := tx.Model(&models.Review{}).
+		Select("COALESCE(AVG(rating), 0) AS average, COUNT(*) AS count").
+		Where("product_id = ? AND status = ?", productID, models.ReviewStatusApproved).
+		Scan(&aggregate).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&models.Product{}).Where("id = ?", productID).UpdateColumns(map[string]interface{}{
+		"average_rating":    aggregate.Average,
+		"number_of_ratings": aggregate.Count,
+	}).Error
+}
+
+// RatingDistribution returns how many approved reviews a product has for each star rating from 1 to 5.
+func RatingDistribution(db *gorm.DB, productID int) (map[int]int64, error) {
+	var rows []struct {
+		Rating int
+		Count  int64
+	}
+
+	err := db.Model(&models.Review{}).
+		Select("rating, COUNT(*) AS count").
+		Where("product_id = ? AND status = ?", productID, models.ReviewStatusApproved).
+		Group("rating").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	distribution := map[int]int64{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}
+	for _, row := range rows {
+		distribution[row.Rating] = row.Count
+	}
+	return distribution, nil
+}
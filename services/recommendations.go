@@ -0,0 +1,216 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/cache"
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// Pairs bought together fewer times than this are treated as noise and not stored
+const minAffinityPairCount = 2
+
+// RelatedProduct is a recommended product together with its blended score and where it came from
+type RelatedProduct struct {
+	Product models.Product `json:"product"`
+	Score   float64        `json:"score"`
+	Source  string         `json:"source"` // co_purchase, same_category_brand, same_category or same_brand
+}
+
+// MineProductAffinities rebuilds the product_affinities table from OrderItem co-occurrence in paid orders.
+// It is run periodically by the scheduler in main.
+func MineProductAffinities() error {
+	started := time.Now()
+
+	var totalOrders int64
+	if err := config.DB.Model(&models.OrderItem{}).
+		Joins("JOIN orders ON orders.id = order_items.order_id AND orders.deleted_at IS NULL").
+		Where("orders.order_payment_status = ?", "Paid").
+		Distinct("order_items.order_id").Count(&totalOrders).Error; err != nil {
+		return err
+	}
+	if totalOrders == 0 {
+		return nil
+	}
+
+	var pairs []struct {
+		ProductID        int
+		RelatedProductID int
+		PairCount        int
+		ProductCount     int
+		RelatedCount     int
+	}
+
+	// Each paid order counts once per pair, however many units of either product it contains
+	err := config.DB.Raw(`
+		WITH order_products AS (
+			SELECT DISTINCT order_items.order_id, order_items.product_id FROM order_items
+			JOIN orders ON orders.id = order_items.order_id AND orders.deleted_at IS NULL
+			WHERE order_items.deleted_at IS NULL AND orders.order_payment_status = 'Paid'
+		),
+		product_counts AS (
+			SELECT product_id, COUNT(*) AS order_count FROM order_products GROUP BY product_id
+		)
+		SELECT a.product_id, b.product_id AS related_product_id, COUNT(*) AS pair_count,
+			pa.order_count AS product_count, pb.order_count AS related_count
+		FROM order_products a
+		JOIN order_products b ON a.order_id = b.order_id AND a.product_id <> b.product_id
+		JOIN product_counts pa ON pa.product_id = a.product_id
+		JOIN product_counts pb ON pb.product_id = b.product_id
+		GROUP BY a.product_id, b.product_id, pa.order_count, pb.order_count
+		HAVING COUNT(*) >= ?`, minAffinityPairCount).Scan(&pairs).Error
+	if err != nil {
+		return err
+	}
+
+	affinities := make([]models.ProductAffinity, 0, len(pairs))
+	for _, pair := range pairs {
+		total := float64(totalOrders)
+		affinities = append(affinities, models.ProductAffinity{
+			ProductID:        pair.ProductID,
+			RelatedProductID: pair.RelatedProductID,
+			PairCount:        pair.PairCount,
+			Support:          float64(pair.PairCount) / total,
+			Confidence:       float64(pair.PairCount) / float64(pair.ProductCount),
+			Lift:             float64(pair.PairCount) * total / (float64(pair.ProductCount) * float64(pair.RelatedCount)),
+			ComputedAt:       started,
+		})
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.ProductAffinity{}).Error; err != nil {
+			return err
+		}
+		if len(affinities) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&affinities, 500).Error
+	})
+	if err != nil {
+		return err
+	}
+	cache.InvalidateTags(cache.RecommendationsTag)
+
+	log.Printf("Mined %d product affinities from %d orders in %s", len(affinities), totalOrders, time.Since(started))
+	return nil
+}
+
+// RelatedProducts returns up to limit in-stock, published products to show next to a product.
+// Co-purchased products come first, ranked by confidence weighted by lift, and the remaining slots
+// are filled with products from the same category and/or brand.
+func RelatedProducts(product models.Product, limit int) ([]RelatedProduct, error) {
+	related := make([]RelatedProduct, 0, limit)
+	seen := map[uint]bool{product.ID: true}
+
+	var coPurchased []struct {
+		models.Product
+		Confidence float64
+		Lift       float64
+	}
+	err := config.DB.Model(&models.Product{}).Scopes(PublishedProducts, MaybeInStock).
+		Select("products.*, product_affinities.confidence, product_affinities.lift").
+		Joins("JOIN product_affinities ON product_affinities.related_product_id = products.id").
+		Where("product_affinities.product_id = ?", product.ID).
+		Order("product_affinities.confidence * LEAST(product_affinities.lift, 10) desc").
+		Limit(limit).
+		Scan(&coPurchased).Error
+	if err != nil {
+		return nil, err
+	}
+
+	coPurchasedProducts := make([]models.Product, len(coPurchased))
+	for i := range coPurchased {
+		coPurchasedProducts[i] = coPurchased[i].Product
+	}
+	if err := ApplyBundleAvailability(config.DB, coPurchasedProducts); err != nil {
+		return nil, err
+	}
+	for i, candidate := range coPurchased {
+		seen[candidate.ID] = true
+		if coPurchasedProducts[i].Quantity <= 0 {
+			continue
+		}
+		candidate.Product = coPurchasedProducts[i]
+		related = append(related, RelatedProduct{
+			Product: candidate.Product,
+			// Offset by 1 so co-purchase matches always outrank the category and brand fallbacks
+			Score:  1 + candidate.Confidence*minFloat(candidate.Lift, 10)/10,
+			Source: "co_purchase",
+		})
+	}
+
+	fallbacks := []struct {
+		source string
+		score  float64
+		scope  func(*gorm.DB) *gorm.DB
+	}{
+		{"same_category_brand", 0.6, func(db *gorm.DB) *gorm.DB {
+			return db.Where("category_id = ? AND brand = ? AND brand <> ''", product.CategoryID, product.Brand)
+		}},
+		{"same_category", 0.4, func(db *gorm.DB) *gorm.DB {
+			return db.Where("category_id = ?", product.CategoryID)
+		}},
+		{"same_brand", 0.3, func(db *gorm.DB) *gorm.DB {
+			return db.Where("brand = ? AND brand <> ''", product.Brand)
+		}},
+	}
+
+	for _, fallback := range fallbacks {
+		if len(related) >= limit {
+			break
+		}
+
+		excluded := make([]uint, 0, len(seen))
+		for id := range seen {
+			excluded = append(excluded, id)
+		}
+
+		var candidates []models.Product
+		err := config.DB.Scopes(PublishedProducts, MaybeInStock, fallback.scope).
+			Where("id NOT IN ?", excluded).
+			Order("average_rating desc, number_of_ratings desc").
+			Limit(limit - len(related)).
+			Find(&candidates).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, candidate := range candidates {
+			seen[candidate.ID] = true
+		}
+		if candidates, err = InStockProducts(config.DB, candidates); err != nil {
+			return nil, err
+		}
+
+		for _, candidate := range candidates {
+			seen[candidate.ID] = true
+			related = append(related, RelatedProduct{
+				Product: candidate,
+				Score:   fallback.score + candidate.AverageRating/50,
+				Source:  fallback.source,
+			})
+		}
+	}
+
+	products := make([]models.Product, len(related))
+	for i := range related {
+		products[i] = related[i].Product
+	}
+	if err := ApplyPricing(products); err != nil {
+		return nil, err
+	}
+	for i := range related {
+		related[i].Product = products[i]
+	}
+
+	return related, nil
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
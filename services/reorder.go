@@ -0,0 +1,142 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/utils"
+	"gorm.io/gorm"
+)
+
+// LowStockLine is a location whose stock is at or below its reorder level.
+type LowStockLine struct {
+	InventoryID       uint   `json:"inventory_id"`
+	ProductID         int    `json:"product_id"`
+	SKU               string `json:"sku"`
+	Name              string `json:"name"`
+	VendorID          uint   `json:"vendor_id,omitempty"`
+	WarehouseID       int    `json:"warehouse_id"`
+	WarehouseCode     string `json:"warehouse_code"`
+	Quantity          int    `json:"quantity"`
+	ReorderLevel      int    `json:"reorder_level"`
+	StockLevel        int    `json:"stock_level"`
+	OnOrder           int    `json:"on_order"`           // units on purchase orders not yet received
+	SuggestedQuantity int    `json:"suggested_quantity"` // units to order to get back to the stock level
+}
+
+// lowStock lists the locations of live products at or below a reorder level above zero.
+func lowStock(db *gorm.DB) *gorm.DB {
+	onOrder := db.Table("purchase_order_items").
+		Select("COALESCE(SUM(purchase_order_items.quantity - purchase_order_items.received_quantity), 0)").
+		Joins("JOIN purchase_orders ON purchase_orders.id = purchase_order_items.purchase_order_id AND purchase_orders.deleted_at IS NULL").
+		Where("purchase_orders.status IN ?", []string{models.PurchaseOrderSent, models.PurchaseOrderPartiallyReceived}).
+		Where("purchase_orders.warehouse_id = inventories.warehouse_id AND purchase_order_items.product_id = inventories.product_id")
+
+	return db.Table("inventories").
+		Select(`inventories.id AS inventory_id, inventories.product_id, products.sku, products.name, products.vendor_id,
+			inventories.warehouse_id, warehouses.code AS warehouse_code, inventories.quantity, inventories.reorder_level,
+			inventories.stock_level, (?) AS on_order`, onOrder).
+		Joins("JOIN products ON products.id = inventories.product_id AND products.deleted_at IS NULL").
+		Joins("JOIN warehouses ON warehouses.id = inventories.warehouse_id AND warehouses.deleted_at IS NULL").
+		Where("inventories.reorder_level > 0 AND inventories.quantity <= inventories.reorder_level").
+		Order("inventories.product_id, inventories.warehouse_id")
+}
+
+// LowStock returns the locations at or below their reorder level. vendorID limits them to one vendor's
+// products when it is not 0.
+func LowStock(db *gorm.DB, vendorID uint) ([]LowStockLine, error) {
+	query := lowStock(db)
+	if vendorID != 0 {
+		query = query.Where("products.vendor_id = ?", vendorID)
+	}
+	lines := []LowStockLine{}
+	if err := query.Scan(&lines).Error; err != nil {
+		return nil, err
+	}
+	for i := range lines {
+		lines[i].SuggestedQuantity = max(lines[i].StockLevel-lines[i].Quantity-lines[i].OnOrder, 0)
+	}
+	return lines, nil
+}
+
+// NotifyLowStock tells the owner of every location that fell to its reorder level: the vendor of the
+// product, or every admin for the store's own products. Each location is announced once until its
+// stock is above the reorder level again. It is run by the scheduler in main.
+func NotifyLowStock() error {
+	if err := config.DB.Model(&models.Inventory{}).
+		Where("low_stock_notified_at IS NOT NULL AND quantity > reorder_level").
+		UpdateColumn("low_stock_notified_at", nil).Error; err != nil {
+		return err
+	}
+
+	var lines []LowStockLine
+	if err := lowStock(config.DB).Where("inventories.low_stock_notified_at IS NULL").Scan(&lines).Error; err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	var admins []models.User
+	if err := config.DB.Where("role = ?", "admin").Find(&admins).Error; err != nil {
+		return err
+	}
+	recipients := func(line LowStockLine) []int {
+		if line.VendorID != 0 {
+			return []int{int(line.VendorID)}
+		}
+		ids := make([]int, len(admins))
+		for i, admin := range admins {
+			ids[i] = admin.ID
+		}
+		return ids
+	}
+
+	emails := map[int][]string{}
+	for _, line := range lines {
+		line.SuggestedQuantity = max(line.StockLevel-line.Quantity-line.OnOrder, 0)
+		userIDs := recipients(line)
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			for _, userID := range userIDs {
+				notification := models.Notification{
+					UserID:    userID,
+					ProductID: line.ProductID,
+					Title:     fmt.Sprintf("Low stock: %s", line.Name),
+					Message: fmt.Sprintf("%s has %d left at %s, at or below its reorder level of %d.",
+						line.Name, line.Quantity, line.WarehouseCode, line.ReorderLevel),
+				}
+				if err := tx.Create(&notification).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&models.Inventory{}).Where("id = ?", line.InventoryID).UpdateColumn("low_stock_notified_at", time.Now()).Error
+		})
+		if err != nil {
+			return err
+		}
+
+		text := fmt.Sprintf("%s (%s) at %s: %d left, reorder level %d, %d on order, suggested order %d",
+			line.Name, line.SKU, line.WarehouseCode, line.Quantity, line.ReorderLevel, line.OnOrder, line.SuggestedQuantity)
+		for _, userID := range userIDs {
+			emails[userID] = append(emails[userID], text)
+		}
+	}
+
+	for userID, texts := range emails {
+		var user models.User
+		if err := config.DB.First(&user, userID).Error; err != nil || user.Email == "" {
+			continue
+		}
+		body := "These products are at or below their reorder level:\n\n" + strings.Join(texts, "\n")
+		if err := utils.SendEmail(user.Email, "Products to reorder", body); err != nil {
+			log.Printf("Error emailing low stock alert to user %d: %v", userID, err)
+		}
+	}
+
+	log.Printf("Sent low stock alerts for %d locations", len(lines))
+	return nil
+}
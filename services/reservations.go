@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// expiredReservationBatch is how many expired reservations the sweeper releases per transaction.
+const expiredReservationBatch = 200
+
+// ReservationTTL is how long checkout holds stock for an unpaid order, from RESERVATION_TTL (default 15m).
+func ReservationTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("RESERVATION_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 15 * time.Minute
+}
+
+// CommitOrderReservations turns the reservations of a paid order into sales. Reservations that expired
+// or were released before the payment arrived are allocated and taken out of stock again if it allows;
+// the products that could not be are returned so the order can be followed up.
+func CommitOrderReservations(tx *gorm.DB, orderID int) ([]int, error) {
+	var reservations []models.StockReservation
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND status <> ?", orderID, models.ReservationCommitted).
+		Order("id").Find(&reservations).Error; err != nil {
+		return nil, err
+	}
+
+	var short []int
+	for _, reservation := range reservations {
+		if reservation.Status == models.ReservationHeld {
+			if err := tx.Model(&reservation).UpdateColumn("status", models.ReservationCommitted).Error; err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		allocations, err := AllocateStock(tx, []StockLine{{ProductID: reservation.ProductID, Quantity: reservation.Quantity}}, Destination{})
+		if errors.Is(err, ErrInsufficientStock) || errors.Is(err, ErrNoWarehouse) {
+			short = append(short, reservation.ProductID)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i, allocation := range allocations {
+			if err := PostStockMovement(tx, saleMovement(orderID, allocation)); err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				err = tx.Model(&reservation).Updates(map[string]interface{}{
+					"status": models.ReservationCommitted, "warehouse_id": allocation.WarehouseID, "quantity": allocation.Quantity,
+				}).Error
+			} else {
+				err = tx.Create(&models.StockReservation{
+					OrderID: orderID, ProductID: allocation.ProductID, WarehouseID: allocation.WarehouseID,
+					Quantity: allocation.Quantity, Status: models.ReservationCommitted, ExpiresAt: reservation.ExpiresAt,
+				}).Error
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return short, nil
+}
+
+// releaseReservations puts the units of locked, held reservations back in stock and marks them with
+// status. Each reservation moves out of held only once, so a release racing a commit or another release
+// never returns stock twice. It returns the products whose stock went back up.
+func releaseReservations(tx *gorm.DB, reservations []models.StockReservation, status string) ([]int, error) {
+	held := make([]int, len(reservations))
+	for i, reservation := range reservations {
+		held[i] = reservation.ProductID
+	}
+	if err := lockProducts(tx, held); err != nil {
+		return nil, err
+	}
+
+	var productIDs []int
+	for _, reservation := range reservations {
+		result := tx.Model(&models.StockReservation{}).
+			Where("id = ? AND status = ?", reservation.ID, models.ReservationHeld).
+			UpdateColumn("status", status)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		warehouseID := reservation.WarehouseID
+		if warehouseID == 0 {
+			warehouse, err := DefaultWarehouse(tx)
+			if err != nil {
+				return nil, err
+			}
+			warehouseID = int(warehouse.ID)
+		}
+		if err := PostStockMovement(tx, &models.StockMovement{
+			ProductID:     reservation.ProductID,
+			WarehouseID:   warehouseID,
+			Reason:        models.MovementReservationRelease,
+			Delta:         reservation.Quantity,
+			ReferenceType: models.MovementRefOrder,
+			ReferenceID:   reservation.OrderID,
+			Note:          "reservation " + status,
+		}); err != nil {
+			return nil, err
+		}
+		productIDs = append(productIDs, reservation.ProductID)
+	}
+	return productIDs, nil
+}
+
+// ReleaseOrderReservations gives the held stock of an order back, e.g. when its payment fails or the
+// order is deleted before it is paid.
+func ReleaseOrderReservations(db *gorm.DB, orderID int) error {
+	var released []int
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var reservations []models.StockReservation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("order_id = ? AND status = ?", orderID, models.ReservationHeld).
+			Order("id").Find(&reservations).Error; err != nil {
+			return err
+		}
+		var err error
+		released, err = releaseReservations(tx, reservations, models.ReservationReleased)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	InvalidateProductCache(released...)
+	return nil
+}
+
+// ReleaseExpiredReservations gives back the stock of reservations held past their expiry, for orders
+// whose payment never completed. It is run by the scheduler in main.
+func ReleaseExpiredReservations() error {
+	for {
+		var released []int
+		var batch int
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			var reservations []models.StockReservation
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("status = ? AND expires_at < ?", models.ReservationHeld, time.Now()).
+				Order("expires_at").Limit(expiredReservationBatch).Find(&reservations).Error; err != nil {
+				return err
+			}
+			batch = len(reservations)
+			var err error
+			released, err = releaseReservations(tx, reservations, models.ReservationExpired)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if batch > 0 {
+			log.Printf("Released %d expired stock reservations", batch)
+		}
+		InvalidateProductCache(released...)
+		if batch < expiredReservationBatch {
+			return nil
+		}
+	}
+}
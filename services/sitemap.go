@@ -0,0 +1,168 @@
+package services
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// maxSitemapURLs is the most URLs the sitemap protocol allows in one file.
+const maxSitemapURLs = 50000
+
+// ErrSitemapPageNotFound is returned for a sitemap page past the end of the catalog.
+var ErrSitemapPageNotFound = errors.New("sitemap page not found")
+
+// SitemapURL is one <url> of a sitemap.
+type SitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// URLSet is a sitemap listing pages.
+type URLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []SitemapURL `xml:"url"`
+}
+
+// SitemapRef is one <sitemap> of a sitemap index.
+type SitemapRef struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// SitemapIndex is a sitemap listing other sitemaps, used once the catalog outgrows one page.
+type SitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []SitemapRef `xml:"sitemap"`
+}
+
+// sitemapRow is what a sitemap needs of a product or category.
+type sitemapRow struct {
+	Slug      string
+	UpdatedAt time.Time
+}
+
+// SitemapPageSize is how many URLs go in one sitemap page, from SITEMAP_PAGE_SIZE (default and maximum 50000).
+func SitemapPageSize() int {
+	size, err := strconv.Atoi(os.Getenv("SITEMAP_PAGE_SIZE"))
+	if err != nil || size <= 0 || size > maxSitemapURLs {
+		return maxSitemapURLs
+	}
+	return size
+}
+
+// sitemapQuery selects the rows listed in the sitemap of kind: published products or categories.
+func sitemapQuery(db *gorm.DB, kind string) (*gorm.DB, error) {
+	switch kind {
+	case "products":
+		return db.Model(&models.Product{}).Scopes(PublishedProducts).Where("slug <> ''"), nil
+	case "categories":
+		return db.Model(&models.Category{}).Where("slug <> ''"), nil
+	}
+	return nil, ErrSitemapPageNotFound
+}
+
+// sitemapEntityType is the slug owner listed in the sitemap of kind.
+var sitemapEntityType = map[string]string{
+	"products":   models.SlugEntityProduct,
+	"categories": models.SlugEntityCategory,
+}
+
+// BuildSitemap renders /sitemap.xml: every published product and category when they fit in one page,
+// otherwise a sitemap index of the product and category pages.
+func BuildSitemap(db *gorm.DB) ([]byte, error) {
+	pageSize := SitemapPageSize()
+
+	counts := make(map[string]int64)
+	lastMods := make(map[string]*time.Time)
+	var total int64
+	for _, kind := range []string{"products", "categories"} {
+		query, _ := sitemapQuery(db, kind)
+		var summary struct {
+			Count   int64
+			LastMod *time.Time
+		}
+		if err := query.Select("COUNT(*) AS count, MAX(updated_at) AS last_mod").Scan(&summary).Error; err != nil {
+			return nil, err
+		}
+		counts[kind], lastMods[kind] = summary.Count, summary.LastMod
+		total += summary.Count
+	}
+
+	if total <= int64(pageSize) {
+		var urls []SitemapURL
+		for _, kind := range []string{"products", "categories"} {
+			page, err := sitemapURLs(db, kind, 0, pageSize)
+			if err != nil {
+				return nil, err
+			}
+			urls = append(urls, page...)
+		}
+		return marshalSitemap(URLSet{URLs: urls})
+	}
+
+	var index SitemapIndex
+	for _, kind := range []string{"products", "categories"} {
+		pages := int((counts[kind] + int64(pageSize) - 1) / int64(pageSize))
+		for page := 1; page <= pages; page++ {
+			ref := SitemapRef{Loc: fmt.Sprintf("%s/sitemaps/%s-%d.xml", strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/"), kind, page)}
+			if lastMods[kind] != nil {
+				ref.LastMod = lastMods[kind].UTC().Format(time.RFC3339)
+			}
+			index.Sitemaps = append(index.Sitemaps, ref)
+		}
+	}
+	return marshalSitemap(index)
+}
+
+// BuildSitemapPage renders page (from 1) of the products or categories sitemap referenced by the index.
+func BuildSitemapPage(db *gorm.DB, kind string, page int) ([]byte, error) {
+	if page < 1 {
+		return nil, ErrSitemapPageNotFound
+	}
+	pageSize := SitemapPageSize()
+	urls, err := sitemapURLs(db, kind, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 && page > 1 {
+		return nil, ErrSitemapPageNotFound
+	}
+	return marshalSitemap(URLSet{URLs: urls})
+}
+
+// sitemapURLs lists the canonical URLs of kind in ID order, so pages are stable between requests.
+func sitemapURLs(db *gorm.DB, kind string, offset, limit int) ([]SitemapURL, error) {
+	query, err := sitemapQuery(db, kind)
+	if err != nil {
+		return nil, err
+	}
+	var rows []sitemapRow
+	if err := query.Select("slug, updated_at").Order("id").Offset(offset).Limit(limit).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	urls := make([]SitemapURL, len(rows))
+	for i, row := range rows {
+		urls[i] = SitemapURL{
+			Loc:     CanonicalURL(sitemapEntityType[kind], row.Slug),
+			LastMod: row.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+	}
+	return urls, nil
+}
+
+func marshalSitemap(sitemap interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(sitemap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrSlugTaken is returned when a slug is already the current slug of another product or category.
+var ErrSlugTaken = errors.New("slug is already in use")
+
+// slugTables maps the slug owners of SlugRedirect to their tables.
+var slugTables = map[string]string{
+	models.SlugEntityProduct:  "products",
+	models.SlugEntityCategory: "categories",
+}
+
+// ReconcileSlug is called when a product or category is saved with slug. An empty slug keeps the
+// previous one; a new slug is validated and the previous one is kept as a redirect so old links still work.
+func ReconcileSlug(tx *gorm.DB, entityType string, entityID int, previous string, slug *string) error {
+	if *slug == "" || *slug == previous {
+		*slug = previous
+		return nil
+	}
+	if err := models.ValidateSlug(*slug); err != nil {
+		return err
+	}
+
+	var taken int64
+	if err := tx.Table(slugTables[entityType]).Where("slug = ? AND id <> ?", *slug, entityID).Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrSlugTaken
+	}
+
+	// The new slug may be an old slug of this or another entity; it now belongs to this one
+	if err := tx.Where("entity_type = ? AND slug = ?", entityType, *slug).Delete(&models.SlugRedirect{}).Error; err != nil {
+		return err
+	}
+	if previous == "" {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "entity_type"}, {Name: "slug"}},
+		DoUpdates: clause.AssignmentColumns([]string{"entity_id"}),
+	}).Create(&models.SlugRedirect{EntityType: entityType, Slug: previous, EntityID: entityID}).Error
+}
+
+// ResolveSlug finds the product or category a slug belongs to. When the slug is an old one, redirect
+// is true and current is the slug to redirect to.
+func ResolveSlug(db *gorm.DB, entityType, slug string) (entityID int, current string, redirect bool, err error) {
+	table := slugTables[entityType]
+
+	var ids []int
+	if err := db.Table(table).Where("slug = ? AND deleted_at IS NULL", slug).Limit(1).Pluck("id", &ids).Error; err != nil {
+		return 0, "", false, err
+	}
+	if len(ids) > 0 {
+		return ids[0], slug, false, nil
+	}
+
+	var old models.SlugRedirect
+	if err := db.Where("entity_type = ? AND slug = ?", entityType, slug).First(&old).Error; err != nil {
+		return 0, "", false, err
+	}
+	var slugs []string
+	if err := db.Table(table).Where("id = ? AND deleted_at IS NULL", old.EntityID).Limit(1).Pluck("slug", &slugs).Error; err != nil {
+		return 0, "", false, err
+	}
+	if len(slugs) == 0 {
+		return 0, "", false, gorm.ErrRecordNotFound
+	}
+	return old.EntityID, slugs[0], true, nil
+}
+
+// CanonicalURL is the public storefront URL of a product or category, under APP_BASE_URL.
+func CanonicalURL(entityType, slug string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(os.Getenv("APP_BASE_URL"), "/"), slugTables[entityType], slug)
+}
+
+// BackfillSlugs gives every product and category created before slugs existed a slug from its name.
+// It is run at startup and does nothing once every row has one.
+func BackfillSlugs() error {
+	var products []models.Product
+	if err := config.DB.Unscoped().Select("id", "name").Where("slug = ''").Find(&products).Error; err != nil {
+		return err
+	}
+	for _, product := range products {
+		slug, err := models.UniqueSlug(config.DB, "products", models.SlugEntityProduct, product.Name, "product")
+		if err != nil {
+			return err
+		}
+		if err := config.DB.Unscoped().Model(&product).UpdateColumn("slug", slug).Error; err != nil {
+			return err
+		}
+	}
+
+	var categories []models.Category
+	if err := config.DB.Unscoped().Select("id", "name").Where("slug = ''").Find(&categories).Error; err != nil {
+		return err
+	}
+	for _, category := range categories {
+		slug, err := models.UniqueSlug(config.DB, "categories", models.SlugEntityCategory, category.Name, "category")
+		if err != nil {
+			return err
+		}
+		if err := config.DB.Unscoped().Model(&category).UpdateColumn("slug", slug).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// ErrInsufficientStock is returned when a stock movement would take a location below zero.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// ReserveOrderStock holds the stock of an order until expiresAt while it is paid for. The units are
+// allocated to warehouses with the configured strategy and taken out of the sellable quantity of the
+// product and of its locations straight away, so concurrent checkouts can never reserve more than there
+// is. Bundle lines are expanded into their components, which are reserved instead of the bundle itself,
+// and the breakdown is stored on the order item. Digital products have no stock and are skipped.
+func ReserveOrderStock(tx *gorm.DB, order *models.Order, destination Destination, expiresAt time.Time) error {
+	productIDs := make([]int, len(order.OrderItems))
+	for i, item := range order.OrderItems {
+		productIDs[i] = item.ProductID
+	}
+
+	bundles, err := LoadBundleComponents(tx, productIDs)
+	if err != nil {
+		return err
+	}
+	digital, err := DigitalProductIDs(tx, productIDs)
+	if err != nil {
+		return err
+	}
+
+	var lines []StockLine
+	for i := range order.OrderItems {
+		item := &order.OrderItems[i]
+		if digital[item.ProductID] {
+			continue
+		}
+		components, isBundle := bundles[item.ProductID]
+		if !isBundle {
+			lines = append(lines, StockLine{ProductID: item.ProductID, Quantity: item.Quantity})
+			continue
+		}
+
+		breakdown := AllocateBundleLine(components, item.Quantity, item.Total)
+		for j := range breakdown {
+			lines = append(lines, StockLine{ProductID: breakdown[j].ProductID, Quantity: breakdown[j].Quantity})
+			breakdown[j].OrderItemID = int(item.ID)
+		}
+		if err := tx.Create(&breakdown).Error; err != nil {
+			return err
+		}
+		item.Components = breakdown
+	}
+
+	allocations, err := AllocateStock(tx, lines, destination)
+	if err != nil {
+		return err
+	}
+	for _, allocation := range allocations {
+		if err := holdStock(tx, int(order.ID), allocation, expiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// holdStock takes allocated units out of stock as a sale of the order and records them as held for it.
+func holdStock(tx *gorm.DB, orderID int, allocation Allocation, expiresAt time.Time) error {
+	if err := PostStockMovement(tx, saleMovement(orderID, allocation)); err != nil {
+		return err
+	}
+	return tx.Create(&models.StockReservation{
+		OrderID:     orderID,
+		ProductID:   allocation.ProductID,
+		WarehouseID: allocation.WarehouseID,
+		Quantity:    allocation.Quantity,
+		Status:      models.ReservationHeld,
+		ExpiresAt:   expiresAt,
+	}).Error
+}
+
+// saleMovement is the ledger entry of allocated units leaving stock for an order.
+func saleMovement(orderID int, allocation Allocation) *models.StockMovement {
+	return &models.StockMovement{
+		ProductID:     allocation.ProductID,
+		WarehouseID:   allocation.WarehouseID,
+		Reason:        models.MovementSale,
+		Delta:         -allocation.Quantity,
+		ReferenceType: models.MovementRefOrder,
+		ReferenceID:   orderID,
+	}
+}
@@ -0,0 +1,476 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrStockTakeState is returned when a stock take cannot make the requested move from its status.
+var ErrStockTakeState = errors.New("stock take cannot do this in its current status")
+
+// StockTakeScope selects the locations a stock take counts: the given products at the given warehouses.
+// Without products every product stocked at the warehouses is counted, and without warehouses every
+// location of the products.
+type StockTakeScope struct {
+	ProductIDs   []int `json:"product_ids"`
+	WarehouseIDs []int `json:"warehouse_ids"`
+}
+
+// StockCount is a counted quantity at a location. The product is given by ID or SKU and the warehouse
+// by ID or code; the warehouse can be left out when the stock take counts the product at one location only.
+type StockCount struct {
+	ProductID       int    `json:"product_id"`
+	SKU             string `json:"sku"`
+	WarehouseID     int    `json:"warehouse_id"`
+	WarehouseCode   string `json:"warehouse_code"`
+	CountedQuantity int    `json:"counted_quantity"`
+}
+
+// OpenStockTake starts a stock take of the locations in scope, recording the stock expected on the shelf
+// at each (see onHandStock). When both products and warehouses are given, locations without stock are
+// included with nothing expected.
+func OpenStockTake(db *gorm.DB, scope StockTakeScope, notes string, actorID int) (*models.StockTake, error) {
+	if len(scope.ProductIDs) == 0 && len(scope.WarehouseIDs) == 0 {
+		return nil, errors.New("a stock take needs product_ids or warehouse_ids")
+	}
+
+	stockTake := models.StockTake{Status: models.StockTakeOpen, Notes: notes, CreatedBy: actorID}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, productID := range scope.ProductIDs {
+			var product models.Product
+			if err := tx.First(&product, productID).Error; err != nil {
+				return fmt.Errorf("product %d not found", productID)
+			}
+			if !stocksProduct(&product) {
+				return fmt.Errorf("product %d is a %s and has no stock of its own", productID, product.Type)
+			}
+		}
+		for _, warehouseID := range scope.WarehouseIDs {
+			if err := tx.First(&models.Warehouse{}, warehouseID).Error; err != nil {
+				return fmt.Errorf("warehouse %d not found", warehouseID)
+			}
+		}
+
+		query := tx.Model(&models.Inventory{}).
+			Joins("JOIN products ON products.id = inventories.product_id AND products.deleted_at IS NULL AND products.type = ?", models.ProductTypeSimple).
+			Order("inventories.warehouse_id, inventories.product_id")
+		if len(scope.ProductIDs) > 0 {
+			query = query.Where("inventories.product_id IN ?", scope.ProductIDs)
+		}
+		if len(scope.WarehouseIDs) > 0 {
+			query = query.Where("inventories.warehouse_id IN ?", scope.WarehouseIDs)
+		}
+		var inventories []models.Inventory
+		if err := query.Find(&inventories).Error; err != nil {
+			return err
+		}
+
+		held, err := heldStock(tx, inventories)
+		if err != nil {
+			return err
+		}
+
+		type location struct{ productID, warehouseID int }
+		expected := make(map[location]int, len(inventories))
+		for _, inventory := range inventories {
+			onHand := inventory.Quantity + held[[2]int{inventory.ProductID, inventory.WarehouseID}]
+			expected[location{inventory.ProductID, inventory.WarehouseID}] = onHand
+			stockTake.Lines = append(stockTake.Lines, models.StockTakeLine{
+				ProductID: inventory.ProductID, WarehouseID: inventory.WarehouseID, ExpectedQuantity: onHand,
+			})
+		}
+		for _, warehouseID := range scope.WarehouseIDs {
+			for _, productID := range scope.ProductIDs {
+				if _, ok := expected[location{productID, warehouseID}]; !ok {
+					expected[location{productID, warehouseID}] = 0
+					stockTake.Lines = append(stockTake.Lines, models.StockTakeLine{ProductID: productID, WarehouseID: warehouseID})
+				}
+			}
+		}
+		if len(stockTake.Lines) == 0 {
+			return errors.New("there is no stock to count in scope")
+		}
+		return tx.Create(&stockTake).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stockTake, nil
+}
+
+// heldStock returns the units held by reservations at each of the locations, keyed by product and
+// warehouse ID. Checkout takes reserved units out of a location's stock while they are still on its shelf
+// until the order is paid, so a count finds them. Reservations from before warehouses existed are held
+// at the default warehouse.
+func heldStock(tx *gorm.DB, inventories []models.Inventory) (map[[2]int]int, error) {
+	held := make(map[[2]int]int)
+	if len(inventories) == 0 {
+		return held, nil
+	}
+	productIDs := make([]int, len(inventories))
+	for i, inventory := range inventories {
+		productIDs[i] = inventory.ProductID
+	}
+	var rows []struct {
+		ProductID   int
+		WarehouseID int
+		Quantity    int
+	}
+	if err := tx.Model(&models.StockReservation{}).
+		Select("product_id, warehouse_id, SUM(quantity) AS quantity").
+		Where("status = ? AND product_id IN ?", models.ReservationHeld, productIDs).
+		Group("product_id, warehouse_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	defaultWarehouseID := 0
+	for _, row := range rows {
+		if row.WarehouseID == 0 && defaultWarehouseID == 0 {
+			warehouse, err := DefaultWarehouse(tx)
+			if err != nil {
+				return nil, err
+			}
+			defaultWarehouseID = int(warehouse.ID)
+		}
+		if row.WarehouseID == 0 {
+			row.WarehouseID = defaultWarehouseID
+		}
+		held[[2]int{row.ProductID, row.WarehouseID}] += row.Quantity
+	}
+	return held, nil
+}
+
+// onHandStock returns the stock on the shelf at every location of the products: the recorded stock plus
+// the units held by reservations.
+func onHandStock(tx *gorm.DB, productIDs []int) (map[[2]int]int, error) {
+	var inventories []models.Inventory
+	if err := tx.Where("product_id IN ?", productIDs).Find(&inventories).Error; err != nil {
+		return nil, err
+	}
+	onHand, err := heldStock(tx, inventories)
+	if err != nil {
+		return nil, err
+	}
+	for _, inventory := range inventories {
+		onHand[[2]int{inventory.ProductID, inventory.WarehouseID}] += inventory.Quantity
+	}
+	return onHand, nil
+}
+
+// moveStockTake locks a stock take, checks it is open and changes it with apply.
+func moveStockTake(db *gorm.DB, stockTakeID int, apply func(tx *gorm.DB, stockTake *models.StockTake) error) (*models.StockTake, error) {
+	var stockTake models.StockTake
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Lines", func(db *gorm.DB) *gorm.DB {
+			return db.Order("warehouse_id, product_id")
+		}).First(&stockTake, stockTakeID).Error; err != nil {
+			return err
+		}
+		if stockTake.Status != models.StockTakeOpen {
+			return fmt.Errorf("%w: it is %s", ErrStockTakeState, stockTake.Status)
+		}
+		if err := apply(tx, &stockTake); err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Save(&stockTake).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stockTake, nil
+}
+
+// RecordStockCounts stores counted quantities on an open stock take. Counts of the same location in one
+// batch are added up, e.g. from several bins; a later batch replaces the earlier count of a location.
+func RecordStockCounts(db *gorm.DB, stockTakeID int, counts []StockCount, actorID int) (*models.StockTake, error) {
+	if len(counts) == 0 {
+		return nil, errors.New("no counts given")
+	}
+	return moveStockTake(db, stockTakeID, func(tx *gorm.DB, stockTake *models.StockTake) error {
+		if err := resolveStockCounts(tx, counts); err != nil {
+			return err
+		}
+
+		counted := make(map[int]int) // line index -> units
+		for _, count := range counts {
+			if count.CountedQuantity < 0 {
+				return fmt.Errorf("counted quantity of product %d cannot be negative", count.ProductID)
+			}
+			line := -1
+			for i, candidate := range stockTake.Lines {
+				if candidate.ProductID != count.ProductID || (count.WarehouseID != 0 && candidate.WarehouseID != count.WarehouseID) {
+					continue
+				}
+				if line >= 0 {
+					return fmt.Errorf("product %d is counted at several warehouses; give the warehouse", count.ProductID)
+				}
+				line = i
+			}
+			if line < 0 {
+				return fmt.Errorf("product %d at warehouse %d is not part of the stock take", count.ProductID, count.WarehouseID)
+			}
+			counted[line] += count.CountedQuantity
+		}
+
+		now := time.Now()
+		for i, units := range counted {
+			line := &stockTake.Lines[i]
+			line.CountedQuantity, line.CountedBy, line.CountedAt = &units, actorID, &now
+			if err := tx.Model(line).Updates(map[string]interface{}{
+				"counted_quantity": units, "counted_by": actorID, "counted_at": now,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// resolveStockCounts fills in the product and warehouse IDs of counts given by SKU or warehouse code.
+func resolveStockCounts(tx *gorm.DB, counts []StockCount) error {
+	for i := range counts {
+		count := &counts[i]
+		if count.ProductID == 0 {
+			if count.SKU == "" {
+				return errors.New("every count needs a product_id or sku")
+			}
+			var product models.Product
+			if err := tx.Select("id").Where("sku = ?", count.SKU).First(&product).Error; err != nil {
+				return fmt.Errorf("no product with SKU %q", count.SKU)
+			}
+			count.ProductID = int(product.ID)
+		}
+		if count.WarehouseID == 0 && count.WarehouseCode != "" {
+			var warehouse models.Warehouse
+			if err := tx.Select("id").Where("code = ?", strings.ToUpper(count.WarehouseCode)).First(&warehouse).Error; err != nil {
+				return fmt.Errorf("no warehouse with code %q", count.WarehouseCode)
+			}
+			count.WarehouseID = int(warehouse.ID)
+		}
+	}
+	return nil
+}
+
+// ParseStockCountsCSV reads counts from a CSV file with a header row. The columns are counted_quantity
+// and product_id or sku, and optionally warehouse_id or warehouse_code.
+func ParseStockCountsCSV(r io.Reader) ([]StockCount, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("the CSV file needs a header row")
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["counted_quantity"]; !ok {
+		return nil, errors.New("the CSV file needs a counted_quantity column")
+	}
+	_, hasProductID := columns["product_id"]
+	_, hasSKU := columns["sku"]
+	if !hasProductID && !hasSKU {
+		return nil, errors.New("the CSV file needs a product_id or sku column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	number := func(record []string, name string, row int) (int, error) {
+		value := field(record, name)
+		if value == "" {
+			return 0, nil
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("row %d: %s must be a whole number", row, name)
+		}
+		return parsed, nil
+	}
+
+	var counts []StockCount
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		count := StockCount{SKU: field(record, "sku"), WarehouseCode: field(record, "warehouse_code")}
+		if count.ProductID, err = number(record, "product_id", row); err != nil {
+			return nil, err
+		}
+		if count.WarehouseID, err = number(record, "warehouse_id", row); err != nil {
+			return nil, err
+		}
+		if field(record, "counted_quantity") == "" {
+			return nil, fmt.Errorf("row %d: counted_quantity is required", row)
+		}
+		if count.CountedQuantity, err = number(record, "counted_quantity", row); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
+
+// VarianceLine compares the counted stock of a location with the stock on its shelf.
+type VarianceLine struct {
+	ProductID        int     `json:"product_id"`
+	SKU              string  `json:"sku"`
+	Name             string  `json:"name"`
+	WarehouseID      int     `json:"warehouse_id"`
+	ExpectedQuantity int     `json:"expected_quantity"` // on hand when the stock take was opened
+	CountedQuantity  *int    `json:"counted_quantity"`
+	CurrentQuantity  int     `json:"current_quantity"` // on hand now, including units held by reservations
+	Variance         int     `json:"variance"`         // counted minus current, 0 until counted
+	VarianceValue    float64 `json:"variance_value"`
+}
+
+// VarianceReport is the outcome of a stock take, valued at current list prices.
+type VarianceReport struct {
+	StockTakeID        uint           `json:"stock_take_id"`
+	Status             string         `json:"status"`
+	Currency           string         `json:"currency"`
+	CountedLines       int            `json:"counted_lines"`
+	UncountedLines     int            `json:"uncounted_lines"`
+	TotalVarianceUnits int            `json:"total_variance_units"`
+	TotalVarianceValue float64        `json:"total_variance_value"`
+	Lines              []VarianceLine `json:"lines"`
+}
+
+// StockTakeVariance reports the difference between the counted stock of every location and the stock on
+// its shelf now, which is what approving the stock take would post.
+func StockTakeVariance(db *gorm.DB, stockTakeID int) (*VarianceReport, error) {
+	var stockTake models.StockTake
+	if err := db.Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("warehouse_id, product_id")
+	}).First(&stockTake, stockTakeID).Error; err != nil {
+		return nil, err
+	}
+
+	productIDs := make([]int, len(stockTake.Lines))
+	for i, line := range stockTake.Lines {
+		productIDs[i] = line.ProductID
+	}
+	var products []models.Product
+	if err := db.Unscoped().Select("id", "sku", "name", "price").Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	productsByID := make(map[int]models.Product, len(products))
+	for _, product := range products {
+		productsByID[int(product.ID)] = product
+	}
+	current, err := onHandStock(db, productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VarianceReport{StockTakeID: stockTake.ID, Status: stockTake.Status, Currency: BaseCurrency(), Lines: []VarianceLine{}}
+	for _, line := range stockTake.Lines {
+		product := productsByID[line.ProductID]
+		variance := VarianceLine{
+			ProductID:        line.ProductID,
+			SKU:              product.SKU,
+			Name:             product.Name,
+			WarehouseID:      line.WarehouseID,
+			ExpectedQuantity: line.ExpectedQuantity,
+			CountedQuantity:  line.CountedQuantity,
+			CurrentQuantity:  current[[2]int{line.ProductID, line.WarehouseID}],
+		}
+		if line.CountedQuantity == nil {
+			report.UncountedLines++
+		} else {
+			report.CountedLines++
+			variance.Variance = *line.CountedQuantity - variance.CurrentQuantity
+			variance.VarianceValue = float64(variance.Variance) * product.Price
+		}
+		report.TotalVarianceUnits += variance.Variance
+		report.TotalVarianceValue += variance.VarianceValue
+		report.Lines = append(report.Lines, variance)
+	}
+	return report, nil
+}
+
+// ApproveStockTake brings the stock on the shelf of every location to its count and closes the stock take.
+// The products are locked so no sale or release moves their stock while the variance, the count minus
+// the recorded stock and the units held by reservations, is posted to the ledger as an adjustment. Held
+// units stay reserved for their orders, so a count below them cannot be approved until they are released.
+// Every location must have been counted.
+func ApproveStockTake(db *gorm.DB, stockTakeID, actorID int) (*models.StockTake, error) {
+	var adjusted []int
+	stockTake, err := moveStockTake(db, stockTakeID, func(tx *gorm.DB, stockTake *models.StockTake) error {
+		uncounted := 0
+		for _, line := range stockTake.Lines {
+			if line.CountedQuantity == nil {
+				uncounted++
+			}
+		}
+		if uncounted > 0 {
+			return fmt.Errorf("%w: %d locations have not been counted", ErrStockTakeState, uncounted)
+		}
+
+		productIDs := make([]int, len(stockTake.Lines))
+		for i, line := range stockTake.Lines {
+			productIDs[i] = line.ProductID
+		}
+		if err := lockProducts(tx, productIDs); err != nil {
+			return err
+		}
+		onHand, err := onHandStock(tx, productIDs)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range stockTake.Lines {
+			current := onHand[[2]int{line.ProductID, line.WarehouseID}]
+			variance := *line.CountedQuantity - current
+			if variance == 0 {
+				continue
+			}
+			if err := PostStockMovement(tx, &models.StockMovement{
+				ProductID:     line.ProductID,
+				WarehouseID:   line.WarehouseID,
+				Reason:        models.MovementAdjustment,
+				Delta:         variance,
+				ReferenceType: models.MovementRefStockTake,
+				ReferenceID:   int(stockTake.ID),
+				Note:          fmt.Sprintf("stock take: counted %d, on hand %d", *line.CountedQuantity, current),
+				ActorID:       actorID,
+			}); err != nil {
+				return err
+			}
+			adjusted = append(adjusted, line.ProductID)
+		}
+
+		now := time.Now()
+		stockTake.Status, stockTake.ApprovedBy, stockTake.ApprovedAt = models.StockTakeApproved, actorID, &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	InvalidateProductCache(adjusted...)
+	return stockTake, nil
+}
+
+// CancelStockTake abandons an open stock take without changing stock.
+func CancelStockTake(db *gorm.DB, stockTakeID int) (*models.StockTake, error) {
+	return moveStockTake(db, stockTakeID, func(tx *gorm.DB, stockTake *models.StockTake) error {
+		stockTake.Status = models.StockTakeCancelled
+		return nil
+	})
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStockCountsCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []StockCount
+		wantErr string
+	}{
+		{
+			name: "product IDs and warehouse codes",
+			csv:  "product_id,warehouse_code,counted_quantity\n1,MAIN,5\n2, EAST ,0\n",
+			want: []StockCount{
+				{ProductID: 1, WarehouseCode: "MAIN", CountedQuantity: 5},
+				{ProductID: 2, WarehouseCode: "EAST", CountedQuantity: 0},
+			},
+		},
+		{
+			name: "SKUs, any column order and case",
+			csv:  "Counted_Quantity,Warehouse_ID,SKU\n3,2,ABC-1\n",
+			want: []StockCount{{SKU: "ABC-1", WarehouseID: 2, CountedQuantity: 3}},
+		},
+		{
+			name: "header only",
+			csv:  "sku,counted_quantity\n",
+			want: nil,
+		},
+		{name: "empty file", csv: "", wantErr: "needs a header row"},
+		{name: "no counted quantity column", csv: "sku\nABC-1\n", wantErr: "needs a counted_quantity column"},
+		{name: "no product column", csv: "warehouse_id,counted_quantity\n1,5\n", wantErr: "needs a product_id or sku column"},
+		{name: "missing count", csv: "sku,counted_quantity\nABC-1,\n", wantErr: "row 2: counted_quantity is required"},
+		{name: "fractional count", csv: "sku,counted_quantity\nABC-1,1\nABC-2,1.5\n", wantErr: "row 3: counted_quantity must be a whole number"},
+		{name: "bad product ID", csv: "product_id,counted_quantity\nx,1\n", wantErr: "row 2: product_id must be a whole number"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseStockCountsCSV(strings.NewReader(test.csv))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("ParseStockCountsCSV() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseStockCountsCSV() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseStockCountsCSV() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
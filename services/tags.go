@@ -0,0 +1,217 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxTagLength is the longest tag name accepted.
+const maxTagLength = 50
+
+// NormaliseTagName trims a tag name, lower-cases it and collapses inner whitespace, so "Summer  Sale"
+// and "summer sale" are the same tag.
+func NormaliseTagName(name string) (string, error) {
+	normalised := strings.Join(strings.Fields(strings.ToLower(name)), " ")
+	if normalised == "" {
+		return "", errors.New("tag name is required")
+	}
+	if len(normalised) > maxTagLength {
+		return "", fmt.Errorf("tag %q is longer than %d characters", name, maxTagLength)
+	}
+	return normalised, nil
+}
+
+// ParseTagNames normalises a list of tag names and drops duplicates, keeping their order.
+func ParseTagNames(names []string) ([]string, error) {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		tag, err := NormaliseTagName(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// findOrCreateTags returns the tags with the given normalised names, creating the missing ones and
+// restoring deleted ones.
+func findOrCreateTags(tx *gorm.DB, names []string) ([]models.Tag, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	newTags := make([]models.Tag, len(names))
+	for i, name := range names {
+		newTags[i] = models.Tag{Name: name}
+	}
+	if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoNothing: true}).Create(&newTags).Error; err != nil {
+		return nil, err
+	}
+
+	// A deleted tag still holds its name, so it is brought back rather than created again
+	if err := tx.Unscoped().Model(&models.Tag{}).Where("name IN ? AND deleted_at IS NOT NULL", names).
+		Update("deleted_at", nil).Error; err != nil {
+		return nil, err
+	}
+
+	var tags []models.Tag
+	err := tx.Where("name IN ?", names).Find(&tags).Error
+	return tags, err
+}
+
+// SetProductTags replaces the tags of a product with names, creating tags that do not exist yet.
+// It returns the product's tags in normalised form.
+func SetProductTags(db *gorm.DB, productID int, names []string) ([]string, error) {
+	tagNames, err := ParseTagNames(names)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		tags, err := findOrCreateTags(tx, tagNames)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("product_id = ?", productID).Delete(&models.ProductTag{}).Error; err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+		links := make([]models.ProductTag, len(tags))
+		for i, tag := range tags {
+			links[i] = models.ProductTag{ProductID: productID, TagID: int(tag.ID)}
+		}
+		return tx.Create(&links).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tagNames == nil {
+		tagNames = []string{}
+	}
+	return tagNames, nil
+}
+
+// RemoveProductTag removes one tag from a product. It reports whether the product had the tag.
+func RemoveProductTag(db *gorm.DB, productID int, name string) (bool, error) {
+	tag, err := NormaliseTagName(name)
+	if err != nil {
+		return false, err
+	}
+	result := db.Where("product_id = ? AND tag_id IN (?)", productID, db.Model(&models.Tag{}).Select("id").Where("name = ?", tag)).
+		Delete(&models.ProductTag{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ProductTagNames returns the tags of each product, sorted by name.
+func ProductTagNames(db *gorm.DB, productIDs []uint) (map[uint][]string, error) {
+	var rows []struct {
+		ProductID uint
+		Name      string
+	}
+	err := db.Table("product_tags").
+		Select("product_tags.product_id, tags.name").
+		Joins("JOIN tags ON tags.id = product_tags.tag_id AND tags.deleted_at IS NULL").
+		Where("product_tags.product_id IN ?", productIDs).
+		Order("tags.name").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byProduct := make(map[uint][]string)
+	for _, row := range rows {
+		byProduct[row.ProductID] = append(byProduct[row.ProductID], row.Name)
+	}
+	return byProduct, nil
+}
+
+// ApplyProductTags fills in Product.Tags.
+func ApplyProductTags(db *gorm.DB, products []models.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	byProduct, err := ProductTagNames(db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range products {
+		products[i].Tags = byProduct[products[i].ID]
+	}
+	return nil
+}
+
+// FilterByTags restricts a product query to products carrying every one of the given tags.
+func FilterByTags(query *gorm.DB, tags []string) *gorm.DB {
+	for _, tag := range tags {
+		query = query.Where("EXISTS (SELECT 1 FROM product_tags JOIN tags ON tags.id = product_tags.tag_id AND tags.deleted_at IS NULL WHERE product_tags.product_id = products.id AND tags.name = ?)", tag)
+	}
+	return query
+}
+
+// TagCount is one entry of a tag cloud.
+type TagCount struct {
+	Name          string `json:"name"`
+	ProductCount  int64  `json:"product_count"`
+	BlogPostCount int64  `json:"blog_post_count"`
+}
+
+// TagCloud returns the tags of published products with how many products and blog posts carry
+// each, most used first. categoryID limits the product counts to one category when it is not 0.
+func TagCloud(db *gorm.DB, categoryID int, limit int) ([]TagCount, error) {
+	products := db.Table("product_tags").
+		Select("product_tags.tag_id, COUNT(*) AS product_count").
+		Joins("JOIN products ON products.id = product_tags.product_id AND products.deleted_at IS NULL").
+		Scopes(PublishedProducts).
+		Group("product_tags.tag_id")
+	if categoryID != 0 {
+		products = products.Where("products.category_id = ?", categoryID)
+	}
+	blogPosts := db.Table("blog_post_tags").
+		Select("blog_post_tags.tag_id, COUNT(*) AS blog_post_count").
+		Group("blog_post_tags.tag_id")
+
+	cloud := []TagCount{}
+	err := db.Table("tags").
+		Select("tags.name, p.product_count, COALESCE(b.blog_post_count, 0) AS blog_post_count").
+		Joins("JOIN (?) AS p ON p.tag_id = tags.id", products).
+		Joins("LEFT JOIN (?) AS b ON b.tag_id = tags.id", blogPosts).
+		Where("tags.deleted_at IS NULL").
+		Order("p.product_count DESC, tags.name").
+		Limit(limit).
+		Scan(&cloud).Error
+	return cloud, err
+}
+
+// BlogPostProducts returns published products sharing tags with a blog post, those sharing the most
+// tags first, then the best rated.
+func BlogPostProducts(db *gorm.DB, postID int, limit int) ([]models.Product, error) {
+	var post models.BlogPost
+	if err := db.Select("id").First(&post, postID).Error; err != nil {
+		return nil, err
+	}
+
+	products := []models.Product{}
+	err := db.Model(&models.Product{}).Scopes(PublishedProducts).
+		Joins("JOIN product_tags ON product_tags.product_id = products.id").
+		Joins("JOIN blog_post_tags ON blog_post_tags.tag_id = product_tags.tag_id AND blog_post_tags.blog_post_id = ?", postID).
+		Group("products.id").
+		Order("COUNT(*) DESC, products.average_rating DESC, products.id").
+		Limit(limit).
+		Find(&products).Error
+	return products, err
+}
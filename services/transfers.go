@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrTransferState is returned when a transfer order cannot make the requested move from its status.
+var ErrTransferState = errors.New("transfer order cannot do this in its current status")
+
+// CreateTransferOrder validates and saves a draft transfer order between two warehouses.
+func CreateTransferOrder(db *gorm.DB, transfer *models.TransferOrder) error {
+	if transfer.FromWarehouseID == transfer.ToWarehouseID {
+		return errors.New("a transfer needs two different warehouses")
+	}
+	var count int64
+	if err := db.Model(&models.Warehouse{}).Where("id IN ?", []int{transfer.FromWarehouseID, transfer.ToWarehouseID}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count != 2 {
+		return errors.New("warehouse not found")
+	}
+	if len(transfer.Items) == 0 {
+		return errors.New("a transfer needs at least one item")
+	}
+
+	seen := make(map[int]bool)
+	for _, item := range transfer.Items {
+		if item.Quantity < 1 {
+			return fmt.Errorf("quantity of product %d must be at least 1", item.ProductID)
+		}
+		if seen[item.ProductID] {
+			return fmt.Errorf("product %d is listed twice", item.ProductID)
+		}
+		seen[item.ProductID] = true
+
+		var product models.Product
+		if err := db.First(&product, item.ProductID).Error; err != nil {
+			return fmt.Errorf("product %d not found", item.ProductID)
+		}
+		if !stocksProduct(&product) {
+			return fmt.Errorf("product %d is a %s and has no stock of its own", item.ProductID, product.Type)
+		}
+	}
+
+	transfer.ID = 0
+	transfer.Status = models.TransferDraft
+	transfer.ShippedAt, transfer.ReceivedAt = nil, nil
+	for i := range transfer.Items {
+		transfer.Items[i].ID = 0
+	}
+	return db.Create(transfer).Error
+}
+
+// moveTransfer locks a transfer order, checks it is in status from and moves it on with apply.
+func moveTransfer(db *gorm.DB, transferID int, from []string, apply func(tx *gorm.DB, transfer *models.TransferOrder) error) (*models.TransferOrder, error) {
+	var transfer models.TransferOrder
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&transfer, transferID).Error; err != nil {
+			return err
+		}
+		allowed := false
+		for _, status := range from {
+			allowed = allowed || transfer.Status == status
+		}
+		if !allowed {
+			return fmt.Errorf("%w: it is %s", ErrTransferState, transfer.Status)
+		}
+		productIDs := make([]int, len(transfer.Items))
+		for i, item := range transfer.Items {
+			productIDs[i] = item.ProductID
+		}
+		if err := lockProducts(tx, productIDs); err != nil {
+			return err
+		}
+		if err := apply(tx, &transfer); err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Save(&transfer).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	productIDs := make([]int, len(transfer.Items))
+	for i, item := range transfer.Items {
+		productIDs[i] = item.ProductID
+	}
+	InvalidateProductCache(productIDs...)
+	return &transfer, nil
+}
+
+// ShipTransferOrder takes the items of a draft transfer out of the source warehouse. They cannot be
+// sold until the transfer is received.
+func ShipTransferOrder(db *gorm.DB, transferID, actorID int) (*models.TransferOrder, error) {
+	return moveTransfer(db, transferID, []string{models.TransferDraft}, func(tx *gorm.DB, transfer *models.TransferOrder) error {
+		for _, item := range transfer.Items {
+			if err := PostStockMovement(tx, transferMovement(transfer, item, transfer.FromWarehouseID, -item.Quantity, actorID)); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		transfer.Status, transfer.ShippedAt = models.TransferInTransit, &now
+		return nil
+	})
+}
+
+// ReceiveTransferOrder puts the items of a transfer in transit into the destination warehouse.
+func ReceiveTransferOrder(db *gorm.DB, transferID, actorID int) (*models.TransferOrder, error) {
+	return moveTransfer(db, transferID, []string{models.TransferInTransit}, func(tx *gorm.DB, transfer *models.TransferOrder) error {
+		for _, item := range transfer.Items {
+			if err := PostStockMovement(tx, transferMovement(transfer, item, transfer.ToWarehouseID, item.Quantity, actorID)); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		transfer.Status, transfer.ReceivedAt = models.TransferReceived, &now
+		return nil
+	})
+}
+
+// CancelTransferOrder cancels a draft transfer, or one in transit, whose items then go back to the source warehouse.
+func CancelTransferOrder(db *gorm.DB, transferID, actorID int) (*models.TransferOrder, error) {
+	return moveTransfer(db, transferID, []string{models.TransferDraft, models.TransferInTransit}, func(tx *gorm.DB, transfer *models.TransferOrder) error {
+		if transfer.Status == models.TransferInTransit {
+			for _, item := range transfer.Items {
+				if err := PostStockMovement(tx, transferMovement(transfer, item, transfer.FromWarehouseID, item.Quantity, actorID)); err != nil {
+					return err
+				}
+			}
+		}
+		transfer.Status = models.TransferCancelled
+		return nil
+	})
+}
+
+// transferMovement is the ledger entry of a transfer item leaving or reaching a warehouse.
+func transferMovement(transfer *models.TransferOrder, item models.TransferOrderItem, warehouseID, delta, actorID int) *models.StockMovement {
+	return &models.StockMovement{
+		ProductID:     item.ProductID,
+		WarehouseID:   warehouseID,
+		Reason:        models.MovementTransfer,
+		Delta:         delta,
+		ReferenceType: models.MovementRefTransfer,
+		ReferenceID:   int(transfer.ID),
+		ActorID:       actorID,
+	}
+}
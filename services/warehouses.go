@@ -0,0 +1,359 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Allocation strategies, selected with ALLOCATION_STRATEGY.
+const (
+	AllocateByPriority   = "priority"      // warehouses in priority order
+	AllocateClosest      = "closest"       // warehouses nearest the shipping address first
+	AllocateFewestSplits = "fewest_splits" // as few warehouses, and so shipments, as possible
+)
+
+const (
+	defaultWarehouseCode  = "MAIN"
+	earthRadiusKilometres = 6371.0
+
+	// otherCountryDistance ranks warehouses in another country after every warehouse in the destination
+	// country when the destination has no coordinates
+	otherCountryDistance = 1e9
+)
+
+// ErrNoWarehouse is returned when stock needs a location and no active warehouse exists.
+var ErrNoWarehouse = errors.New("no active warehouse")
+
+// Destination is where an order ships to. Coordinates are optional; without them the closest
+// strategy prefers warehouses in the same country.
+type Destination struct {
+	Country   string
+	Latitude  *float64
+	Longitude *float64
+}
+
+// StockLine is a quantity of a product to allocate.
+type StockLine struct {
+	ProductID int
+	Quantity  int
+}
+
+// Allocation is a quantity of a product shipped from one warehouse.
+type Allocation struct {
+	ProductID   int `json:"product_id"`
+	WarehouseID int `json:"warehouse_id"`
+	Quantity    int `json:"quantity"`
+}
+
+// AllocationStrategy is the strategy orders are allocated with, from ALLOCATION_STRATEGY (default priority).
+func AllocationStrategy() string {
+	switch strategy := strings.ToLower(os.Getenv("ALLOCATION_STRATEGY")); strategy {
+	case AllocateClosest, AllocateFewestSplits:
+		return strategy
+	}
+	return AllocateByPriority
+}
+
+// DefaultWarehouse is the location stock set directly on a product is kept at: the warehouse with the
+// code in DEFAULT_WAREHOUSE, or else the active warehouse with the lowest priority.
+func DefaultWarehouse(db *gorm.DB) (*models.Warehouse, error) {
+	var warehouse models.Warehouse
+	if code := os.Getenv("DEFAULT_WAREHOUSE"); code != "" {
+		if err := db.Where("code = ?", code).First(&warehouse).Error; err == nil {
+			return &warehouse, nil
+		}
+	}
+	if err := db.Where("active = ?", true).Order("priority, id").First(&warehouse).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoWarehouse
+		}
+		return nil, err
+	}
+	return &warehouse, nil
+}
+
+// BackfillInventory creates a default warehouse when there is none, puts the stock of every product
+// without a location there and opens the ledger of every location without movements with its current
+// stock. It is run at startup and does nothing once every product has a location in the ledger.
+func BackfillInventory() error {
+	var count int64
+	if err := config.DB.Model(&models.Warehouse{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		warehouse := models.Warehouse{Code: defaultWarehouseCode, Name: "Main warehouse", Active: true}
+		if err := config.DB.Create(&warehouse).Error; err != nil {
+			return err
+		}
+	}
+	warehouse, err := DefaultWarehouse(config.DB)
+	if err != nil {
+		return err
+	}
+
+	if err := config.DB.Exec(`INSERT INTO inventories (product_id, warehouse_id, quantity, stock_level, reorder_level, last_restock)
+		SELECT products.id, ?, products.quantity, 0, 0, NOW() FROM products
+		WHERE products.deleted_at IS NULL AND products.type = ?
+		AND NOT EXISTS (SELECT 1 FROM inventories WHERE inventories.product_id = products.id)`,
+		warehouse.ID, models.ProductTypeSimple).Error; err != nil {
+		return err
+	}
+
+	return config.DB.Exec(`INSERT INTO stock_movements (product_id, warehouse_id, reason, delta, balance, reference_type, reference_id, note, actor_id, created_at)
+		SELECT inventories.product_id, inventories.warehouse_id, ?, inventories.quantity, inventories.quantity, '', 0, 'opening balance', 0, NOW()
+		FROM inventories WHERE inventories.quantity <> 0
+		AND NOT EXISTS (SELECT 1 FROM stock_movements WHERE stock_movements.product_id = inventories.product_id AND stock_movements.warehouse_id = inventories.warehouse_id)`,
+		models.MovementAdjustment).Error
+}
+
+// stocksProduct reports whether a product keeps stock of its own; bundles take theirs from their
+// components and digital products have none.
+func stocksProduct(product *models.Product) bool {
+	return product.Type == "" || product.Type == models.ProductTypeSimple
+}
+
+// RecordStockChange posts the change when a product's Quantity is set directly on create or update as
+// an adjustment at the default warehouse. The product's Quantity is then recomputed from its locations,
+// which also undoes an overwrite made from a stale copy of the product.
+func RecordStockChange(tx *gorm.DB, previous, product *models.Product, actorID int) error {
+	if !stocksProduct(product) {
+		return nil
+	}
+	delta := product.Quantity
+	if previous != nil {
+		delta -= previous.Quantity
+	}
+	if delta == 0 {
+		return syncProductStock(tx, int(product.ID))
+	}
+
+	warehouse, err := DefaultWarehouse(tx)
+	if err != nil {
+		return err
+	}
+	return PostStockMovement(tx, &models.StockMovement{
+		ProductID:   int(product.ID),
+		WarehouseID: int(warehouse.ID),
+		Reason:      models.MovementAdjustment,
+		Delta:       delta,
+		Note:        "product quantity set",
+		ActorID:     actorID,
+	})
+}
+
+// SetLocationStock sets the stock of a product at a warehouse, posting the difference as an adjustment,
+// and its reorder and stock levels.
+func SetLocationStock(db *gorm.DB, productID, warehouseID int, inventory models.Inventory, actorID int) (*models.Inventory, error) {
+	if inventory.Quantity < 0 || inventory.ReorderLevel < 0 || inventory.StockLevel < 0 {
+		return nil, errors.New("quantity, reorder_level and stock_level cannot be negative")
+	}
+
+	var saved models.Inventory
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.First(&product, productID).Error; err != nil {
+			return fmt.Errorf("product %d not found", productID)
+		}
+		if !stocksProduct(&product) {
+			return fmt.Errorf("product %d is a %s and has no stock of its own", productID, product.Type)
+		}
+		var warehouse models.Warehouse
+		if err := tx.First(&warehouse, warehouseID).Error; err != nil {
+			return fmt.Errorf("warehouse %d not found", warehouseID)
+		}
+
+		var current models.Inventory
+		err := tx.Where("product_id = ? AND warehouse_id = ?", productID, warehouseID).First(&current).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := PostStockMovement(tx, &models.StockMovement{
+			ProductID:   productID,
+			WarehouseID: warehouseID,
+			Reason:      models.MovementAdjustment,
+			Delta:       inventory.Quantity - current.Quantity,
+			Note:        "location quantity set",
+			ActorID:     actorID,
+		}); err != nil {
+			return err
+		}
+
+		saved = models.Inventory{ProductID: productID, WarehouseID: warehouseID}
+		if err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&saved).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id = ? AND warehouse_id = ?", productID, warehouseID).First(&saved).Error; err != nil {
+			return err
+		}
+		return tx.Model(&saved).Updates(map[string]interface{}{
+			"reorder_level": inventory.ReorderLevel, "stock_level": inventory.StockLevel,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	InvalidateProductCache(productID)
+	return &saved, nil
+}
+
+// rankedWarehouse is an active warehouse with its rank for an order, best first.
+type rankedWarehouse struct {
+	models.Warehouse
+	distance float64
+}
+
+// rankWarehouses orders the active warehouses for an order: by priority, or for the closest strategy by
+// distance to the destination, falling back to same-country first when it has no coordinates.
+func rankWarehouses(warehouses []models.Warehouse, strategy string, destination Destination) []rankedWarehouse {
+	ranked := make([]rankedWarehouse, len(warehouses))
+	for i, warehouse := range warehouses {
+		ranked[i] = rankedWarehouse{Warehouse: warehouse}
+		if strategy != AllocateClosest {
+			continue
+		}
+		switch {
+		case destination.Latitude != nil && destination.Longitude != nil:
+			ranked[i].distance = haversineKilometres(warehouse.Latitude, warehouse.Longitude, *destination.Latitude, *destination.Longitude)
+		case destination.Country != "" && !strings.EqualFold(destination.Country, warehouse.Country):
+			ranked[i].distance = otherCountryDistance
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].distance != ranked[j].distance {
+			return ranked[i].distance < ranked[j].distance
+		}
+		if ranked[i].Priority != ranked[j].Priority {
+			return ranked[i].Priority < ranked[j].Priority
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+	return ranked
+}
+
+func haversineKilometres(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat, dLon := toRadians(lat2-lat1), toRadians(lon2-lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKilometres * math.Asin(math.Sqrt(a))
+}
+
+// AllocateStock picks the warehouses an order's lines ship from, with the configured strategy. The
+// products and their inventory rows are locked until the transaction ends, so the allocation can be
+// reserved without another checkout taking the same units.
+func AllocateStock(tx *gorm.DB, lines []StockLine, destination Destination) ([]Allocation, error) {
+	if len(lines) == 0 {
+		return nil, nil
+	}
+	productIDs := make([]int, len(lines))
+	for i, line := range lines {
+		productIDs[i] = line.ProductID
+	}
+
+	var warehouses []models.Warehouse
+	if err := tx.Where("active = ?", true).Find(&warehouses).Error; err != nil {
+		return nil, err
+	}
+	if len(warehouses) == 0 {
+		return nil, ErrNoWarehouse
+	}
+	strategy := AllocationStrategy()
+	ranked := rankWarehouses(warehouses, strategy, destination)
+
+	// Products before inventories, the order every stock change takes its locks in
+	if err := lockProducts(tx, productIDs); err != nil {
+		return nil, err
+	}
+	var inventories []models.Inventory
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id IN ? AND quantity > 0", productIDs).
+		Order("product_id, warehouse_id").Find(&inventories).Error; err != nil {
+		return nil, err
+	}
+	stock := make(map[int]map[int]int) // warehouse -> product -> units
+	for _, inventory := range inventories {
+		if stock[inventory.WarehouseID] == nil {
+			stock[inventory.WarehouseID] = make(map[int]int)
+		}
+		stock[inventory.WarehouseID][inventory.ProductID] = inventory.Quantity
+	}
+
+	remaining := make(map[int]int)
+	for _, line := range lines {
+		remaining[line.ProductID] += line.Quantity
+	}
+
+	order := ranked
+	if strategy == AllocateFewestSplits {
+		order = fewestSplitsOrder(ranked, stock, remaining)
+	}
+
+	return allocateFromStock(order, productIDs, stock, remaining)
+}
+
+// allocateFromStock takes the remaining units of each product from the warehouses in order, as many as
+// each one has, and fails if any product cannot be filled. stock and remaining are used up.
+func allocateFromStock(order []rankedWarehouse, productIDs []int, stock map[int]map[int]int, remaining map[int]int) ([]Allocation, error) {
+	var allocations []Allocation
+	for _, warehouse := range order {
+		for _, productID := range productIDs {
+			need := remaining[productID]
+			available := stock[int(warehouse.ID)][productID]
+			if need == 0 || available == 0 {
+				continue
+			}
+			take := min(need, available)
+			allocations = append(allocations, Allocation{ProductID: productID, WarehouseID: int(warehouse.ID), Quantity: take})
+			remaining[productID] -= take
+			stock[int(warehouse.ID)][productID] -= take
+		}
+	}
+	for _, productID := range productIDs {
+		if remaining[productID] > 0 {
+			return nil, fmt.Errorf("%w for product %d", ErrInsufficientStock, productID)
+		}
+	}
+	return allocations, nil
+}
+
+// fewestSplitsOrder orders warehouses greedily by how many of the still needed units each can ship,
+// so an order that one warehouse can fill ships from that warehouse alone. Ties keep the priority order.
+func fewestSplitsOrder(ranked []rankedWarehouse, stock map[int]map[int]int, remaining map[int]int) []rankedWarehouse {
+	need := make(map[int]int, len(remaining))
+	for productID, quantity := range remaining {
+		need[productID] = quantity
+	}
+	pending := append([]rankedWarehouse(nil), ranked...)
+
+	var order []rankedWarehouse
+	for len(pending) > 0 {
+		best, bestUnits := -1, 0
+		for i, warehouse := range pending {
+			units := 0
+			for productID, quantity := range need {
+				units += min(quantity, stock[int(warehouse.ID)][productID])
+			}
+			if units > bestUnits {
+				best, bestUnits = i, units
+			}
+		}
+		if best < 0 {
+			break
+		}
+		chosen := pending[best]
+		for productID, quantity := range need {
+			need[productID] = quantity - min(quantity, stock[int(chosen.ID)][productID])
+		}
+		order = append(order, chosen)
+		pending = append(pending[:best], pending[best+1:]...)
+	}
+	return order
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+func warehouse(id uint, country string, latitude, longitude float64, priority int) models.Warehouse {
+	return models.Warehouse{Model: gorm.Model{ID: id}, Country: country, Latitude: latitude, Longitude: longitude, Priority: priority, Active: true}
+}
+
+func rankedIDs(ranked []rankedWarehouse) []uint {
+	ids := make([]uint, len(ranked))
+	for i, warehouse := range ranked {
+		ids[i] = warehouse.ID
+	}
+	return ids
+}
+
+func TestRankWarehouses(t *testing.T) {
+	parisLatitude, parisLongitude := 48.86, 2.35
+	warehouses := []models.Warehouse{
+		warehouse(1, "GB", 51.51, -0.13, 2), // London
+		warehouse(2, "DE", 52.52, 13.40, 1), // Berlin
+		warehouse(3, "FR", 45.76, 4.84, 3),  // Lyon
+		warehouse(4, "GB", 53.48, -2.24, 1), // Manchester
+	}
+
+	tests := []struct {
+		name        string
+		strategy    string
+		destination Destination
+		want        []uint
+	}{
+		{"priority then ID", AllocateByPriority, Destination{Country: "FR"}, []uint{2, 4, 1, 3}},
+		{"fewest splits starts from priority", AllocateFewestSplits, Destination{}, []uint{2, 4, 1, 3}},
+		{"closest by coordinates", AllocateClosest, Destination{Latitude: &parisLatitude, Longitude: &parisLongitude}, []uint{1, 3, 4, 2}},
+		{"closest by country", AllocateClosest, Destination{Country: "gb"}, []uint{4, 1, 2, 3}},
+		{"closest without a destination", AllocateClosest, Destination{}, []uint{2, 4, 1, 3}},
+		{"closest needs both coordinates", AllocateClosest, Destination{Country: "FR", Latitude: &parisLatitude}, []uint{3, 2, 4, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := rankedIDs(rankWarehouses(warehouses, test.strategy, test.destination))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("rankWarehouses() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFewestSplitsOrder(t *testing.T) {
+	ranked := rankWarehouses([]models.Warehouse{
+		warehouse(1, "", 0, 0, 1),
+		warehouse(2, "", 0, 0, 2),
+		warehouse(3, "", 0, 0, 3),
+	}, AllocateFewestSplits, Destination{})
+
+	tests := []struct {
+		name      string
+		stock     map[int]map[int]int
+		remaining map[int]int
+		want      []uint
+	}{
+		{
+			name:      "one warehouse fills the order",
+			stock:     map[int]map[int]int{1: {10: 1}, 2: {10: 1, 20: 1}, 3: {10: 5, 20: 5}},
+			remaining: map[int]int{10: 2, 20: 2},
+			want:      []uint{3},
+		},
+		{
+			name:      "ties keep the priority order",
+			stock:     map[int]map[int]int{1: {10: 2}, 2: {10: 2}, 3: {10: 2}},
+			remaining: map[int]int{10: 2},
+			want:      []uint{1},
+		},
+		{
+			name:      "greedy by units still needed",
+			stock:     map[int]map[int]int{1: {10: 1}, 2: {10: 3}, 3: {20: 2}},
+			remaining: map[int]int{10: 4, 20: 2},
+			want:      []uint{2, 3, 1},
+		},
+		{
+			name:      "warehouses shipping nothing are dropped",
+			stock:     map[int]map[int]int{2: {10: 1}, 3: {30: 9}},
+			remaining: map[int]int{10: 1},
+			want:      []uint{2},
+		},
+		{
+			name:      "no stock",
+			stock:     map[int]map[int]int{},
+			remaining: map[int]int{10: 1},
+			want:      []uint{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			remaining := make(map[int]int, len(test.remaining))
+			for productID, quantity := range test.remaining {
+				remaining[productID] = quantity
+			}
+			got := rankedIDs(fewestSplitsOrder(ranked, test.stock, remaining))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("fewestSplitsOrder() = %v, want %v", got, test.want)
+			}
+			if !reflect.DeepEqual(remaining, test.remaining) {
+				t.Errorf("fewestSplitsOrder() changed remaining to %v", remaining)
+			}
+		})
+	}
+}
+
+func TestAllocateFromStock(t *testing.T) {
+	ranked := rankWarehouses([]models.Warehouse{
+		warehouse(1, "", 0, 0, 1),
+		warehouse(2, "", 0, 0, 2),
+	}, AllocateByPriority, Destination{})
+
+	tests := []struct {
+		name       string
+		productIDs []int
+		stock      map[int]map[int]int
+		remaining  map[int]int
+		want       []Allocation
+		wantErr    error
+	}{
+		{
+			name:       "filled from the first warehouse",
+			productIDs: []int{10},
+			stock:      map[int]map[int]int{1: {10: 5}, 2: {10: 5}},
+			remaining:  map[int]int{10: 3},
+			want:       []Allocation{{ProductID: 10, WarehouseID: 1, Quantity: 3}},
+		},
+		{
+			name:       "split across warehouses",
+			productIDs: []int{10, 20},
+			stock:      map[int]map[int]int{1: {10: 2}, 2: {10: 5, 20: 1}},
+			remaining:  map[int]int{10: 4, 20: 1},
+			want: []Allocation{
+				{ProductID: 10, WarehouseID: 1, Quantity: 2},
+				{ProductID: 10, WarehouseID: 2, Quantity: 2},
+				{ProductID: 20, WarehouseID: 2, Quantity: 1},
+			},
+		},
+		{
+			name:       "a product listed on two lines is allocated once",
+			productIDs: []int{10, 10},
+			stock:      map[int]map[int]int{1: {10: 5}},
+			remaining:  map[int]int{10: 4},
+			want:       []Allocation{{ProductID: 10, WarehouseID: 1, Quantity: 4}},
+		},
+		{
+			name:       "not enough stock",
+			productIDs: []int{10},
+			stock:      map[int]map[int]int{1: {10: 1}, 2: {10: 1}},
+			remaining:  map[int]int{10: 3},
+			wantErr:    ErrInsufficientStock,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := allocateFromStock(ranked, test.productIDs, test.stock, test.remaining)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("allocateFromStock() error = %v, want %v", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("allocateFromStock() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/theinvincible/ecommerce-backend/config"
+	"github.com/theinvincible/ecommerce-backend/models"
+	"github.com/theinvincible/ecommerce-backend/utils"
+	"gorm.io/gorm"
+)
+
+// ErrNotOnWishlist is returned when an operation names a product that is not on the wishlist.
+var ErrNotOnWishlist = errors.New("product is not on the wishlist")
+
+// NewShareToken returns a random, unguessable token for a public wishlist link.
+func NewShareToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// SetWishlistVisibility makes a wishlist public with a fresh share token, or private without one.
+func SetWishlistVisibility(wishlist *models.Wishlist, public bool) error {
+	wishlist.IsPublic = public
+	if !public {
+		wishlist.ShareToken = nil
+		return nil
+	}
+	if wishlist.ShareToken != nil {
+		return nil
+	}
+
+	token, err := NewShareToken()
+	if err != nil {
+		return err
+	}
+	wishlist.ShareToken = &token
+	return nil
+}
+
+// AddToWishlist puts a published product on a wishlist, remembering its current effective price
+// as the reference for price-drop alerts. Adding a product twice returns the existing item.
+func AddToWishlist(db *gorm.DB, wishlist *models.Wishlist, productID int) (*models.WishlistItem, error) {
+	var product models.Product
+	if err := db.Scopes(PublishedProducts).First(&product, productID).Error; err != nil {
+		return nil, fmt.Errorf("product %d not found", productID)
+	}
+
+	price, err := CurrentEffectivePrice(db, &product)
+	if err != nil {
+		return nil, err
+	}
+
+	item := models.WishlistItem{
+		WishlistID:     int(wishlist.ID),
+		ProductID:      productID,
+		PriceWhenAdded: price,
+	}
+	if err := db.Where(models.WishlistItem{WishlistID: int(wishlist.ID), ProductID: productID}).FirstOrCreate(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// RemoveFromWishlist deletes a product from a wishlist. The delete is permanent so the product can be added again.
+func RemoveFromWishlist(db *gorm.DB, wishlist *models.Wishlist, productID int) error {
+	result := db.Unscoped().Where("wishlist_id = ? AND product_id = ?", wishlist.ID, productID).Delete(&models.WishlistItem{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotOnWishlist
+	}
+	return nil
+}
+
+// MoveToCart moves a product from a wishlist into the owner's most recent cart, creating a cart if they have none.
+func MoveToCart(db *gorm.DB, wishlist *models.Wishlist, productID int, quantity int) (*models.Cart, error) {
+	if quantity < 1 {
+		quantity = 1
+	}
+
+	var cart models.Cart
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := RemoveFromWishlist(tx, wishlist, productID); err != nil {
+			return err
+		}
+
+		err := tx.Preload("Items").Where("user_id = ?", wishlist.UserID).Order("id desc").First(&cart).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			cart = models.Cart{UserID: wishlist.UserID}
+		} else if err != nil {
+			return err
+		}
+
+		found := false
+		for i := range cart.Items {
+			if cart.Items[i].ProductID == productID {
+				cart.Items[i].Quantity += quantity
+				found = true
+			}
+		}
+		if !found {
+			cart.Items = append(cart.Items, models.CartItem{ProductID: productID, Quantity: quantity})
+		}
+
+		if err := PriceCart(tx, &cart); err != nil {
+			return err
+		}
+		return tx.Session(&gorm.Session{FullSaveAssociations: true}).Save(&cart).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// NotifyWishlistPriceDrops alerts users when a wishlisted product's effective price falls below the
+// price it had when they added it. Each drop is announced once: a further alert needs a lower price still.
+// Only items whose latest recorded price is below their reference price are loaded, and their products
+// are repriced before alerting. Alerts are stored as notifications and summarised in one email per user.
+// It is run by the scheduler in main.
+func NotifyWishlistPriceDrops() error {
+	latestPrices := config.DB.Model(&models.PriceHistory{}).
+		Select("DISTINCT ON (product_id) product_id, effective_price").
+		Order("product_id, created_at desc, id desc")
+
+	// Products without price history yet are judged by their discounted list price
+	const currentPrice = "COALESCE(latest_prices.effective_price, products.price * (1 - COALESCE(products.discount, 0) / 100))"
+
+	var items []struct {
+		ItemID            uint
+		UserID            int
+		ProductID         int
+		PriceWhenAdded    float64
+		LastNotifiedPrice *float64
+	}
+	err := config.DB.Table("wishlist_items").
+		Select("wishlist_items.id AS item_id, wishlists.user_id, wishlist_items.product_id, wishlist_items.price_when_added, wishlist_items.last_notified_price").
+		Joins("JOIN wishlists ON wishlists.id = wishlist_items.wishlist_id AND wishlists.deleted_at IS NULL").
+		Joins("JOIN products ON products.id = wishlist_items.product_id AND products.deleted_at IS NULL").
+		Joins("LEFT JOIN (?) AS latest_prices ON latest_prices.product_id = wishlist_items.product_id", latestPrices).
+		Where("wishlist_items.deleted_at IS NULL AND " + currentPrice + " < wishlist_items.price_when_added").
+		Where("wishlist_items.last_notified_price IS NULL OR " + currentPrice + " < wishlist_items.last_notified_price").
+		Order("wishlists.user_id, wishlist_items.product_id").
+		Scan(&items).Error
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	productIDs := make([]int, len(items))
+	for i, item := range items {
+		productIDs[i] = item.ProductID
+	}
+	var products []models.Product
+	if err := config.DB.Scopes(PublishedProducts).Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return err
+	}
+	if err := ApplyPricing(products); err != nil {
+		return err
+	}
+	byID := make(map[int]*models.Product, len(products))
+	for i := range products {
+		byID[int(products[i].ID)] = &products[i]
+	}
+
+	type alertKey struct{ userID, productID int }
+	alerted := map[alertKey]bool{}
+	emails := map[int][]string{}
+
+	for _, item := range items {
+		product, ok := byID[item.ProductID]
+		if !ok {
+			continue
+		}
+		price := product.EffectivePrice
+		if price >= item.PriceWhenAdded || (item.LastNotifiedPrice != nil && price >= *item.LastNotifiedPrice) {
+			continue
+		}
+
+		// The same product on several of a user's wishlists is announced once
+		key := alertKey{item.UserID, item.ProductID}
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			if !alerted[key] {
+				notification := models.Notification{
+					UserID:    item.UserID,
+					ProductID: item.ProductID,
+					Title:     fmt.Sprintf("Price drop on %s", product.Name),
+					Message: fmt.Sprintf("%s is now %.2f %s, down from %.2f when you added it to your wishlist.",
+						product.Name, price, BaseCurrency(), item.PriceWhenAdded),
+				}
+				if err := tx.Create(&notification).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&models.WishlistItem{}).Where("id = ?", item.ItemID).UpdateColumn("last_notified_price", price).Error
+		})
+		if err != nil {
+			return err
+		}
+
+		if !alerted[key] {
+			alerted[key] = true
+			emails[item.UserID] = append(emails[item.UserID],
+				fmt.Sprintf("%s: now %.2f %s (was %.2f)", product.Name, price, BaseCurrency(), item.PriceWhenAdded))
+		}
+	}
+
+	for userID, lines := range emails {
+		var user models.User
+		if err := config.DB.First(&user, userID).Error; err != nil {
+			continue
+		}
+		body := "Good news! Prices dropped on products in your wishlist:\n\n" + strings.Join(lines, "\n")
+		if err := utils.SendEmail(user.Email, "Price drop on your wishlist", body); err != nil {
+			log.Printf("Error emailing price drop alert to user %d: %v", userID, err)
+		}
+	}
+
+	if len(alerted) > 0 {
+		log.Printf("Sent %d wishlist price drop alerts", len(alerted))
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"net/http"
+
+	"github.com/theinvincible/ecommerce-backend/models"
+)
+
+// ActorID returns the ID of the authenticated user or vendor making the request, or 0 when unknown.
+func ActorID(r *http.Request) int {
+	if user, ok := r.Context().Value("user").(*models.User); ok {
+		return user.ID
+	}
+	if vendorID, ok := r.Context().Value("vendorID").(uint); ok {
+		return int(vendorID)
+	}
+	return 0
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -24,7 +25,7 @@ func GenerateJWT(ID int) (string, error) {
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "ecommerce-backend",
-			Subject:   "user",
+			Subject:   strconv.Itoa(ID), // the user the token was issued to
 			Audience:  jwt.ClaimStrings{"ecommerce-frontend"},
 			ID:        "unique",
 		},
@@ -17,11 +17,15 @@ func InitializeMailgun() *mailgun.MailgunImpl {
 }
 
 func SendOrderConfirmationEmail(toEmail string, orderDetails string) error {
+	body := fmt.Sprintf("Thank you for your order!\n\nOrder Details:\n%s", orderDetails)
+	return SendEmail(toEmail, "Order Confirmation", body)
+}
+
+// SendEmail sends a plain-text email through Mailgun.
+func SendEmail(toEmail string, subject string, body string) error {
 	mg := InitializeMailgun()
 
 	sender := "no-reply@ecommerce" // Replace with your Mailgun sender email
-	subject := "Order Confirmation"
-	body := fmt.Sprintf("Thank you for your order!\n\nOrder Details:\n%s", orderDetails)
 
 	message := mg.NewMessage(sender, subject, body, toEmail)
 
@@ -10,10 +10,12 @@ import (
 
 var redisClient *redis.Client
 
-// InitRedisClient initializes the Redis client
-func InitRedisClient() *redis.Client {
+// InitRedisClient initializes the Redis client and checks that the server is reachable.
+// The client is returned even when the check fails: go-redis reconnects on its own, and callers
+// decide how to degrade while Redis is down.
+func InitRedisClient() (*redis.Client, error) {
 	if redisClient != nil {
-		return redisClient
+		return redisClient, nil
 	}
 
 	rdb := redis.NewClient(&redis.Options{
@@ -21,24 +23,24 @@ func InitRedisClient() *redis.Client {
 		Password: "",               // No password set
 		DB:       0,                // Use default DB
 	})
+	redisClient = rdb
 
 	// Create a context with a timeout of 10 seconds
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Ping the Redis server to test the connection
-	_, err := rdb.Ping(ctx).Result()
-	if err != nil {
-		log.Fatalf("Failed to connect to Redis at %s: %v", rdb.Options().Addr, err)
-		return nil
+	if _, err := rdb.Ping(ctx).Result(); err != nil {
+		log.Printf("Redis is unavailable at %s: %v", rdb.Options().Addr, err)
+		return rdb, err
 	}
 
 	log.Println("Connected to Redis at", rdb.Options().Addr)
-	redisClient = rdb
-	return redisClient
+	return rdb, nil
 }
 
 // GetRedisClient returns the Redis client
 func GetRedisClient() *redis.Client {
-	return InitRedisClient()
+	rdb, _ := InitRedisClient()
+	return rdb
 }
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"log"
+	"time"
+)
+
+// RunEvery runs task in a background goroutine immediately and then once per interval.
+// Errors are logged and do not stop the schedule.
+func RunEvery(name string, interval time.Duration, task func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := task(); err != nil {
+				log.Printf("Scheduled job %s failed: %v", name, err)
+			}
+			<-ticker.C
+		}
+	}()
+}